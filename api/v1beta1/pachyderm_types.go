@@ -17,6 +17,8 @@ limitations under the License.
 package v1beta1
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -35,8 +37,51 @@ type PachydermSpec struct {
 	Worker *WorkerOptions `json:"worker,omitempty"`
 	// Allows user to customize Postgresql database
 	Postgres PostgresOptions `json:"postgresql,omitempty"`
+	// Determines whether the etcd and postgresql volumes and the
+	// storage secret are kept when the Pachyderm resource is deleted.
+	// The cluster scoped resources are deleted with either policy.
+	// It accepts, "Retain" or "Delete"
+	// +kubebuilder:validation:Enum:=Retain;Delete
+	// +kubebuilder:default:=Retain
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// If true, requests to delete the Pachyderm resource are rejected.
+	// It must be set to false before the resource can be deleted
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+	// Allows the user to customize how version upgrades are rolled out
+	Upgrade *UpgradeOptions `json:"upgrade,omitempty"`
+}
+
+// UpgradeOptions allows the user to configure
+// how changes to the Pachyderm version are rolled out
+type UpgradeOptions struct {
+	// Maximum time an upgrade can take to make progress before the
+	// workloads are rolled back to the last known good version.
+	// Defaults to 10m
+	ProgressDeadline *metav1.Duration `json:"progressDeadline,omitempty"`
+	// If true, a failed upgrade is halted instead of rolled back
+	DisableRollback bool `json:"disableRollback,omitempty"`
+	// If true, a PachydermBackup is taken before the workloads are
+	// upgraded, and the upgrade waits for the backup to complete
+	Backup bool `json:"backup,omitempty"`
 }
 
+// DefaultUpgradeProgressDeadline is the time an upgrade can take to
+// make progress if spec.upgrade.progressDeadline is not set
+const DefaultUpgradeProgressDeadline = 10 * time.Minute
+
+// DeletionPolicy determines which resources are
+// kept when a Pachyderm resource is deleted
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyRetain keeps the data volumes and the
+	// storage secret of a deleted Pachyderm resource
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyDelete deletes all resources
+	// created for a deleted Pachyderm resource
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+)
+
 // WorkerOptions allows the user to configure workers
 type WorkerOptions struct {
 	// Optional image overrides.
@@ -60,6 +105,13 @@ type DashOptions struct {
 	// Used as the host of a rule
 	URL     string            `json:"url,omitempty"`
 	Service *ServiceOverrides `json:"service,omitempty"`
+	// Optional ingress options.
+	// The dash ingress is created when the url is set
+	Ingress *IngressOptions `json:"ingress,omitempty"`
+	// Optional TLS certificate for the dash url.
+	// The certificate secret is used by the dash ingress,
+	// unless the ingress sets its own TLS secret
+	TLS *TLSCertificateOptions `json:"tls,omitempty"`
 }
 
 // ImageOverride allows the user to override the default image
@@ -83,10 +135,117 @@ type ServiceOverrides struct {
 	Type        string   `json:"type"`
 }
 
+// IngressOptions allows the user to expose
+// a component outside the cluster using an ingress
+type IngressOptions struct {
+	// Name of the ingress class used to implement the ingress.
+	// The default ingress class of the cluster is used if not set
+	ClassName *string `json:"className,omitempty"`
+	// Name of the secret containing the TLS certificate for the ingress host
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+	// Annotations used to configure the ingress controller
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Path routed to the component
+	// +kubebuilder:default:=/
+	Path string `json:"path,omitempty"`
+	// Determines how the path is matched.
+	// It accepts, "Exact", "Prefix" or "ImplementationSpecific"
+	// +kubebuilder:validation:Enum:=Exact;Prefix;ImplementationSpecific
+	// +kubebuilder:default:=Prefix
+	PathType string `json:"pathType,omitempty"`
+	// OpenShift route options.
+	// Routes are used instead of ingresses when running on OpenShift
+	Route *RouteOptions `json:"route,omitempty"`
+}
+
+// RouteOptions allows the user to configure the
+// TLS settings of an OpenShift route
+type RouteOptions struct {
+	// Determines where TLS is terminated.
+	// It accepts, "edge", "passthrough" or "reencrypt".
+	// Defaults to "passthrough" for pachd when pachd TLS is enabled,
+	// and to "edge" otherwise. The passthrough and reencrypt
+	// terminations require pachd TLS
+	// +kubebuilder:validation:Enum:=edge;passthrough;reencrypt
+	Termination string `json:"termination,omitempty"`
+	// Determines how insecure HTTP requests are handled by
+	// edge and reencrypt routes.
+	// It accepts, "None", "Allow" or "Redirect"
+	// +kubebuilder:validation:Enum:=None;Allow;Redirect
+	// +kubebuilder:default:=Redirect
+	InsecureEdgeTerminationPolicy string `json:"insecureEdgeTerminationPolicy,omitempty"`
+	// PEM encoded CA certificate used by the router to
+	// verify the component certificate of reencrypt routes
+	DestinationCACertificate string `json:"destinationCACertificate,omitempty"`
+}
+
+// PachdTLSOptions allows the user to secure the pachd APIs with TLS
+type PachdTLSOptions struct {
+	// If true, pachd serves its APIs over TLS.
+	// The certificate is issued and rotated by the operator,
+	// unless a secret or cert-manager issuer is set.
+	// The operator CA also secures the etcd peer connections and
+	// the postgresql connections, and serves etcd clients over TLS
+	// on a dedicated port, since pachd connects to etcd in plaintext
+	Enabled               bool `json:"enabled,omitempty"`
+	TLSCertificateOptions `json:",inline"`
+	// Additional DNS names included in the pachd certificate.
+	// The pachd service names and ingress hosts are always included
+	AdditionalHosts []string `json:"additionalHosts,omitempty"`
+}
+
+// TLSCertificateOptions allows the user to provide a
+// TLS certificate or request one from cert-manager
+type TLSCertificateOptions struct {
+	// Name of an existing kubernetes.io/tls secret holding the certificate
+	SecretName string `json:"secretName,omitempty"`
+	// Request the certificate from a cert-manager issuer.
+	// Ignored if secretName is set
+	CertManager *CertManagerOptions `json:"certManager,omitempty"`
+}
+
+// CertManagerOptions allows the user to request
+// a certificate from a cert-manager issuer
+type CertManagerOptions struct {
+	// Issuer or ClusterIssuer signing the certificate
+	IssuerRef CertManagerIssuerReference `json:"issuerRef"`
+	// Requested validity of the certificate.
+	// The issuer default is used if not set
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// Time before the certificate expires at which it is renewed.
+	// The cert-manager default is used if not set
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+}
+
+// CertManagerIssuerReference references a cert-manager issuer
+type CertManagerIssuerReference struct {
+	// Name of the issuer
+	Name string `json:"name"`
+	// Kind of the issuer.
+	// It accepts, "Issuer" or "ClusterIssuer"
+	// +kubebuilder:validation:Enum:=Issuer;ClusterIssuer
+	// +kubebuilder:default:=Issuer
+	Kind string `json:"kind,omitempty"`
+	// API group of the issuer
+	// +kubebuilder:default:=cert-manager.io
+	Group string `json:"group,omitempty"`
+}
+
+// PachdIngressOptions allows the user to expose the
+// pachd gRPC API and S3 gateway using an ingress
+type PachdIngressOptions struct {
+	IngressOptions `json:",inline"`
+	// Host used to route requests to the pachd gRPC API
+	Host string `json:"host,omitempty"`
+	// Host used to route requests to the pachd S3 gateway
+	S3GatewayHost string `json:"s3GatewayHost,omitempty"`
+}
+
 // EtcdOptions allows users to change the etcd statefulset
 type EtcdOptions struct {
 	// Optional parameter to set the number of nodes in the Etcd statefulset.
-	// Analogous --dynamic-etcd-nodes argument to 'pachctl deploy'
+	// Analogous --dynamic-etcd-nodes argument to 'pachctl deploy'.
+	// It can not be changed once the resource is created
 	DynamicNodes int32 `json:"dynamicNodes,omitempty"`
 	// Optional image overrides.
 	// Used to specify alternative images to use to deploy dash
@@ -97,7 +256,7 @@ type EtcdOptions struct {
 	// Name of existing storage class to use for the Etcd persistent volume.
 	StorageClass string `json:"storageClass,omitempty"`
 	// The size of the storage to use for etcd.
-	// For example: "100Gi"
+	// For example: "100Gi". It can not be changed once the resource is created
 	StorageSize string            `json:"storageSize,omitempty"`
 	Service     *ServiceOverrides `json:"service,omitempty"`
 }
@@ -144,6 +303,10 @@ type PachdOptions struct {
 	// Do not  use in production
 	ExposeObjectAPI bool              `json:"exposeObjectAPI,omitempty"`
 	Service         *ServiceOverrides `json:"service,omitempty"`
+	// Optional ingress exposing the pachd gRPC API and S3 gateway
+	Ingress *PachdIngressOptions `json:"ingress,omitempty"`
+	// Optional TLS options used to secure the pachd APIs
+	TLS *PachdTLSOptions `json:"tls,omitempty"`
 	// Allows user to customize metrics options
 	Metrics            *MetricsOptions `json:"metrics,omitempty"`
 	ServiceAccountName string          `json:"serviceAccountName,omitempty"`
@@ -165,10 +328,15 @@ type PachdPostgresConfig struct {
 	Host string `json:"host,omitempty"`
 	// +kubebuilder:default:=5432
 	Port int32 `json:"port,omitempty"`
+	// SSL mode of the postgresql connections. The postgresql of the
+	// resource is always verified with the instance CA while TLS is enabled
 	// +kubebuilder:default:=disable
-	SSL      string `json:"ssl,omitempty"`
-	User     string `json:"user,omitempty"`
+	SSL  string `json:"ssl,omitempty"`
+	User string `json:"user,omitempty"`
+	// Deprecated: use passwordFrom instead
 	Password string `json:"password,omitempty"`
+	// Secret key containing the password of the postgresql user
+	PasswordFrom *corev1.SecretKeySelector `json:"passwordFrom,omitempty"`
 }
 
 // MetricsOptions allows the user to enable/disable pachyderm metrics
@@ -232,7 +400,10 @@ type AmazonStorageOptions struct {
 	IAMRole string `json:"iamRole,omitempty"`
 	// Set an ID for the cluster deployment.
 	// Defaults to a random value.
+	// Deprecated: use idFrom instead
 	ID string `json:"id,omitempty"`
+	// Secret key containing the access key ID for the S3 bucket
+	IDFrom *corev1.SecretKeySelector `json:"idFrom,omitempty"`
 	// Enable verbose logging in Pachyderm's internal S3 client for debugging.
 	LogOptions string `json:"logOptions,omitempty"`
 	// Set a custom maximum number of upload parts.
@@ -253,11 +424,17 @@ type AmazonStorageOptions struct {
 	// +kubebuilder:default:=true
 	Reverse *bool `json:"reverse,omitempty"`
 	// The secret access key for the S3 bucket
+	// Deprecated: use secretFrom instead
 	Secret string `json:"secret,omitempty"`
+	// Secret key containing the secret access key for the S3 bucket
+	SecretFrom *corev1.SecretKeySelector `json:"secretFrom,omitempty"`
 	// Set a custom timeout for object storage requests.
 	// Default: 5m
 	Timeout string `json:"timeout,omitempty" default:"5m"`
-	Token   string `json:"token,omitempty"`
+	// Deprecated: use tokenFrom instead
+	Token string `json:"token,omitempty"`
+	// Secret key containing the session token for the S3 bucket
+	TokenFrom *corev1.SecretKeySelector `json:"tokenFrom,omitempty"`
 	// Sets a custom upload ACL for object store uploads.
 	// Default: "bucket-owner-full-control"
 	UploadACL string `json:"uploadACL,omitempty" default:"bucket-owner-full-control"`
@@ -277,8 +454,14 @@ type AmazonStorageVault struct {
 // configure Microsoft storage
 type MicrosoftStorageOptions struct {
 	Container string `json:"container,omitempty"`
-	ID        string `json:"id,omitempty"`
-	Secret    string `json:"secret,omitempty"`
+	// Deprecated: use idFrom instead
+	ID string `json:"id,omitempty"`
+	// Secret key containing the storage account name
+	IDFrom *corev1.SecretKeySelector `json:"idFrom,omitempty"`
+	// Deprecated: use secretFrom instead
+	Secret string `json:"secret,omitempty"`
+	// Secret key containing the storage account key
+	SecretFrom *corev1.SecretKeySelector `json:"secretFrom,omitempty"`
 }
 
 // MinioStorageOptions exposes options to
@@ -290,11 +473,17 @@ type MinioStorageOptions struct {
 	// Example: "minio-server:9000"
 	Endpoint string `json:"endpoint,omitempty"`
 	// The user access ID that is used to access minio object store.
+	// Deprecated: use idFrom instead
 	ID string `json:"id,omitempty"`
+	// Secret key containing the user access ID
+	IDFrom *corev1.SecretKeySelector `json:"idFrom,omitempty"`
 	// The associated password that is used with the user access ID
-	Secret    string `json:"secret,omitempty"`
-	Secure    string `json:"secure,omitempty"`
-	Signature string `json:"signature,omitempty"`
+	// Deprecated: use secretFrom instead
+	Secret string `json:"secret,omitempty"`
+	// Secret key containing the password of the user access ID
+	SecretFrom *corev1.SecretKeySelector `json:"secretFrom,omitempty"`
+	Secure     string                    `json:"secure,omitempty"`
+	Signature  string                    `json:"signature,omitempty"`
 }
 
 // LocalStorageOptions exposes options to
@@ -317,11 +506,92 @@ const (
 	PhaseRunning PachydermPhase = "Running"
 	// PhaseDeleting reports the resource status to deleting
 	PhaseDeleting PachydermPhase = "Deleting"
+	// PhaseFailed reports that the operator failed to reconcile the resource
+	PhaseFailed PachydermPhase = "Failed"
 )
 
+// Condition types used to report the state of a Pachyderm resource
+const (
+	// ConditionEtcdReady reports whether the etcd cluster is ready
+	ConditionEtcdReady string = "EtcdReady"
+	// ConditionPostgresReady reports whether the Postgresql database is ready
+	ConditionPostgresReady string = "PostgresReady"
+	// ConditionPachdReady reports whether pachd is ready to serve requests
+	ConditionPachdReady string = "PachdReady"
+	// ConditionDashReady reports whether the Pachyderm dashboard is ready
+	ConditionDashReady string = "DashReady"
+	// ConditionStorageConfigured reports whether the
+	// object storage backend for pachd is configured
+	ConditionStorageConfigured string = "StorageConfigured"
+	// ConditionDegraded is true when one or more components
+	// of a previously running Pachyderm resource are not ready
+	ConditionDegraded string = "Degraded"
+	// ConditionUpgrading is true while the components of a
+	// Pachyderm resource are upgraded to a new version
+	ConditionUpgrading string = "Upgrading"
+	// ConditionUpgradeFailed is true when an upgrade did not make
+	// progress before its deadline and the workloads were rolled back
+	ConditionUpgradeFailed string = "UpgradeFailed"
+	// ConditionDeprecatedFields is true when the pachyderm
+	// resource sets fields that will be removed
+	ConditionDeprecatedFields string = "DeprecatedFields"
+)
+
+// NamingAnnotation records how the objects generated for a Pachyderm
+// resource are named. It is set by the operator the first time the
+// resource is reconciled.
+const NamingAnnotation = "aiml.pachyderm.com/naming"
+
+const (
+	// NamingInstance prefixes the generated objects with the name of
+	// the Pachyderm resource, so several resources can share a namespace
+	NamingInstance = "instance"
+	// NamingLegacy keeps the unprefixed names of resources deployed by
+	// earlier versions of the operator, so the existing workloads and
+	// volume claims keep being used
+	NamingLegacy = "legacy"
+)
+
+// AllowUnsafeUpdateAnnotation allows changes to the pachyderm resource
+// that are rejected by default because they can make existing data
+// unreachable, such as changing the storage bucket or downgrading
+// Pachyderm. It is meant to be set for a deliberate migration, and
+// removed once the migration is done. Changes that can not be
+// applied at all, such as changing the naming annotation, are
+// rejected even when it is set.
+const AllowUnsafeUpdateAnnotation = "aiml.pachyderm.com/allow-unsafe-update"
+
+// RestoreAnnotation is set by a PachydermRestore to the name of the
+// restore while it holds the pachd, dash and etcd workloads of the
+// Pachyderm resource scaled down
+const RestoreAnnotation = "aiml.pachyderm.com/restore"
+
+// RestoreEtcdAnnotation is set by a PachydermRestore to the name of
+// the restore once pachd and dash are scaled down, to scale etcd down
+// as well. Etcd keeps running until then, so pachd and dash do not
+// lose their metadata store while they shut down.
+const RestoreEtcdAnnotation = "aiml.pachyderm.com/restore-etcd"
+
 // PachydermStatus defines the observed state of Pachyderm
 type PachydermStatus struct {
 	Phase PachydermPhase `json:"phase"`
+	// The most recent generation of the Pachyderm resource observed by the operator
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Message describing the last error encountered
+	// while reconciling the Pachyderm resource
+	LastError string `json:"lastError,omitempty"`
+	// Time at which the last error was encountered
+	LastErrorTime *metav1.Time `json:"lastErrorTime,omitempty"`
+	// Version of Pachyderm all components have been rolled out with
+	CurrentVersion string `json:"currentVersion,omitempty"`
+	// Version of Pachyderm the components are being rolled out with
+	TargetVersion string `json:"targetVersion,omitempty"`
+	// Conditions report the state of the individual
+	// components that make up the Pachyderm deployment
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
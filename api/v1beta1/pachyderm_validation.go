@@ -0,0 +1,406 @@
+/*
+Copyright 2021 Pachyderm.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
+)
+
+// storageBackends lists the supported storage backends.
+// Each backend is configured using the block of the same name
+var storageBackends = []string{"amazon", "google", "microsoft", "minio", "local"}
+
+// invalidError aggregates field errors into
+// the error returned by the validating webhook
+func (r *Pachyderm) invalidError(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Pachyderm").GroupKind(), r.Name, errs)
+}
+
+// validate returns the errors in the pachyderm resource spec.
+// The version is checked against the version catalog separately,
+// only when it is set or changed.
+func (r *Pachyderm) validate() field.ErrorList {
+	errs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	errs = append(errs, r.validateStorage(specPath.Child("pachd", "storage"))...)
+	errs = append(errs, validateQuantity(r.Spec.Pachd.BlockCacheBytes,
+		specPath.Child("pachd", "blockCacheBytes"))...)
+	errs = append(errs, validateQuantity(r.Spec.Etcd.StorageSize,
+		specPath.Child("etcd", "storageSize"))...)
+	errs = append(errs, validateSecretKeyRef(r.Spec.Pachd.Postgres.PasswordFrom,
+		specPath.Child("pachd", "postgresql", "passwordFrom"))...)
+	errs = append(errs, validateExclusive(r.Spec.Pachd.Postgres.Password != "", r.Spec.Pachd.Postgres.PasswordFrom,
+		specPath.Child("pachd", "postgresql", "password"))...)
+
+	errs = append(errs, r.validatePachdRoute(specPath.Child("pachd", "ingress", "route", "termination"))...)
+
+	if r.Spec.Upgrade != nil && r.Spec.Upgrade.ProgressDeadline != nil &&
+		r.Spec.Upgrade.ProgressDeadline.Duration <= 0 {
+		errs = append(errs, field.Invalid(specPath.Child("upgrade", "progressDeadline"),
+			r.Spec.Upgrade.ProgressDeadline.Duration.String(), "must be greater than zero"))
+	}
+
+	return errs
+}
+
+// validatePachdRoute checks the pachd routes only pass connections
+// through, or reencrypt them, when pachd serves its APIs over TLS
+func (r *Pachyderm) validatePachdRoute(path *field.Path) field.ErrorList {
+	ingress := r.Spec.Pachd.Ingress
+	if ingress == nil || ingress.Route == nil {
+		return nil
+	}
+
+	termination := ingress.Route.Termination
+	tlsEnabled := r.Spec.Pachd.TLS != nil && r.Spec.Pachd.TLS.Enabled
+	if (termination == "passthrough" || termination == "reencrypt") && !tlsEnabled {
+		return field.ErrorList{
+			field.Forbidden(path, fmt.Sprintf("%s termination requires pachd TLS, set spec.pachd.tls.enabled", termination)),
+		}
+	}
+
+	return nil
+}
+
+// allowUnsafeUpdate returns true if the user disabled
+// the checks guarding against unsafe updates
+func (r *Pachyderm) allowUnsafeUpdate() bool {
+	return r.Annotations[AllowUnsafeUpdateAnnotation] == "true"
+}
+
+// validateUpdate returns the errors for changes that can make
+// existing data unreachable or can not be applied to the
+// running Pachyderm deployment. The allow unsafe update annotation
+// overrides the rules guarding a deliberate migration, changes that
+// can not be applied at all are rejected regardless.
+func (r *Pachyderm) validateUpdate(old *Pachyderm) field.ErrorList {
+	errs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+	override := fmt.Sprintf("set the %s annotation to \"true\" to migrate deliberately", AllowUnsafeUpdateAnnotation)
+
+	// unsafe records the violation of a rule the annotation overrides
+	unsafe := func(path *field.Path, detail string) {
+		if r.allowUnsafeUpdate() {
+			pachydermlog.Info("unsafe update allowed by annotation",
+				"name", r.Name,
+				"namespace", r.Namespace,
+				"field", path.String(),
+				"annotation", AllowUnsafeUpdateAnnotation)
+			return
+		}
+		errs = append(errs, field.Forbidden(path, fmt.Sprintf("%s; %s", detail, override)))
+	}
+
+	storagePath := specPath.Child("pachd", "storage")
+	bucketPath, oldBucket := storageBucket(old, storagePath)
+	_, bucket := storageBucket(r, storagePath)
+	if r.Spec.Pachd.Storage.Backend != old.Spec.Pachd.Storage.Backend {
+		unsafe(storagePath.Child("backend"),
+			fmt.Sprintf("can not be changed from %q after creation, pachd would lose access to existing data",
+				old.Spec.Pachd.Storage.Backend))
+	} else if bucketPath != nil && oldBucket != bucket {
+		unsafe(bucketPath,
+			fmt.Sprintf("can not be changed from %q after creation, pachd would lose access to existing data",
+				oldBucket))
+	}
+
+	etcdPath := specPath.Child("etcd")
+	if r.Spec.Etcd.StorageClass != old.Spec.Etcd.StorageClass {
+		unsafe(etcdPath.Child("storageClass"),
+			fmt.Sprintf("can not be changed from %q, the etcd volume claims are immutable",
+				old.Spec.Etcd.StorageClass))
+	}
+
+	if r.Spec.Etcd.StorageSize != old.Spec.Etcd.StorageSize {
+		oldSize, oldErr := resource.ParseQuantity(old.Spec.Etcd.StorageSize)
+		size, err := resource.ParseQuantity(r.Spec.Etcd.StorageSize)
+		switch {
+		case oldErr == nil && err == nil && size.Cmp(oldSize) < 0:
+			unsafe(etcdPath.Child("storageSize"),
+				fmt.Sprintf("can not be reduced from %s, volumes can not shrink", old.Spec.Etcd.StorageSize))
+		case oldErr != nil || err != nil || size.Cmp(oldSize) != 0:
+			unsafe(etcdPath.Child("storageSize"),
+				fmt.Sprintf("can not be changed from %q, the etcd volume claims are immutable", old.Spec.Etcd.StorageSize))
+		}
+	}
+
+	// members are not added to or removed from a running etcd cluster
+	if etcdMembers(r) != etcdMembers(old) {
+		unsafe(etcdPath.Child("dynamicNodes"),
+			fmt.Sprintf("can not be changed from %d after creation, etcd members are not added to or removed from a running cluster",
+				etcdMembers(old)))
+	}
+
+	// renaming the generated objects would replace the workloads
+	// and volume claims with new, empty ones, which no migration needs
+	if naming := old.Annotations[NamingAnnotation]; naming != "" && r.Annotations[NamingAnnotation] != naming {
+		errs = append(errs, field.Forbidden(field.NewPath("metadata", "annotations").Key(NamingAnnotation),
+			fmt.Sprintf("can not be changed from %q, the objects of the resource would be replaced", naming)))
+	}
+
+	// the version can be set back to the version currently
+	// rolled out to cancel an upgrade that did not complete
+	oldVersion, version := catalog.Canonical(old.Spec.Version), catalog.Canonical(r.Spec.Version)
+	if semver.IsValid(oldVersion) && semver.IsValid(version) && semver.Compare(version, oldVersion) < 0 &&
+		version != catalog.Canonical(old.Status.CurrentVersion) {
+		unsafe(specPath.Child("version"),
+			fmt.Sprintf("can not be downgraded from %s, older versions may not read the existing metadata", old.Spec.Version))
+	}
+
+	return errs
+}
+
+// etcdMembers returns the number of members of the etcd cluster
+func etcdMembers(pd *Pachyderm) int32 {
+	if pd.Spec.Etcd.DynamicNodes > 0 {
+		return pd.Spec.Etcd.DynamicNodes
+	}
+	return 1
+}
+
+// storageBucket returns the path and value of the bucket,
+// or container, used by the selected storage backend
+func storageBucket(pd *Pachyderm, path *field.Path) (*field.Path, string) {
+	storage := pd.Spec.Pachd.Storage
+
+	switch {
+	case storage.Backend == "amazon" && storage.Amazon != nil:
+		return path.Child("amazon", "bucket"), storage.Amazon.Bucket
+	case storage.Backend == "google" && storage.Google != nil:
+		return path.Child("google", "bucket"), storage.Google.Bucket
+	case storage.Backend == "microsoft" && storage.Microsoft != nil:
+		return path.Child("microsoft", "container"), storage.Microsoft.Container
+	case storage.Backend == "minio" && storage.Minio != nil:
+		return path.Child("minio", "bucket"), storage.Minio.Bucket
+	case storage.Backend == "local" && storage.Local != nil:
+		return path.Child("local", "hostPath"), storage.Local.HostPath
+	}
+
+	return nil, ""
+}
+
+// validateVersion checks the manifests of the
+// version are available in the version catalog
+func validateVersion(version string, path *field.Path) field.ErrorList {
+	// the default version is set by the mutating webhook
+	if version == "" {
+		return nil
+	}
+
+	if _, err := versionCatalog.Manifests(version); err != nil {
+		if !errors.Is(err, catalog.ErrVersionNotFound) {
+			return field.ErrorList{field.InternalError(path, err)}
+		}
+
+		versions, err := versionCatalog.Versions()
+		if err != nil {
+			return field.ErrorList{field.InternalError(path, err)}
+		}
+		return field.ErrorList{field.NotSupported(path, version, versions)}
+	}
+
+	return nil
+}
+
+// validateStorage checks the configuration block of the selected storage
+// backend is set and complete, and no other backend is configured
+func (r *Pachyderm) validateStorage(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	storage := r.Spec.Pachd.Storage
+
+	configured := map[string]bool{
+		"amazon":    storage.Amazon != nil,
+		"google":    storage.Google != nil,
+		"microsoft": storage.Microsoft != nil,
+		"minio":     storage.Minio != nil,
+		"local":     storage.Local != nil,
+	}
+
+	for _, backend := range storageBackends {
+		if backend != storage.Backend && configured[backend] {
+			errs = append(errs, field.Forbidden(path.Child(backend),
+				fmt.Sprintf("must not be set when the storage backend is %q", storage.Backend)))
+		}
+	}
+
+	switch storage.Backend {
+	case "amazon":
+		if storage.Amazon == nil {
+			return append(errs, field.Required(path.Child("amazon"), "required by the amazon storage backend"))
+		}
+		errs = append(errs, validateAmazonStorage(storage.Amazon, path.Child("amazon"))...)
+	case "google":
+		if storage.Google == nil {
+			return append(errs, field.Required(path.Child("google"), "required by the google storage backend"))
+		}
+		errs = append(errs, validateGoogleStorage(storage.Google, path.Child("google"))...)
+	case "microsoft":
+		if storage.Microsoft == nil {
+			return append(errs, field.Required(path.Child("microsoft"), "required by the microsoft storage backend"))
+		}
+		errs = append(errs, validateMicrosoftStorage(storage.Microsoft, path.Child("microsoft"))...)
+	case "minio":
+		if storage.Minio == nil {
+			return append(errs, field.Required(path.Child("minio"), "required by the minio storage backend"))
+		}
+		errs = append(errs, validateMinioStorage(storage.Minio, path.Child("minio"))...)
+	case "local":
+		// the local storage block is defaulted by the mutating webhook
+	default:
+		errs = append(errs, field.NotSupported(path.Child("backend"), storage.Backend, storageBackends))
+	}
+
+	return errs
+}
+
+func validateAmazonStorage(amazon *AmazonStorageOptions, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if amazon.Bucket == "" {
+		errs = append(errs, field.Required(path.Child("bucket"), ""))
+	}
+	if amazon.Region == "" {
+		errs = append(errs, field.Required(path.Child("region"), ""))
+	}
+
+	// credentials are optional when pachd
+	// assumes an IAM role to access the bucket
+	errs = append(errs, validateCredential(amazon.ID, amazon.IDFrom, amazon.IAMRole == "", path.Child("id"), path.Child("idFrom"))...)
+	errs = append(errs, validateCredential(amazon.Secret, amazon.SecretFrom, amazon.IAMRole == "", path.Child("secret"), path.Child("secretFrom"))...)
+	errs = append(errs, validateCredential(amazon.Token, amazon.TokenFrom, false, path.Child("token"), path.Child("tokenFrom"))...)
+
+	if amazon.Timeout != "" {
+		if _, err := time.ParseDuration(amazon.Timeout); err != nil {
+			errs = append(errs, field.Invalid(path.Child("timeout"), amazon.Timeout, "must be a duration, for example 5m"))
+		}
+	}
+
+	return errs
+}
+
+func validateGoogleStorage(google *GoogleStorageOptions, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if google.Bucket == "" {
+		errs = append(errs, field.Required(path.Child("bucket"), ""))
+	}
+	if google.CredentialSecret == "" {
+		errs = append(errs, field.Required(path.Child("credentialSecret"), ""))
+	}
+
+	return errs
+}
+
+func validateMicrosoftStorage(microsoft *MicrosoftStorageOptions, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if microsoft.Container == "" {
+		errs = append(errs, field.Required(path.Child("container"), ""))
+	}
+
+	errs = append(errs, validateCredential(microsoft.ID, microsoft.IDFrom, true, path.Child("id"), path.Child("idFrom"))...)
+	errs = append(errs, validateCredential(microsoft.Secret, microsoft.SecretFrom, true, path.Child("secret"), path.Child("secretFrom"))...)
+
+	return errs
+}
+
+func validateMinioStorage(minio *MinioStorageOptions, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if minio.Bucket == "" {
+		errs = append(errs, field.Required(path.Child("bucket"), ""))
+	}
+	if minio.Endpoint == "" {
+		errs = append(errs, field.Required(path.Child("endpoint"), ""))
+	}
+
+	errs = append(errs, validateCredential(minio.ID, minio.IDFrom, true, path.Child("id"), path.Child("idFrom"))...)
+	errs = append(errs, validateCredential(minio.Secret, minio.SecretFrom, true, path.Child("secret"), path.Child("secretFrom"))...)
+
+	return errs
+}
+
+// validateCredential checks a credential is set either inline
+// or using a secret reference, and not using both
+func validateCredential(value string, ref *corev1.SecretKeySelector, required bool, path, refPath *field.Path) field.ErrorList {
+	errs := validateSecretKeyRef(ref, refPath)
+	errs = append(errs, validateExclusive(value != "", ref, path)...)
+
+	if required && value == "" && ref == nil {
+		errs = append(errs, field.Required(refPath, fmt.Sprintf("%s or %s must be set", path.String(), refPath.String())))
+	}
+
+	return errs
+}
+
+// validateExclusive checks an inline credential and
+// its secret reference are not set at the same time
+func validateExclusive(inline bool, ref *corev1.SecretKeySelector, path *field.Path) field.ErrorList {
+	if inline && ref != nil {
+		return field.ErrorList{
+			field.Forbidden(path, fmt.Sprintf("must not be set together with %sFrom", path.String())),
+		}
+	}
+	return nil
+}
+
+// validateSecretKeyRef checks a secret reference names a secret key
+func validateSecretKeyRef(ref *corev1.SecretKeySelector, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if ref == nil {
+		return errs
+	}
+
+	if ref.Name == "" {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	}
+	if ref.Key == "" {
+		errs = append(errs, field.Required(path.Child("key"), ""))
+	}
+
+	return errs
+}
+
+// validateQuantity checks a size is a valid resource quantity
+func validateQuantity(value string, path *field.Path) field.ErrorList {
+	if value == "" {
+		return nil
+	}
+
+	if _, err := resource.ParseQuantity(value); err != nil {
+		return field.ErrorList{
+			field.Invalid(path, value, "must be a quantity, for example 100Gi"),
+		}
+	}
+
+	return nil
+}
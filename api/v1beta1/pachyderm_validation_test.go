@@ -0,0 +1,374 @@
+package v1beta1
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// testPachyderm returns a valid pachyderm resource using minio storage
+func testPachyderm() *Pachyderm {
+	return &Pachyderm{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pachyderm",
+			Namespace: "default",
+		},
+		Spec: PachydermSpec{
+			Version: "2.0.0",
+			Pachd: PachdOptions{
+				Storage: ObjectStorageOptions{
+					Backend: "minio",
+					Minio: &MinioStorageOptions{
+						Bucket:   "pachyderm",
+						Endpoint: "minio.default.svc:9000",
+						ID:       "id",
+						Secret:   "secret",
+					},
+				},
+			},
+			Etcd: EtcdOptions{
+				StorageSize: "10Gi",
+			},
+		},
+	}
+}
+
+var _ = Describe("validate", func() {
+	table.DescribeTable("pachyderm specs",
+		func(update func(*Pachyderm), fields ...string) {
+			pd := testPachyderm()
+			update(pd)
+
+			errs := pd.validate()
+			paths := []string{}
+			for _, err := range errs {
+				paths = append(paths, err.Field)
+			}
+			Expect(paths).To(ConsistOf(fields))
+		},
+		table.Entry("accepts a complete minio backend",
+			func(pd *Pachyderm) {}),
+		table.Entry("accepts the local backend without its block",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage = ObjectStorageOptions{Backend: "local"}
+			}),
+		table.Entry("rejects an unsupported backend",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage = ObjectStorageOptions{Backend: "ceph"}
+			}, "spec.pachd.storage.backend"),
+		table.Entry("requires the block of the backend",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage = ObjectStorageOptions{Backend: "amazon"}
+			}, "spec.pachd.storage.amazon"),
+		table.Entry("rejects the blocks of other backends",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage.Google = &GoogleStorageOptions{Bucket: "pachyderm", CredentialSecret: "gcs"}
+			}, "spec.pachd.storage.google"),
+		table.Entry("requires the bucket and endpoint",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage.Minio.Bucket = ""
+				pd.Spec.Pachd.Storage.Minio.Endpoint = ""
+			}, "spec.pachd.storage.minio.bucket", "spec.pachd.storage.minio.endpoint"),
+		table.Entry("requires the credentials",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage.Minio.ID = ""
+			}, "spec.pachd.storage.minio.idFrom"),
+		table.Entry("rejects inline credentials set with a secret reference",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage.Minio.SecretFrom = &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "minio"},
+					Key:                  "secret",
+				}
+			}, "spec.pachd.storage.minio.secret"),
+		table.Entry("requires the name and key of secret references",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage.Minio.ID = ""
+				pd.Spec.Pachd.Storage.Minio.IDFrom = &corev1.SecretKeySelector{}
+			}, "spec.pachd.storage.minio.idFrom.name", "spec.pachd.storage.minio.idFrom.key"),
+		table.Entry("accepts amazon without credentials when an IAM role is assumed",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage = ObjectStorageOptions{
+					Backend: "amazon",
+					Amazon:  &AmazonStorageOptions{Bucket: "pachyderm", Region: "us-east-1", IAMRole: "pachyderm"},
+				}
+			}),
+		table.Entry("rejects an amazon timeout that is not a duration",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage = ObjectStorageOptions{
+					Backend: "amazon",
+					Amazon:  &AmazonStorageOptions{Bucket: "pachyderm", Region: "us-east-1", IAMRole: "pachyderm", Timeout: "5 minutes"},
+				}
+			}, "spec.pachd.storage.amazon.timeout"),
+		table.Entry("rejects sizes that are not quantities",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.BlockCacheBytes = "1 GB"
+				pd.Spec.Etcd.StorageSize = "ten gigabytes"
+			}, "spec.pachd.blockCacheBytes", "spec.etcd.storageSize"),
+		table.Entry("rejects a postgresql password set with a secret reference",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Postgres.Password = "secret"
+				pd.Spec.Pachd.Postgres.PasswordFrom = &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "postgres"},
+					Key:                  "password",
+				}
+			}, "spec.pachd.postgresql.password"),
+		table.Entry("rejects a progress deadline of zero",
+			func(pd *Pachyderm) {
+				pd.Spec.Upgrade = &UpgradeOptions{ProgressDeadline: &metav1.Duration{}}
+			}, "spec.upgrade.progressDeadline"),
+	)
+})
+
+var _ = Describe("validateVersion", func() {
+	path := field.NewPath("spec", "version")
+
+	It("accepts versions in the catalog", func() {
+		Expect(validateVersion("2.0.0", path)).To(BeEmpty())
+		Expect(validateVersion("v2.0.0", path)).To(BeEmpty())
+	})
+
+	It("leaves the version to the mutating webhook", func() {
+		Expect(validateVersion("", path)).To(BeEmpty())
+	})
+
+	It("rejects versions missing from the catalog", func() {
+		errs := validateVersion("1.9.0", path)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeNotSupported))
+	})
+})
+
+var _ = Describe("ValidateUpdate", func() {
+	// invalidPachyderm returns a resource created before the
+	// version was removed from the catalog and the backend
+	// configuration was validated
+	invalidPachyderm := func() *Pachyderm {
+		pd := testPachyderm()
+		pd.Spec.Version = "1.9.0"
+		pd.Spec.Pachd.Storage.Minio.Endpoint = ""
+		return pd
+	}
+
+	It("allows metadata changes to resources with an invalid spec", func() {
+		old := invalidPachyderm()
+		pd := old.DeepCopy()
+		pd.Labels = map[string]string{"team": "ml"}
+		Expect(pd.ValidateUpdate(old)).To(Succeed())
+	})
+
+	It("allows removing the finalizer of a resource being deleted", func() {
+		old := invalidPachyderm()
+		now := metav1.Now()
+		old.DeletionTimestamp = &now
+		old.Finalizers = []string{"finalizer.pachyderm.com"}
+		pd := old.DeepCopy()
+		pd.Finalizers = nil
+		Expect(pd.ValidateUpdate(old)).To(Succeed())
+	})
+
+	It("validates the spec once it changes", func() {
+		old := invalidPachyderm()
+		pd := old.DeepCopy()
+		pd.Spec.Pachd.Storage.Minio.Endpoint = "minio.default.svc:9000"
+		Expect(pd.ValidateUpdate(old)).To(Succeed())
+
+		pd.Spec.Version = "1.9.1"
+		Expect(pd.ValidateUpdate(old)).NotTo(Succeed())
+	})
+
+	It("rejects changes to the naming of a resource with an unchanged spec", func() {
+		old := testPachyderm()
+		old.Annotations = map[string]string{NamingAnnotation: NamingLegacy}
+		pd := old.DeepCopy()
+		pd.Annotations[NamingAnnotation] = NamingInstance
+		Expect(pd.ValidateUpdate(old)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("validateUpdate", func() {
+	table.DescribeTable("unsafe updates",
+		func(update func(*Pachyderm), field string) {
+			old := testPachyderm()
+			pd := old.DeepCopy()
+			update(pd)
+
+			errs := pd.validateUpdate(old)
+			if field == "" {
+				Expect(errs).To(BeEmpty())
+				return
+			}
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal(field))
+			Expect(errs[0].Detail).To(ContainSubstring(AllowUnsafeUpdateAnnotation))
+
+			// deliberate migrations are allowed by annotation
+			pd.Annotations = map[string]string{AllowUnsafeUpdateAnnotation: "true"}
+			Expect(pd.ValidateUpdate(old)).To(Succeed())
+		},
+		table.Entry("changes the storage backend",
+			func(pd *Pachyderm) {
+				pd.Spec.Pachd.Storage = ObjectStorageOptions{
+					Backend: "google",
+					Google:  &GoogleStorageOptions{Bucket: "pachyderm", CredentialSecret: "gcs"},
+				}
+			}, "spec.pachd.storage.backend"),
+		table.Entry("changes the bucket",
+			func(pd *Pachyderm) { pd.Spec.Pachd.Storage.Minio.Bucket = "other" }, "spec.pachd.storage.minio.bucket"),
+		table.Entry("changes the etcd storage class",
+			func(pd *Pachyderm) { pd.Spec.Etcd.StorageClass = "fast" }, "spec.etcd.storageClass"),
+		table.Entry("upgrades pachyderm",
+			func(pd *Pachyderm) { pd.Spec.Version = "2.1.0" }, ""),
+		table.Entry("changes the minio endpoint",
+			func(pd *Pachyderm) { pd.Spec.Pachd.Storage.Minio.Endpoint = "minio.storage.svc:9000" }, ""),
+		table.Entry("changes the pachd log level",
+			func(pd *Pachyderm) { pd.Spec.Pachd.LogLevel = "debug" }, ""),
+	)
+
+	It("rejects downgrades unless the override annotation is set", func() {
+		old := testPachyderm()
+		old.Spec.Version = "2.1.0"
+		pd := old.DeepCopy()
+		pd.Spec.Version = "2.0.0"
+
+		errs := pd.validateUpdate(old)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Field).To(Equal("spec.version"))
+		Expect(pd.ValidateUpdate(old)).NotTo(Succeed())
+
+		pd.Annotations = map[string]string{AllowUnsafeUpdateAnnotation: "true"}
+		Expect(pd.ValidateUpdate(old)).To(Succeed())
+	})
+
+	It("allows setting the version back to cancel an upgrade", func() {
+		old := testPachyderm()
+		old.Spec.Version = "2.1.0"
+		old.Status.CurrentVersion = "v2.0.0"
+		pd := old.DeepCopy()
+		pd.Spec.Version = "2.0.0"
+
+		Expect(pd.validateUpdate(old)).To(BeEmpty())
+		Expect(pd.ValidateUpdate(old)).To(Succeed())
+
+		pd.Spec.Version = "1.13.3"
+		errs := pd.validateUpdate(old)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Field).To(Equal("spec.version"))
+	})
+
+	It("reports the value that can not be reduced", func() {
+		old := testPachyderm()
+		pd := old.DeepCopy()
+		pd.Spec.Etcd.StorageSize = "5Gi"
+
+		errs := pd.validateUpdate(old)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Detail).To(HavePrefix("can not be reduced from 10Gi"))
+	})
+
+	It("keeps the update rules without the override annotation", func() {
+		old := testPachyderm()
+		old.Annotations = map[string]string{AllowUnsafeUpdateAnnotation: "true"}
+		pd := old.DeepCopy()
+		pd.Annotations[AllowUnsafeUpdateAnnotation] = "false"
+		pd.Spec.Pachd.Storage.Minio.Bucket = "other"
+
+		Expect(pd.ValidateUpdate(old)).NotTo(Succeed())
+	})
+
+	table.DescribeTable("updates to the etcd cluster",
+		func(update func(*Pachyderm), field string) {
+			old := testPachyderm()
+			pd := old.DeepCopy()
+			update(pd)
+
+			errs := pd.validateUpdate(old)
+			if field == "" {
+				Expect(errs).To(BeEmpty())
+				return
+			}
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal(field))
+		},
+		table.Entry("keeps the default number of members",
+			func(pd *Pachyderm) { pd.Spec.Etcd.DynamicNodes = 1 }, ""),
+		table.Entry("adds etcd members",
+			func(pd *Pachyderm) { pd.Spec.Etcd.DynamicNodes = 3 }, "spec.etcd.dynamicNodes"),
+		table.Entry("grows the etcd volumes",
+			func(pd *Pachyderm) { pd.Spec.Etcd.StorageSize = "20Gi" }, "spec.etcd.storageSize"),
+		table.Entry("shrinks the etcd volumes",
+			func(pd *Pachyderm) { pd.Spec.Etcd.StorageSize = "5Gi" }, "spec.etcd.storageSize"),
+		table.Entry("sets the etcd volume size",
+			func(pd *Pachyderm) { pd.Spec.Etcd.StorageSize = "10240Mi" }, ""),
+	)
+
+	It("removes etcd members", func() {
+		old := testPachyderm()
+		old.Spec.Etcd.DynamicNodes = 3
+		pd := old.DeepCopy()
+		pd.Spec.Etcd.DynamicNodes = 0
+
+		errs := pd.validateUpdate(old)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Field).To(Equal("spec.etcd.dynamicNodes"))
+	})
+
+	It("keeps the naming of the generated objects", func() {
+		old := testPachyderm()
+		old.Annotations = map[string]string{NamingAnnotation: NamingLegacy}
+		pd := old.DeepCopy()
+		pd.Annotations[NamingAnnotation] = NamingInstance
+
+		errs := pd.validateUpdate(old)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Field).To(Equal("metadata.annotations[aiml.pachyderm.com/naming]"))
+		Expect(errs[0].Detail).NotTo(ContainSubstring(AllowUnsafeUpdateAnnotation))
+
+		// the override only applies to deliberate migrations
+		pd.Annotations[AllowUnsafeUpdateAnnotation] = "true"
+		Expect(pd.validateUpdate(old)).To(HaveLen(1))
+		Expect(pd.ValidateUpdate(old)).NotTo(Succeed())
+	})
+
+	It("only overrides the rules of deliberate migrations", func() {
+		old := testPachyderm()
+		old.Annotations = map[string]string{NamingAnnotation: NamingLegacy}
+		pd := old.DeepCopy()
+		pd.Annotations[AllowUnsafeUpdateAnnotation] = "true"
+		pd.Annotations[NamingAnnotation] = NamingInstance
+		pd.Spec.Pachd.Storage.Minio.Bucket = "other"
+
+		errs := pd.validateUpdate(old)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Field).To(Equal("metadata.annotations[aiml.pachyderm.com/naming]"))
+	})
+})
+
+var _ = Describe("validatePachdRoute", func() {
+	table.DescribeTable("route terminations",
+		func(termination string, tlsEnabled bool, valid bool) {
+			pd := testPachyderm()
+			pd.Spec.Pachd.Ingress = &PachdIngressOptions{
+				Host: "pachd.example.com",
+				IngressOptions: IngressOptions{
+					Route: &RouteOptions{Termination: termination},
+				},
+			}
+			pd.Spec.Pachd.TLS = &PachdTLSOptions{Enabled: tlsEnabled}
+
+			errs := pd.validatePachdRoute(field.NewPath("spec", "pachd", "ingress", "route", "termination"))
+			if valid {
+				Expect(errs).To(BeEmpty())
+			} else {
+				Expect(errs).To(HaveLen(1))
+			}
+		},
+		table.Entry("edge without pachd TLS", "edge", false, true),
+		table.Entry("passthrough without pachd TLS", "passthrough", false, false),
+		table.Entry("reencrypt without pachd TLS", "reencrypt", false, false),
+		table.Entry("passthrough with pachd TLS", "passthrough", true, true),
+		table.Entry("reencrypt with pachd TLS", "reencrypt", true, true),
+	)
+})
@@ -17,28 +17,41 @@ limitations under the License.
 package v1beta1
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-
-	"sort"
+	"time"
 
 	"github.com/creasty/defaults"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
-	"golang.org/x/mod/semver"
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
 )
 
 // log is for logging in this package.
 var pachydermlog = logf.Log.WithName("pachyderm-resource")
 
+// validatePachydermPath is the path of the validating webhook
+const validatePachydermPath = "/validate-aiml-pachyderm-com-v1beta1-pachyderm"
+
 // SetupWebhookWithManager setups the webhook
 func (r *Pachyderm) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// the validating webhook is registered ahead of the builder,
+	// which skips the path, so its responses carry the warnings
+	mgr.GetWebhookServer().Register(validatePachydermPath, &webhook.Admission{
+		Handler: &pachydermValidator{handler: admission.ValidatingWebhookFor(r).Handler},
+	})
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -67,8 +80,7 @@ func (r *Pachyderm) Default() {
 	}
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-//+kubebuilder:webhook:path=/validate-aiml-pachyderm-com-v1beta1-pachyderm,mutating=false,failurePolicy=fail,sideEffects=None,groups=aiml.pachyderm.com,resources=pachyderms,verbs=create;update,versions=v1beta1,name=vpachyderm.kb.io,admissionReviewVersions={v1,v1beta1}
+//+kubebuilder:webhook:path=/validate-aiml-pachyderm-com-v1beta1-pachyderm,mutating=false,failurePolicy=fail,sideEffects=None,groups=aiml.pachyderm.com,resources=pachyderms,verbs=create;update;delete,versions=v1beta1,name=vpachyderm.kb.io,admissionReviewVersions={v1,v1beta1}
 
 var _ webhook.Validator = &Pachyderm{}
 
@@ -76,32 +88,197 @@ var _ webhook.Validator = &Pachyderm{}
 func (r *Pachyderm) ValidateCreate() error {
 	pachydermlog.Info("validate create", "name", r.Name)
 
-	if r.isUsingGCS() && r.Spec.Pachd.Storage.Google.CredentialSecret == "" {
-		return errors.New("spec.pachd.storage.google.credentialSecret can not be empty")
-	}
+	errs := validateVersion(r.Spec.Version, field.NewPath("spec", "version"))
+	errs = append(errs, r.validate()...)
 
-	return nil
+	return r.invalidError(errs)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Pachyderm) ValidateUpdate(old runtime.Object) error {
 	pachydermlog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	return nil
+	// the finalizer of a resource being deleted
+	// is removed even if its spec is no longer valid
+	if r.DeletionTimestamp != nil {
+		return nil
+	}
+
+	current, ok := old.(*Pachyderm)
+	if !ok {
+		return fmt.Errorf("expected a Pachyderm but got a %T", old)
+	}
+
+	// the spec is only validated when it changes, so metadata changes
+	// are not blocked by rules added after the resource was created
+	// or by versions removed from the version catalog
+	errs := field.ErrorList{}
+	if !equality.Semantic.DeepEqual(r.Spec, current.Spec) {
+		if r.Spec.Version != current.Spec.Version {
+			errs = append(errs, validateVersion(r.Spec.Version, field.NewPath("spec", "version"))...)
+		}
+		errs = append(errs, r.validate()...)
+	}
+
+	errs = append(errs, r.validateUpdate(current)...)
+
+	return r.invalidError(errs)
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
 func (r *Pachyderm) ValidateDelete() error {
 	pachydermlog.Info("validate delete", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object deletion.
+	if r.Spec.DeletionProtection {
+		return apierrors.NewForbidden(GroupVersion.WithResource("pachyderms").GroupResource(), r.Name,
+			errors.New("deletion protection is enabled, set spec.deletionProtection to false to delete the resource"))
+	}
+
 	return nil
 }
 
-// returns true if Pachd storage is using Google Container storage
-func (r *Pachyderm) isUsingGCS() bool {
-	return r.Spec.Pachd.Storage.Google != nil && r.Spec.Pachd.Storage.Backend == "google"
+// RetainsData returns true if the data volumes and the
+// storage secret are kept when the resource is deleted
+func (r *Pachyderm) RetainsData() bool {
+	return r.Spec.DeletionPolicy != DeletionPolicyDelete
+}
+
+// UpgradeProgressDeadline returns the time an upgrade can
+// take to make progress before it is considered failed
+func (r *Pachyderm) UpgradeProgressDeadline() time.Duration {
+	if r.Spec.Upgrade != nil && r.Spec.Upgrade.ProgressDeadline != nil {
+		return r.Spec.Upgrade.ProgressDeadline.Duration
+	}
+	return DefaultUpgradeProgressDeadline
+}
+
+// RollbackEnabled returns true if the workloads are rolled
+// back to the last known good version after a failed upgrade
+func (r *Pachyderm) RollbackEnabled() bool {
+	return r.Spec.Upgrade == nil || !r.Spec.Upgrade.DisableRollback
+}
+
+// DeprecatedFields returns the paths of deprecated fields
+// holding plaintext credentials in the pachyderm resource
+func (r *Pachyderm) DeprecatedFields() []string {
+	fields := []string{}
+	storage := r.Spec.Pachd.Storage
+
+	if storage.Amazon != nil {
+		if storage.Amazon.ID != "" {
+			fields = append(fields, "spec.pachd.storage.amazon.id")
+		}
+		if storage.Amazon.Secret != "" {
+			fields = append(fields, "spec.pachd.storage.amazon.secret")
+		}
+		if storage.Amazon.Token != "" {
+			fields = append(fields, "spec.pachd.storage.amazon.token")
+		}
+	}
+
+	if storage.Minio != nil {
+		if storage.Minio.ID != "" {
+			fields = append(fields, "spec.pachd.storage.minio.id")
+		}
+		if storage.Minio.Secret != "" {
+			fields = append(fields, "spec.pachd.storage.minio.secret")
+		}
+	}
+
+	if storage.Microsoft != nil {
+		if storage.Microsoft.ID != "" {
+			fields = append(fields, "spec.pachd.storage.microsoft.id")
+		}
+		if storage.Microsoft.Secret != "" {
+			fields = append(fields, "spec.pachd.storage.microsoft.secret")
+		}
+	}
+
+	if r.Spec.Pachd.Postgres.Password != "" {
+		fields = append(fields, "spec.pachd.postgresql.password")
+	}
+
+	return fields
+}
+
+// ReferencedSecrets returns the names of the user provided
+// secrets referenced by the pachyderm resource
+func (r *Pachyderm) ReferencedSecrets() []string {
+	storage := r.Spec.Pachd.Storage
+	refs := []*corev1.SecretKeySelector{
+		r.Spec.Pachd.Postgres.PasswordFrom,
+	}
+	names := []string{}
+
+	if storage.Google != nil && storage.Google.CredentialSecret != "" {
+		names = append(names, storage.Google.CredentialSecret)
+	}
+
+	if storage.Amazon != nil {
+		refs = append(refs, storage.Amazon.IDFrom, storage.Amazon.SecretFrom, storage.Amazon.TokenFrom)
+	}
+
+	if storage.Minio != nil {
+		refs = append(refs, storage.Minio.IDFrom, storage.Minio.SecretFrom)
+	}
+
+	if storage.Microsoft != nil {
+		refs = append(refs, storage.Microsoft.IDFrom, storage.Microsoft.SecretFrom)
+	}
+
+	for _, ref := range refs {
+		if ref != nil && ref.Name != "" {
+			names = append(names, ref.Name)
+		}
+	}
+
+	if r.Spec.Pachd.TLS != nil && r.Spec.Pachd.TLS.Enabled && r.Spec.Pachd.TLS.SecretName != "" {
+		names = append(names, r.Spec.Pachd.TLS.SecretName)
+	}
+
+	return names
+}
+
+// deprecationWarnings returns the admission warnings
+// for the deprecated fields set on the resource
+func (r *Pachyderm) deprecationWarnings() []string {
+	warnings := []string{}
+	for _, field := range r.DeprecatedFields() {
+		warnings = append(warnings,
+			fmt.Sprintf("%s is deprecated and will be removed, use the matching secret reference instead", field))
+	}
+	return warnings
+}
+
+// pachydermValidator wraps the validating webhook of the pachyderm
+// resource and returns the use of deprecated fields as warnings.
+// The controller also records a warning event on the resource.
+type pachydermValidator struct {
+	handler admission.Handler
+	decoder *admission.Decoder
+}
+
+// InjectDecoder injects the decoder into the validator and the wrapped handler
+func (v *pachydermValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	_, err := admission.InjectDecoderInto(d, v.handler)
+	return err
+}
+
+// Handle validates the request and adds the deprecation
+// warnings to the responses allowing a create or update
+func (v *pachydermValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	resp := v.handler.Handle(ctx, req)
+	if !resp.Allowed || req.Operation == admissionv1.Delete {
+		return resp
+	}
+
+	pd := &Pachyderm{}
+	if err := v.decoder.Decode(req, pd); err != nil {
+		return resp
+	}
+
+	return resp.WithWarnings(pd.deprecationWarnings()...)
 }
 
 func (r *Pachyderm) prepareLocalStorage() {
@@ -120,6 +297,11 @@ func (r *Pachyderm) prepareAmazonStorage() {
 			fmt.Println("err:", err.Error())
 		}
 
+		if r.Spec.Pachd.Storage.Amazon.Reverse == nil {
+			reverse := true
+			r.Spec.Pachd.Storage.Amazon.Reverse = &reverse
+		}
+
 		if r.Spec.Pachd.Storage.Amazon.CloudFrontDistribution != "" {
 			r.Spec.Pachd.Storage.Amazon.CloudFrontDistribution = encodeString(r.Spec.Pachd.Storage.Amazon.CloudFrontDistribution, false)
 		}
@@ -181,45 +363,22 @@ func encodeCount(input string) int {
 	return count
 }
 
-func isContainer() bool {
-	fs, err := os.Stat("/run/secrets/kubernetes.io/serviceaccount")
-	return (fs.IsDir() && err == nil)
-}
-
-func getVersions() ([]string, error) {
-	var versionsDir string = "/manifests"
-	if !isContainer() {
-		return []string{}, errors.New("not running in container")
+// versionCatalog lists the Pachyderm versions supported by the operator
+var versionCatalog catalog.Catalog = catalog.Embedded()
 
-	}
-
-	files, err := ioutil.ReadDir(versionsDir)
-	if err != nil {
-		fmt.Println("error:", err.Error())
-	}
-
-	versions := []string{}
-	for _, f := range files {
-		if f.IsDir() {
-			if version := fmt.Sprintf("v%s", f.Name()); semver.IsValid(version) {
-				versions = append(versions, version)
-			}
-		}
-	}
-
-	return versions, nil
+// SetVersionCatalog sets the catalog listing the
+// Pachyderm versions supported by the operator
+func SetVersionCatalog(c catalog.Catalog) {
+	versionCatalog = c
 }
 
 // getDefaultVersion returns the newest Pachyderm version based on semver version
 func getDefaultVersion() string {
-	versions, err := getVersions()
+	version, err := versionCatalog.DefaultVersion()
 	if err != nil {
+		pachydermlog.Error(err, "unable to determine the default pachyderm version")
 		return ""
 	}
 
-	sort.Slice(versions, func(i, j int) bool {
-		return (semver.Compare(versions[i], versions[j]) == -1)
-	})
-
-	return versions[len(versions)-1]
+	return version
 }
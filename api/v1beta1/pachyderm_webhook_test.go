@@ -0,0 +1,112 @@
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("pachydermValidator", func() {
+	var validator *pachydermValidator
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(AddToScheme(scheme)).To(Succeed())
+		decoder, err := admission.NewDecoder(scheme)
+		Expect(err).NotTo(HaveOccurred())
+
+		validator = &pachydermValidator{handler: admission.ValidatingWebhookFor(&Pachyderm{}).Handler}
+		Expect(validator.InjectDecoder(decoder)).To(Succeed())
+	})
+
+	request := func(pd *Pachyderm) admission.Request {
+		pd.APIVersion = GroupVersion.String()
+		pd.Kind = "Pachyderm"
+		raw, err := json.Marshal(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := admission.Request{}
+		req.Operation = admissionv1.Create
+		req.Object = runtime.RawExtension{Raw: raw}
+		return req
+	}
+
+	It("warns about deprecated fields", func() {
+		resp := validator.Handle(context.Background(), request(testPachyderm()))
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Warnings).To(HaveLen(2))
+		Expect(resp.Warnings[0]).To(HavePrefix("spec.pachd.storage.minio.id is deprecated"))
+	})
+
+	It("does not warn about secret references", func() {
+		pd := testPachyderm()
+		pd.Spec.Pachd.Storage.Minio.ID = ""
+		pd.Spec.Pachd.Storage.Minio.IDFrom = &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "minio"},
+			Key:                  "id",
+		}
+		pd.Spec.Pachd.Storage.Minio.Secret = ""
+		pd.Spec.Pachd.Storage.Minio.SecretFrom = &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "minio"},
+			Key:                  "secret",
+		}
+		resp := validator.Handle(context.Background(), request(pd))
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Warnings).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ReferencedSecrets", func() {
+	// secretRef returns a reference to a key of the named secret
+	secretRef := func(name string) *corev1.SecretKeySelector {
+		return &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			Key:                  "key",
+		}
+	}
+
+	It("lists the secrets referenced by the storage and database credentials", func() {
+		pd := testPachyderm()
+		pd.Spec.Pachd.Storage.Minio.IDFrom = secretRef("minio-id")
+		pd.Spec.Pachd.Storage.Minio.SecretFrom = secretRef("minio-secret")
+		pd.Spec.Pachd.Postgres.PasswordFrom = secretRef("postgres")
+		Expect(pd.ReferencedSecrets()).To(ConsistOf("minio-id", "minio-secret", "postgres"))
+	})
+
+	It("lists the google credential secret", func() {
+		pd := testPachyderm()
+		pd.Spec.Pachd.Storage = ObjectStorageOptions{
+			Backend: "google",
+			Google:  &GoogleStorageOptions{Bucket: "pachyderm", CredentialSecret: "google"},
+		}
+		Expect(pd.ReferencedSecrets()).To(ConsistOf("google"))
+	})
+
+	It("ignores inline credentials", func() {
+		Expect(testPachyderm().ReferencedSecrets()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ValidateDelete", func() {
+	It("rejects deleting a protected resource", func() {
+		pd := testPachyderm()
+		Expect(pd.ValidateDelete()).To(Succeed())
+
+		pd.Spec.DeletionProtection = true
+		Expect(pd.ValidateDelete()).NotTo(Succeed())
+	})
+
+	It("retains the data unless the deletion policy is delete", func() {
+		pd := testPachyderm()
+		Expect(pd.RetainsData()).To(BeTrue())
+
+		pd.Spec.DeletionPolicy = DeletionPolicyDelete
+		Expect(pd.RetainsData()).To(BeFalse())
+	})
+})
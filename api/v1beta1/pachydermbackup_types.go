@@ -0,0 +1,122 @@
+/*
+Copyright 2021 Pachyderm.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PachydermBackupSpec defines the desired state of PachydermBackup
+type PachydermBackupSpec struct {
+	// Name of the Pachyderm resource to back up.
+	// It must be in the same namespace as the backup
+	// +kubebuilder:validation:MinLength:=1
+	Pachyderm string `json:"pachyderm"`
+	// Object storage the backup is uploaded to.
+	// Defaults to the storage backend of the Pachyderm resource,
+	// under the pachyderm-operator/ directory of the pachd bucket.
+	// Only the amazon and minio backends are supported
+	Storage *ObjectStorageOptions `json:"storage,omitempty"`
+	// Path in the bucket the backup artifacts are uploaded under.
+	// Defaults to pachyderm-operator/backups/<namespace>/<name>.
+	// When the backup is uploaded to the pachd bucket, the prefix
+	// must not be used by pachd
+	Prefix string `json:"prefix,omitempty"`
+	// Names of the postgresql databases to dump
+	// +kubebuilder:default:={pgc,dex}
+	Databases []string `json:"databases,omitempty"`
+	// Optional image overrides.
+	// Used to specify an alternative image of the
+	// minio client uploading the backup artifacts
+	Image *ImageOverride `json:"image,omitempty"`
+}
+
+// BackupPhase defines the data type used
+// to report the status of a PachydermBackup resource
+type BackupPhase string
+
+const (
+	// BackupPhasePending reports the backup is waiting
+	// for the Pachyderm resource to be running
+	BackupPhasePending BackupPhase = "Pending"
+	// BackupPhaseRunning reports the backup job is running
+	BackupPhaseRunning BackupPhase = "Running"
+	// BackupPhaseCompleted reports all backup artifacts were uploaded
+	BackupPhaseCompleted BackupPhase = "Completed"
+	// BackupPhaseFailed reports the backup could not be taken
+	BackupPhaseFailed BackupPhase = "Failed"
+)
+
+// ConditionBackupComplete is true once the artifacts of a backup
+// are uploaded, and reports why the backup is not complete otherwise
+const ConditionBackupComplete string = "Complete"
+
+// BackupArtifact describes a file uploaded by a backup
+type BackupArtifact struct {
+	// Name of the artifact, such as etcd.snapshot or pgc.dump
+	Name string `json:"name"`
+	// Location of the artifact in the object storage,
+	// as s3://<bucket>/<prefix>/<name>
+	Location string `json:"location"`
+	// Size of the artifact in bytes
+	Size int64 `json:"size"`
+}
+
+// PachydermBackupStatus defines the observed state of PachydermBackup
+type PachydermBackupStatus struct {
+	Phase BackupPhase `json:"phase,omitempty"`
+	// Version of Pachyderm running when the backup was taken
+	Version string `json:"version,omitempty"`
+	// Name of the job taking the backup
+	JobName string `json:"jobName,omitempty"`
+	// Time at which the backup job was created
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// Time at which the backup was completed or failed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Files uploaded to the object storage
+	Artifacts []BackupArtifact `json:"artifacts,omitempty"`
+	// Conditions report the progress of the backup
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// PachydermBackup is the Schema for the pachydermbackups API
+type PachydermBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PachydermBackupSpec   `json:"spec,omitempty"`
+	Status PachydermBackupStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PachydermBackupList contains a list of PachydermBackup
+type PachydermBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PachydermBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PachydermBackup{}, &PachydermBackupList{})
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 Pachyderm.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PachydermRestoreSpec defines the desired state of PachydermRestore
+type PachydermRestoreSpec struct {
+	// Name of the completed PachydermBackup to restore.
+	// It must be in the same namespace as the restore
+	// +kubebuilder:validation:MinLength:=1
+	Backup string `json:"backup"`
+	// Name of the Pachyderm resource the backup is restored into.
+	// It can be the Pachyderm resource the backup was taken from,
+	// or a new Pachyderm resource in the same namespace
+	// +kubebuilder:validation:MinLength:=1
+	Pachyderm string `json:"pachyderm"`
+	// Confirms the data of a Pachyderm resource that has already
+	// been running can be replaced by the backup. The restore
+	// waits for this field to be set before scaling it down
+	AllowOverwrite bool `json:"allowOverwrite,omitempty"`
+	// Optional image overrides.
+	// Used to specify an alternative image of the
+	// minio client downloading the backup artifacts
+	Image *ImageOverride `json:"image,omitempty"`
+}
+
+// RestorePhase defines the data type used
+// to report the status of a PachydermRestore resource
+type RestorePhase string
+
+const (
+	// RestorePhasePending reports the restore is waiting for the
+	// backup to complete, the Pachyderm resource to be created
+	// or the overwrite of a running Pachyderm to be allowed
+	RestorePhasePending RestorePhase = "Pending"
+	// RestorePhaseScalingDown reports the pachd, dash and etcd
+	// workloads of the Pachyderm resource are being scaled down
+	RestorePhaseScalingDown RestorePhase = "ScalingDown"
+	// RestorePhaseRestoring reports the restore job is running
+	RestorePhaseRestoring RestorePhase = "Restoring"
+	// RestorePhaseScalingUp reports the workloads are scaled
+	// back up and the restore waits for them to be healthy
+	RestorePhaseScalingUp RestorePhase = "ScalingUp"
+	// RestorePhaseCompleted reports the Pachyderm
+	// resource is healthy after the restore
+	RestorePhaseCompleted RestorePhase = "Completed"
+	// RestorePhaseFailed reports the restore could not be completed
+	RestorePhaseFailed RestorePhase = "Failed"
+)
+
+// Conditions reported by PachydermRestore resources
+const (
+	// ConditionRestoreComplete is true once the Pachyderm resource
+	// is healthy after the restore, and reports why the restore
+	// is not complete otherwise
+	ConditionRestoreComplete string = "Complete"
+	// ConditionRestoreScaledDown is true while the workloads
+	// of the Pachyderm resource are held scaled down
+	ConditionRestoreScaledDown string = "ScaledDown"
+	// ConditionRestoreDataRestored is true once etcd and the
+	// postgresql databases are restored from the backup
+	ConditionRestoreDataRestored string = "DataRestored"
+)
+
+// PachydermRestoreStatus defines the observed state of PachydermRestore
+type PachydermRestoreStatus struct {
+	Phase RestorePhase `json:"phase,omitempty"`
+	// Version of Pachyderm the restored backup was taken from
+	Version string `json:"version,omitempty"`
+	// Name of the job restoring the backup
+	JobName string `json:"jobName,omitempty"`
+	// Time at which the workloads were scaled down
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// Time at which the restore was completed or failed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Conditions report the progress of the restore
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// PachydermRestore is the Schema for the pachydermrestores API
+type PachydermRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PachydermRestoreSpec   `json:"spec,omitempty"`
+	Status PachydermRestoreStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PachydermRestoreList contains a list of PachydermRestore
+type PachydermRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PachydermRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PachydermRestore{}, &PachydermRestoreList{})
+}
@@ -21,6 +21,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -47,6 +48,18 @@ var testEnv *envtest.Environment
 var ctx context.Context
 var cancel context.CancelFunc
 
+// envtestAvailable returns true if the control plane binaries
+// envtest starts are installed, or an existing cluster is used.
+// The specs do not use the API server, so they still run
+// without it when the binaries are missing.
+func envtestAvailable() bool {
+	if os.Getenv("USE_EXISTING_CLUSTER") == "true" || os.Getenv("KUBEBUILDER_ASSETS") != "" {
+		return true
+	}
+	_, err := os.Stat("/usr/local/kubebuilder/bin/kube-apiserver")
+	return err == nil
+}
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -58,6 +71,11 @@ func TestAPIs(t *testing.T) {
 var _ = BeforeSuite(func() {
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
+	if !envtestAvailable() {
+		By("skipping the test environment, the envtest binaries are not installed")
+		return
+	}
+
 	ctx, cancel = context.WithCancel(context.TODO())
 
 	By("bootstrapping test environment")
@@ -125,6 +143,10 @@ var _ = BeforeSuite(func() {
 }, 60)
 
 var _ = AfterSuite(func() {
+	if testEnv == nil {
+		return
+	}
+
 	cancel()
 	By("tearing down the test environment")
 	err := testEnv.Stop()
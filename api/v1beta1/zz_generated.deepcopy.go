@@ -21,18 +21,34 @@ limitations under the License.
 package v1beta1
 
 import (
-	"k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AmazonStorageOptions) DeepCopyInto(out *AmazonStorageOptions) {
 	*out = *in
+	if in.IDFrom != nil {
+		in, out := &in.IDFrom, &out.IDFrom
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Reverse != nil {
 		in, out := &in.Reverse, &out.Reverse
 		*out = new(bool)
 		**out = **in
 	}
+	if in.SecretFrom != nil {
+		in, out := &in.SecretFrom, &out.SecretFrom
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TokenFrom != nil {
+		in, out := &in.TokenFrom, &out.TokenFrom
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Vault != nil {
 		in, out := &in.Vault, &out.Vault
 		*out = new(AmazonStorageVault)
@@ -65,6 +81,62 @@ func (in *AmazonStorageVault) DeepCopy() *AmazonStorageVault {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupArtifact) DeepCopyInto(out *BackupArtifact) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupArtifact.
+func (in *BackupArtifact) DeepCopy() *BackupArtifact {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupArtifact)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertManagerIssuerReference) DeepCopyInto(out *CertManagerIssuerReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertManagerIssuerReference.
+func (in *CertManagerIssuerReference) DeepCopy() *CertManagerIssuerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CertManagerIssuerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertManagerOptions) DeepCopyInto(out *CertManagerOptions) {
+	*out = *in
+	out.IssuerRef = in.IssuerRef
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertManagerOptions.
+func (in *CertManagerOptions) DeepCopy() *CertManagerOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(CertManagerOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DashOptions) DeepCopyInto(out *DashOptions) {
 	*out = *in
@@ -79,6 +151,16 @@ func (in *DashOptions) DeepCopyInto(out *DashOptions) {
 		*out = new(ServiceOverrides)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = new(IngressOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSCertificateOptions)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DashOptions.
@@ -101,7 +183,7 @@ func (in *EtcdOptions) DeepCopyInto(out *EtcdOptions) {
 	}
 	if in.Resources != nil {
 		in, out := &in.Resources, &out.Resources
-		*out = new(v1.ResourceRequirements)
+		*out = new(corev1.ResourceRequirements)
 		(*in).DeepCopyInto(*out)
 	}
 	if in.Service != nil {
@@ -151,6 +233,38 @@ func (in *ImageOverride) DeepCopy() *ImageOverride {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressOptions) DeepCopyInto(out *IngressOptions) {
+	*out = *in
+	if in.ClassName != nil {
+		in, out := &in.ClassName, &out.ClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Route != nil {
+		in, out := &in.Route, &out.Route
+		*out = new(RouteOptions)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressOptions.
+func (in *IngressOptions) DeepCopy() *IngressOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LocalStorageOptions) DeepCopyInto(out *LocalStorageOptions) {
 	*out = *in
@@ -184,6 +298,16 @@ func (in *MetricsOptions) DeepCopy() *MetricsOptions {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MicrosoftStorageOptions) DeepCopyInto(out *MicrosoftStorageOptions) {
 	*out = *in
+	if in.IDFrom != nil {
+		in, out := &in.IDFrom, &out.IDFrom
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretFrom != nil {
+		in, out := &in.SecretFrom, &out.SecretFrom
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MicrosoftStorageOptions.
@@ -199,6 +323,16 @@ func (in *MicrosoftStorageOptions) DeepCopy() *MicrosoftStorageOptions {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MinioStorageOptions) DeepCopyInto(out *MinioStorageOptions) {
 	*out = *in
+	if in.IDFrom != nil {
+		in, out := &in.IDFrom, &out.IDFrom
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretFrom != nil {
+		in, out := &in.SecretFrom, &out.SecretFrom
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MinioStorageOptions.
@@ -227,12 +361,12 @@ func (in *ObjectStorageOptions) DeepCopyInto(out *ObjectStorageOptions) {
 	if in.Microsoft != nil {
 		in, out := &in.Microsoft, &out.Microsoft
 		*out = new(MicrosoftStorageOptions)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.Minio != nil {
 		in, out := &in.Minio, &out.Minio
 		*out = new(MinioStorageOptions)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.Local != nil {
 		in, out := &in.Local, &out.Local
@@ -251,6 +385,22 @@ func (in *ObjectStorageOptions) DeepCopy() *ObjectStorageOptions {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachdIngressOptions) DeepCopyInto(out *PachdIngressOptions) {
+	*out = *in
+	in.IngressOptions.DeepCopyInto(&out.IngressOptions)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachdIngressOptions.
+func (in *PachdIngressOptions) DeepCopy() *PachdIngressOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(PachdIngressOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PachdOptions) DeepCopyInto(out *PachdOptions) {
 	*out = *in
@@ -266,12 +416,22 @@ func (in *PachdOptions) DeepCopyInto(out *PachdOptions) {
 		*out = new(ServiceOverrides)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = new(PachdIngressOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(PachdTLSOptions)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Metrics != nil {
 		in, out := &in.Metrics, &out.Metrics
 		*out = new(MetricsOptions)
 		**out = **in
 	}
-	out.Postgres = in.Postgres
+	in.Postgres.DeepCopyInto(&out.Postgres)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachdOptions.
@@ -287,6 +447,11 @@ func (in *PachdOptions) DeepCopy() *PachdOptions {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PachdPostgresConfig) DeepCopyInto(out *PachdPostgresConfig) {
 	*out = *in
+	if in.PasswordFrom != nil {
+		in, out := &in.PasswordFrom, &out.PasswordFrom
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachdPostgresConfig.
@@ -299,13 +464,34 @@ func (in *PachdPostgresConfig) DeepCopy() *PachdPostgresConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachdTLSOptions) DeepCopyInto(out *PachdTLSOptions) {
+	*out = *in
+	in.TLSCertificateOptions.DeepCopyInto(&out.TLSCertificateOptions)
+	if in.AdditionalHosts != nil {
+		in, out := &in.AdditionalHosts, &out.AdditionalHosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachdTLSOptions.
+func (in *PachdTLSOptions) DeepCopy() *PachdTLSOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(PachdTLSOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Pachyderm) DeepCopyInto(out *Pachyderm) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Pachyderm.
@@ -326,6 +512,130 @@ func (in *Pachyderm) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachydermBackup) DeepCopyInto(out *PachydermBackup) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermBackup.
+func (in *PachydermBackup) DeepCopy() *PachydermBackup {
+	if in == nil {
+		return nil
+	}
+	out := new(PachydermBackup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PachydermBackup) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachydermBackupList) DeepCopyInto(out *PachydermBackupList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PachydermBackup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermBackupList.
+func (in *PachydermBackupList) DeepCopy() *PachydermBackupList {
+	if in == nil {
+		return nil
+	}
+	out := new(PachydermBackupList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PachydermBackupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachydermBackupSpec) DeepCopyInto(out *PachydermBackupSpec) {
+	*out = *in
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(ObjectStorageOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Databases != nil {
+		in, out := &in.Databases, &out.Databases
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(ImageOverride)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermBackupSpec.
+func (in *PachydermBackupSpec) DeepCopy() *PachydermBackupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PachydermBackupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachydermBackupStatus) DeepCopyInto(out *PachydermBackupStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Artifacts != nil {
+		in, out := &in.Artifacts, &out.Artifacts
+		*out = make([]BackupArtifact, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermBackupStatus.
+func (in *PachydermBackupStatus) DeepCopy() *PachydermBackupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PachydermBackupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PachydermList) DeepCopyInto(out *PachydermList) {
 	*out = *in
@@ -358,6 +668,115 @@ func (in *PachydermList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachydermRestore) DeepCopyInto(out *PachydermRestore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermRestore.
+func (in *PachydermRestore) DeepCopy() *PachydermRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(PachydermRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PachydermRestore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachydermRestoreList) DeepCopyInto(out *PachydermRestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PachydermRestore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermRestoreList.
+func (in *PachydermRestoreList) DeepCopy() *PachydermRestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(PachydermRestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PachydermRestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachydermRestoreSpec) DeepCopyInto(out *PachydermRestoreSpec) {
+	*out = *in
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(ImageOverride)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermRestoreSpec.
+func (in *PachydermRestoreSpec) DeepCopy() *PachydermRestoreSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PachydermRestoreSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PachydermRestoreStatus) DeepCopyInto(out *PachydermRestoreStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermRestoreStatus.
+func (in *PachydermRestoreStatus) DeepCopy() *PachydermRestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PachydermRestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PachydermSpec) DeepCopyInto(out *PachydermSpec) {
 	*out = *in
@@ -370,6 +789,11 @@ func (in *PachydermSpec) DeepCopyInto(out *PachydermSpec) {
 		(*in).DeepCopyInto(*out)
 	}
 	in.Postgres.DeepCopyInto(&out.Postgres)
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(UpgradeOptions)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermSpec.
@@ -385,6 +809,17 @@ func (in *PachydermSpec) DeepCopy() *PachydermSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PachydermStatus) DeepCopyInto(out *PachydermStatus) {
 	*out = *in
+	if in.LastErrorTime != nil {
+		in, out := &in.LastErrorTime, &out.LastErrorTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PachydermStatus.
@@ -414,6 +849,21 @@ func (in *PostgresOptions) DeepCopy() *PostgresOptions {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RouteOptions) DeepCopyInto(out *RouteOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteOptions.
+func (in *RouteOptions) DeepCopy() *RouteOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(RouteOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceOverrides) DeepCopyInto(out *ServiceOverrides) {
 	*out = *in
@@ -434,6 +884,46 @@ func (in *ServiceOverrides) DeepCopy() *ServiceOverrides {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSCertificateOptions) DeepCopyInto(out *TLSCertificateOptions) {
+	*out = *in
+	if in.CertManager != nil {
+		in, out := &in.CertManager, &out.CertManager
+		*out = new(CertManagerOptions)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSCertificateOptions.
+func (in *TLSCertificateOptions) DeepCopy() *TLSCertificateOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSCertificateOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeOptions) DeepCopyInto(out *UpgradeOptions) {
+	*out = *in
+	if in.ProgressDeadline != nil {
+		in, out := &in.ProgressDeadline, &out.ProgressDeadline
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeOptions.
+func (in *UpgradeOptions) DeepCopy() *UpgradeOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkerOptions) DeepCopyInto(out *WorkerOptions) {
 	*out = *in
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+// reconcileCertificateRequests creates or updates the cert-manager
+// certificates requested by the pachyderm resource, and deletes
+// certificates that are no longer requested
+func (r *PachydermReconciler) reconcileCertificateRequests(ctx context.Context, components *generators.PachydermComponents) error {
+	pd := components.Parent()
+	certs := components.Certificates()
+
+	if !r.EnableCertManager {
+		if len(certs) > 0 {
+			return fmt.Errorf("certificate %s requires cert-manager, which is not installed", certs[0].GetName())
+		}
+		return nil
+	}
+
+	desired := map[string]bool{}
+	for _, cert := range certs {
+		desired[cert.GetName()] = true
+
+		if err := controllerutil.SetControllerReference(pd, cert, r.Scheme); err != nil {
+			return err
+		}
+
+		if err := r.Create(ctx, cert); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return err
+			}
+
+			current := &unstructured.Unstructured{}
+			current.SetGroupVersionKind(generators.CertificateGVK)
+			if err := r.Get(ctx, client.ObjectKeyFromObject(cert), current); err != nil {
+				return err
+			}
+
+			patch := client.MergeFrom(current.DeepCopy())
+			if unstructuredChanged(current, cert) {
+				if err := r.Patch(ctx, current, patch); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(generators.CertificateGVK.GroupVersion().WithKind("CertificateList"))
+	if err := r.List(ctx, list,
+		client.InNamespace(pd.Namespace),
+		client.MatchingLabels{generators.InstanceLabel: pd.Name}); err != nil {
+		return err
+	}
+
+	for i := range list.Items {
+		cert := &list.Items[i]
+		if desired[cert.GetName()] || !metav1.IsControlledBy(cert, pd) {
+			continue
+		}
+
+		if err := r.Delete(ctx, cert); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isCertificateReady returns true if cert-manager
+// has issued the certificate and stored it in its secret
+func (r *PachydermReconciler) isCertificateReady(ctx context.Context, cert *unstructured.Unstructured) (bool, error) {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(generators.CertificateGVK)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(cert), current); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	conditions, _, err := unstructured.NestedSlice(current.Object, "status", "conditions")
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if condition["type"] == "Ready" {
+			return condition["status"] == string(metav1.ConditionTrue), nil
+		}
+	}
+
+	return false, nil
+}
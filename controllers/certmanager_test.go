@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("reconcileCertificateRequests", func() {
+	var (
+		ctx    context.Context
+		scheme *runtime.Scheme
+		pd     *aimlv1beta1.Pachyderm
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = newTestScheme()
+		// the certificates are read as unstructured objects,
+		// as the operator does not depend on the cert-manager types
+		scheme.AddKnownTypeWithName(generators.CertificateGVK, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(generators.CertificateGVK.GroupVersion().WithKind("CertificateList"), &unstructured.UnstructuredList{})
+
+		pd = newTestPachyderm()
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+		pd.Spec.Pachd.TLS = &aimlv1beta1.PachdTLSOptions{
+			Enabled: true,
+			TLSCertificateOptions: aimlv1beta1.TLSCertificateOptions{
+				CertManager: &aimlv1beta1.CertManagerOptions{
+					IssuerRef: aimlv1beta1.CertManagerIssuerReference{Name: "letsencrypt"},
+				},
+			},
+		}
+	})
+
+	reconciler := func(enabled bool, objs ...runtime.Object) *PachydermReconciler {
+		return &PachydermReconciler{
+			Client:            fake.NewFakeClientWithScheme(scheme, append([]runtime.Object{pd}, objs...)...),
+			Log:               ctrl.Log,
+			Scheme:            scheme,
+			Recorder:          record.NewFakeRecorder(10),
+			EnableCertManager: enabled,
+		}
+	}
+
+	// certificate returns the certificate stored for the given object
+	certificate := func(r *PachydermReconciler, cert *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(generators.CertificateGVK)
+		err := r.Get(ctx, client.ObjectKeyFromObject(cert), current)
+		return current, err
+	}
+
+	It("requires cert-manager to be installed", func() {
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		cert := components.PachdCertificate()
+
+		err = reconciler(false).reconcileCertificateRequests(ctx, components)
+		Expect(err).To(MatchError("certificate " + cert.GetName() + " requires cert-manager, which is not installed"))
+
+		pd.Spec.Pachd.TLS = nil
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler(false).reconcileCertificateRequests(ctx, components)).To(Succeed())
+	})
+
+	It("creates the certificates and deletes those no longer requested", func() {
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		cert := components.PachdCertificate()
+
+		r := reconciler(true)
+		Expect(r.reconcileCertificateRequests(ctx, components)).To(Succeed())
+		current, err := certificate(r, cert)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current.GetOwnerReferences()).To(HaveLen(1))
+		Expect(current.GetOwnerReferences()[0].Name).To(Equal(pd.Name))
+
+		// an updated issuer is patched into the certificate
+		pd.Spec.Pachd.TLS.CertManager.IssuerRef.Name = "vault"
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.reconcileCertificateRequests(ctx, components)).To(Succeed())
+		current, err = certificate(r, cert)
+		Expect(err).NotTo(HaveOccurred())
+		issuer, _, err := unstructured.NestedString(current.Object, "spec", "issuerRef", "name")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(issuer).To(Equal("vault"))
+
+		pd.Spec.Pachd.TLS.SecretName = "pachd-certificate"
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.reconcileCertificateRequests(ctx, components)).To(Succeed())
+		_, err = certificate(r, cert)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("reports the certificates issued by cert-manager as ready", func() {
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		cert := components.PachdCertificate()
+
+		ready, err := reconciler(true).isCertificateReady(ctx, cert)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ready).To(BeFalse())
+
+		for status, expected := range map[string]bool{"False": false, "True": true} {
+			issued := cert.DeepCopy()
+			Expect(unstructured.SetNestedSlice(issued.Object, []interface{}{
+				map[string]interface{}{"type": "Issuing", "status": "True"},
+				map[string]interface{}{"type": "Ready", "status": status},
+			}, "status", "conditions")).To(Succeed())
+
+			ready, err := reconciler(true, issued).isCertificateReady(ctx, cert)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(Equal(expected), "Ready condition %s", status)
+		}
+	})
+})
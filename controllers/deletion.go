@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+// applyDeletionPolicy keeps or deletes the data of a deleted
+// pachyderm resource according to its deletion policy.
+// Retained objects are released from the pachyderm resource,
+// so they are not garbage collected with it. The cluster scoped
+// objects are deleted with either policy, a binding left behind
+// would grant its permissions to a service account recreated
+// with the same name.
+func (r *PachydermReconciler) applyDeletionPolicy(ctx context.Context, components *generators.PachydermComponents) error {
+	pd := components.Parent()
+	instance := client.MatchingLabels{generators.InstanceLabel: pd.Name}
+
+	// cluster scoped objects can not have owner references
+	// to the pachyderm resource and are deleted by label
+	ownerLabels := client.MatchingLabels(generators.ClusterOwnerLabels(pd))
+	if err := r.DeleteAllOf(ctx, &rbacv1.ClusterRoleBinding{}, ownerLabels); err != nil {
+		return err
+	}
+	if err := r.DeleteAllOf(ctx, &rbacv1.ClusterRole{}, ownerLabels); err != nil {
+		return err
+	}
+
+	if !pd.RetainsData() {
+		// volume claims created from the statefulset
+		// templates are not garbage collected
+		return r.DeleteAllOf(ctx, &corev1.PersistentVolumeClaim{},
+			client.InNamespace(pd.Namespace), instance)
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcs, client.InNamespace(pd.Namespace), instance); err != nil {
+		return err
+	}
+
+	objects := []client.Object{}
+	for i := range pvcs.Items {
+		objects = append(objects, &pvcs.Items[i])
+	}
+
+	storageSecret := &corev1.Secret{}
+	storageSecretKey := types.NamespacedName{
+		Name:      components.StorageSecretName(),
+		Namespace: pd.Namespace,
+	}
+	if err := r.Get(ctx, storageSecretKey, storageSecret); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+	} else {
+		objects = append(objects, storageSecret)
+	}
+
+	for _, obj := range objects {
+		if err := r.releaseObject(ctx, pd, obj); err != nil {
+			return err
+		}
+	}
+
+	r.Recorder.Eventf(pd, corev1.EventTypeNormal, "DataRetained",
+		"deletion policy is %s, kept %d volume claims and secret %s",
+		aimlv1beta1.DeletionPolicyRetain, len(pvcs.Items), storageSecretKey.Name)
+
+	return nil
+}
+
+// releaseObject removes the owner reference to the
+// pachyderm resource, if any, from the object
+func (r *PachydermReconciler) releaseObject(ctx context.Context, pd *aimlv1beta1.Pachyderm, obj client.Object) error {
+	refs := []metav1.OwnerReference{}
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID != pd.UID {
+			refs = append(refs, ref)
+		}
+	}
+
+	if len(refs) == len(obj.GetOwnerReferences()) {
+		return nil
+	}
+
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	obj.SetOwnerReferences(refs)
+	if err := r.Patch(ctx, obj, patch); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("applyDeletionPolicy", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		pd         *aimlv1beta1.Pachyderm
+		components *generators.PachydermComponents
+		r          *PachydermReconciler
+		objects    []client.Object
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = newTestScheme()
+		pd = newTestPachyderm()
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+
+		var err error
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "etcd-storage-pachyderm-etcd-0",
+				Namespace: pd.Namespace,
+				Labels:    map[string]string{generators.InstanceLabel: pd.Name},
+			},
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: components.StorageSecretName(), Namespace: pd.Namespace},
+		}
+		for _, obj := range []client.Object{pvc, secret} {
+			Expect(controllerutil.SetControllerReference(pd, obj, scheme)).To(Succeed())
+		}
+
+		objects = []client.Object{pvc, secret}
+		for i := range components.ClusterRoles {
+			objects = append(objects, &components.ClusterRoles[i])
+		}
+		for i := range components.ClusterRoleBindings {
+			objects = append(objects, &components.ClusterRoleBindings[i])
+		}
+		Expect(components.ClusterRoleBindings).NotTo(BeEmpty())
+	})
+
+	reconciler := func() *PachydermReconciler {
+		objs := []runtime.Object{pd}
+		for _, obj := range objects {
+			objs = append(objs, obj)
+		}
+		return &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, objs...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	}
+
+	// exists returns true if the object was not deleted, and checks
+	// the object kept is no longer owned by the pachyderm resource
+	exists := func(obj client.Object) bool {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		Expect(err).NotTo(HaveOccurred())
+		live, err := scheme.New(gvk)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = r.Get(ctx, client.ObjectKeyFromObject(obj), live.(client.Object))
+		if errors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(live.(client.Object).GetOwnerReferences()).To(BeEmpty())
+		return true
+	}
+
+	It("releases the data and deletes the cluster roles of retained resources", func() {
+		r = reconciler()
+		Expect(r.applyDeletionPolicy(ctx, components)).To(Succeed())
+
+		for _, obj := range objects[:2] {
+			Expect(exists(obj)).To(BeTrue(), "%s should be kept", obj.GetName())
+		}
+		for _, obj := range objects[2:] {
+			Expect(exists(obj)).To(BeFalse(), "%s should be deleted", obj.GetName())
+		}
+	})
+
+	It("deletes the volume claims of deleted resources", func() {
+		pd.Spec.DeletionPolicy = aimlv1beta1.DeletionPolicyDelete
+		r = reconciler()
+		Expect(r.applyDeletionPolicy(ctx, components)).To(Succeed())
+
+		Expect(exists(objects[0])).To(BeFalse())
+		for _, obj := range objects[2:] {
+			Expect(exists(obj)).To(BeFalse(), "%s should be deleted", obj.GetName())
+		}
+	})
+
+	It("keeps the cluster roles of other instances", func() {
+		other := &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "other-pachyderm-pachyderm",
+				Labels: map[string]string{
+					generators.InstanceLabel:          pd.Name,
+					generators.InstanceNamespaceLabel: "other",
+				},
+			},
+		}
+		objects = append(objects, other)
+
+		r = reconciler()
+		Expect(r.applyDeletionPolicy(ctx, components)).To(Succeed())
+		Expect(exists(other)).To(BeTrue())
+	})
+})
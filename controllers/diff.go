@@ -1,12 +1,34 @@
 package controllers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/imdario/mergo"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
+// templateHashAnnotation records the hash of the pod template last
+// applied to a workload. The live template is defaulted by the API
+// server, so removing a field from the desired template can only be
+// detected by comparing it with the template previously applied.
+const templateHashAnnotation = "aiml.pachyderm.com/template-hash"
+
+// managedAnnotationsAnnotation lists the annotations last applied by
+// the operator. Annotations removed from the desired object are removed
+// from the live object, while annotations set by others, such as the
+// OpenShift router, are kept.
+const managedAnnotationsAnnotation = "aiml.pachyderm.com/managed-annotations"
+
 func serviceChanged(current, new *corev1.Service) bool {
 	tempSvc := *current
 
@@ -20,3 +42,185 @@ func serviceChanged(current, new *corev1.Service) bool {
 
 	return !reflect.DeepEqual(tempSvc, *current)
 }
+
+// deploymentChanged copies the fields managed by the operator from
+// the desired deployment into the current deployment and reports
+// whether the current deployment was modified.
+// Fields populated by the API server on the current deployment are
+// ignored when comparing the two deployments.
+func deploymentChanged(current, desired *appsv1.Deployment) bool {
+	changed := false
+
+	// the labels of the deployment are owned by the operator
+	if !equality.Semantic.DeepEqual(desired.Labels, current.Labels) {
+		current.Labels = desired.Labels
+		changed = true
+	}
+
+	if desired.Spec.Replicas != nil &&
+		!equality.Semantic.DeepEqual(desired.Spec.Replicas, current.Spec.Replicas) {
+		current.Spec.Replicas = desired.Spec.Replicas
+		changed = true
+	}
+
+	if templateHashBackfilled(&current.ObjectMeta, &current.Spec.Template, &desired.Spec.Template) ||
+		templateChanged(&current.ObjectMeta, &current.Spec.Template, &desired.Spec.Template) {
+		changed = true
+	}
+
+	return changed
+}
+
+// templateHashBackfilled records the hash of the desired pod template
+// on a workload deployed before the hash was recorded, when the
+// current template matches the desired template. Upgrading the
+// operator then does not roll out every workload. Reports whether
+// the hash was recorded.
+func templateHashBackfilled(current *metav1.ObjectMeta, currentTemplate, desired *corev1.PodTemplateSpec) bool {
+	if _, ok := current.Annotations[templateHashAnnotation]; ok ||
+		!equality.Semantic.DeepDerivative(*desired, *currentTemplate) {
+		return false
+	}
+
+	current.Annotations = mergeStringMaps(current.Annotations, map[string]string{
+		templateHashAnnotation: templateHash(desired),
+	})
+	return true
+}
+
+// templateChanged copies the desired pod template into the current
+// template and records its hash on the workload when the template
+// differs from the one last applied, or when a field set in the
+// desired template was changed on the live workload. Reports
+// whether the current template was modified.
+func templateChanged(current *metav1.ObjectMeta, currentTemplate, desired *corev1.PodTemplateSpec) bool {
+	hash := templateHash(desired)
+	if current.Annotations[templateHashAnnotation] == hash &&
+		equality.Semantic.DeepDerivative(*desired, *currentTemplate) {
+		return false
+	}
+
+	*currentTemplate = *desired.DeepCopy()
+	current.Annotations = mergeStringMaps(current.Annotations, map[string]string{
+		templateHashAnnotation: hash,
+	})
+	return true
+}
+
+// templateRestored copies a pod template saved from the live workload
+// into the current template when they differ. The saved template holds
+// the fields defaulted by the API server, so it is compared as is and
+// fields added to the current template since it was saved are removed.
+// Reports whether the current template was modified.
+func templateRestored(current *metav1.ObjectMeta, currentTemplate, saved *corev1.PodTemplateSpec) bool {
+	if equality.Semantic.DeepEqual(*saved, *currentTemplate) {
+		return false
+	}
+
+	*currentTemplate = *saved.DeepCopy()
+	current.Annotations = mergeStringMaps(current.Annotations, map[string]string{
+		templateHashAnnotation: templateHash(saved),
+	})
+	return true
+}
+
+// templateHash returns the sha256 hash of a pod template
+func templateHash(template *corev1.PodTemplateSpec) string {
+	// a pod template always encodes, maps are encoded in key order
+	data, _ := json.Marshal(template)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ingressChanged copies the fields managed by the operator from
+// the desired ingress into the current ingress and reports
+// whether the current ingress was modified.
+func ingressChanged(current, desired *networkingv1.Ingress) bool {
+	changed := false
+
+	// the labels of the ingress are owned by the operator
+	if !equality.Semantic.DeepEqual(desired.Labels, current.Labels) {
+		current.Labels = desired.Labels
+		changed = true
+	}
+
+	if annotations, ok := managedAnnotationsChanged(current.Annotations, desired.Annotations); ok {
+		current.Annotations = annotations
+		changed = true
+	}
+
+	if !equality.Semantic.DeepEqual(desired.Spec, current.Spec) {
+		current.Spec = desired.Spec
+		changed = true
+	}
+
+	return changed
+}
+
+// managedAnnotationsChanged returns the current annotations with the
+// desired annotations applied, and the annotations previously applied
+// by the operator that are no longer desired removed. Reports whether
+// the annotations differ from the current annotations.
+func managedAnnotationsChanged(current, desired map[string]string) (map[string]string, bool) {
+	applied := mergeStringMaps(current, desired)
+	for _, key := range strings.Split(current[managedAnnotationsAnnotation], ",") {
+		if _, ok := desired[key]; !ok {
+			delete(applied, key)
+		}
+	}
+
+	managed := make([]string, 0, len(desired))
+	for key := range desired {
+		managed = append(managed, key)
+	}
+	sort.Strings(managed)
+
+	delete(applied, managedAnnotationsAnnotation)
+	if len(managed) > 0 {
+		applied[managedAnnotationsAnnotation] = strings.Join(managed, ",")
+	}
+
+	if len(applied) == 0 && len(current) == 0 {
+		return current, false
+	}
+	return applied, !equality.Semantic.DeepEqual(applied, current)
+}
+
+// unstructuredChanged copies the fields managed by the operator
+// from a desired object without a typed client, such as an
+// OpenShift route, into the current object and reports
+// whether the current object was modified.
+func unstructuredChanged(current, desired *unstructured.Unstructured) bool {
+	changed := false
+
+	// the labels of the object are owned by the operator
+	if !equality.Semantic.DeepEqual(desired.GetLabels(), current.GetLabels()) {
+		current.SetLabels(desired.GetLabels())
+		changed = true
+	}
+
+	if annotations, ok := managedAnnotationsChanged(current.GetAnnotations(), desired.GetAnnotations()); ok {
+		current.SetAnnotations(annotations)
+		changed = true
+	}
+
+	if !equality.Semantic.DeepDerivative(desired.Object["spec"], current.Object["spec"]) {
+		current.Object["spec"] = desired.Object["spec"]
+		changed = true
+	}
+
+	return changed
+}
+
+// mergeStringMaps returns a copy of current with
+// the keys in desired added or overwritten
+func mergeStringMaps(current, desired map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(desired))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range desired {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+// testDeployment returns a deployment running a single pachd container
+func testDeployment(env ...corev1.EnvVar) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pachd",
+			Namespace: "default",
+			Labels: map[string]string{
+				"app": "pachd",
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "pachd",
+							Image: "pachyderm/pachd:2.0.0",
+							Env:   env,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+var _ = Describe("deploymentChanged", func() {
+	var current *appsv1.Deployment
+
+	BeforeEach(func() {
+		current = testDeployment(corev1.EnvVar{Name: "STORAGE_BACKEND", Value: "MINIO"})
+		Expect(deploymentChanged(current, current.DeepCopy())).To(BeTrue())
+
+		// fields defaulted by the API server
+		current.Spec.Template.Spec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+		current.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	})
+
+	It("ignores fields defaulted by the API server", func() {
+		desired := testDeployment(corev1.EnvVar{Name: "STORAGE_BACKEND", Value: "MINIO"})
+		Expect(deploymentChanged(current, desired)).To(BeFalse())
+	})
+
+	It("rolls out environment variables removed from the desired template", func() {
+		desired := testDeployment()
+		Expect(deploymentChanged(current, desired)).To(BeTrue())
+		Expect(current.Spec.Template.Spec.Containers[0].Env).To(BeEmpty())
+		Expect(deploymentChanged(current, desired)).To(BeFalse())
+	})
+
+	It("rolls out resource limits removed from the desired template", func() {
+		desired := testDeployment(corev1.EnvVar{Name: "STORAGE_BACKEND", Value: "MINIO"})
+		desired.Spec.Template.Spec.Containers[0].Resources.Limits = corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		}
+		Expect(deploymentChanged(current, desired)).To(BeTrue())
+
+		desired = testDeployment(corev1.EnvVar{Name: "STORAGE_BACKEND", Value: "MINIO"})
+		Expect(deploymentChanged(current, desired)).To(BeTrue())
+		Expect(current.Spec.Template.Spec.Containers[0].Resources.Limits).To(BeEmpty())
+	})
+
+	It("reverts changes made to the live template", func() {
+		current.Spec.Template.Spec.Containers[0].Image = "pachyderm/pachd:1.13.0"
+		desired := testDeployment(corev1.EnvVar{Name: "STORAGE_BACKEND", Value: "MINIO"})
+		Expect(deploymentChanged(current, desired)).To(BeTrue())
+		Expect(current.Spec.Template.Spec.Containers[0].Image).To(Equal("pachyderm/pachd:2.0.0"))
+	})
+
+	It("records the template hash of deployments without rolling them out", func() {
+		delete(current.Annotations, templateHashAnnotation)
+		template := current.Spec.Template.DeepCopy()
+
+		desired := testDeployment(corev1.EnvVar{Name: "STORAGE_BACKEND", Value: "MINIO"})
+		Expect(deploymentChanged(current, desired)).To(BeTrue())
+		Expect(current.Annotations).To(HaveKeyWithValue(templateHashAnnotation, templateHash(&desired.Spec.Template)))
+		Expect(current.Spec.Template).To(Equal(*template))
+		Expect(deploymentChanged(current, desired)).To(BeFalse())
+	})
+
+	It("rolls out deployments without a template hash that differ", func() {
+		delete(current.Annotations, templateHashAnnotation)
+		desired := testDeployment(corev1.EnvVar{Name: "STORAGE_BACKEND", Value: "AMAZON"})
+		Expect(deploymentChanged(current, desired)).To(BeTrue())
+		Expect(current.Spec.Template.Spec.Containers[0].Env[0].Value).To(Equal("AMAZON"))
+		Expect(current.Spec.Template.Spec.RestartPolicy).To(BeEmpty())
+	})
+
+	It("removes stale labels", func() {
+		current.Labels["stale"] = "true"
+		desired := testDeployment(corev1.EnvVar{Name: "STORAGE_BACKEND", Value: "MINIO"})
+		Expect(deploymentChanged(current, desired)).To(BeTrue())
+		Expect(current.Labels).To(Equal(map[string]string{"app": "pachd"}))
+	})
+})
+
+var _ = Describe("ingressChanged", func() {
+	// testIngress returns an ingress with the given annotations
+	testIngress := func(annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pachd",
+				Namespace:   "default",
+				Labels:      map[string]string{"app": "pachd"},
+				Annotations: annotations,
+			},
+		}
+	}
+
+	It("removes the annotations removed from the desired ingress", func() {
+		current := testIngress(nil)
+		Expect(ingressChanged(current, testIngress(map[string]string{
+			"nginx.ingress.kubernetes.io/ssl-redirect":     "true",
+			"nginx.ingress.kubernetes.io/backend-protocol": "GRPC",
+		}))).To(BeTrue())
+		current.Annotations["kubernetes.io/ingress.class"] = "nginx"
+		current.Labels["stale"] = "true"
+
+		desired := testIngress(map[string]string{"nginx.ingress.kubernetes.io/backend-protocol": "GRPC"})
+		Expect(ingressChanged(current, desired)).To(BeTrue())
+		Expect(current.Labels).To(Equal(map[string]string{"app": "pachd"}))
+		Expect(current.Annotations).To(Equal(map[string]string{
+			"nginx.ingress.kubernetes.io/backend-protocol": "GRPC",
+			"kubernetes.io/ingress.class":                  "nginx",
+			managedAnnotationsAnnotation:                   "nginx.ingress.kubernetes.io/backend-protocol",
+		}))
+		Expect(ingressChanged(current, desired)).To(BeFalse())
+
+		Expect(ingressChanged(current, testIngress(nil))).To(BeTrue())
+		Expect(current.Annotations).To(Equal(map[string]string{"kubernetes.io/ingress.class": "nginx"}))
+	})
+
+	It("ignores an ingress without annotations", func() {
+		current := testIngress(nil)
+		Expect(ingressChanged(current, testIngress(map[string]string{}))).To(BeFalse())
+	})
+})
+
+var _ = Describe("unstructuredChanged", func() {
+	// testRoute returns a route with the given annotations
+	testRoute := func(annotations map[string]string) *unstructured.Unstructured {
+		route := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"host": "pachd.example.com"},
+		}}
+		route.SetGroupVersionKind(generators.RouteGVK)
+		route.SetName("pachd")
+		route.SetLabels(map[string]string{"app": "pachd"})
+		route.SetAnnotations(annotations)
+		return route
+	}
+
+	It("keeps the annotations set by the router", func() {
+		current := testRoute(nil)
+		Expect(unstructuredChanged(current, testRoute(map[string]string{
+			"haproxy.router.openshift.io/timeout": "5m",
+		}))).To(BeTrue())
+		current.SetAnnotations(mergeStringMaps(current.GetAnnotations(), map[string]string{
+			"openshift.io/host.generated": "false",
+		}))
+
+		desired := testRoute(nil)
+		Expect(unstructuredChanged(current, desired)).To(BeTrue())
+		Expect(current.GetAnnotations()).To(Equal(map[string]string{"openshift.io/host.generated": "false"}))
+		Expect(unstructuredChanged(current, desired)).To(BeFalse())
+	})
+})
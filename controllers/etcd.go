@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+// etcdHealthTimeout is the maximum time to wait
+// for an etcd member to respond to a health check
+const etcdHealthTimeout = 5 * time.Second
+
+// updateEtcd applies changes to the mutable fields of the etcd statefulset.
+// Changes to the pod template are rolled out one ordinal at a time using
+// the rolling update partition, waiting for the etcd cluster to be healthy
+// before moving to the next ordinal.
+func (r *PachydermReconciler) updateEtcd(ctx context.Context, pd *aimlv1beta1.Pachyderm, desired *appsv1.StatefulSet) error {
+	return r.rolloutEtcd(ctx, pd, desired, templateChanged)
+}
+
+// rolloutEtcd rolls out the pod template of the desired etcd statefulset
+// when replaceTemplate reports the current template was replaced
+func (r *PachydermReconciler) rolloutEtcd(ctx context.Context, pd *aimlv1beta1.Pachyderm, desired *appsv1.StatefulSet,
+	replaceTemplate func(current *metav1.ObjectMeta, currentTemplate, desired *corev1.PodTemplateSpec) bool) error {
+	current := &appsv1.StatefulSet{}
+	stsKey := types.NamespacedName{
+		Name:      desired.Name,
+		Namespace: desired.Namespace,
+	}
+
+	if err := r.Get(ctx, stsKey, current); err != nil {
+		return err
+	}
+
+	// volume claim templates can not be changed after the statefulset is
+	// created, the webhook rejects such changes unless they are forced
+	if !equality.Semantic.DeepDerivative(desired.Spec.VolumeClaimTemplates, current.Spec.VolumeClaimTemplates) {
+		r.Log.Info("ignoring change to immutable field",
+			"statefulset", stsKey,
+			"field", "spec.volumeClaimTemplates")
+		r.Recorder.Eventf(pd, corev1.EventTypeWarning, "ImmutableFieldChanged",
+			"etcd storage can not be changed after creation, ignoring changes to statefulset %s volume claim templates", desired.Name)
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	changed := templateHashBackfilled(&current.ObjectMeta, &current.Spec.Template, &desired.Spec.Template)
+
+	// etcd is only scaled to and from zero while a restore pauses it.
+	// Members are not added to or removed from a running cluster,
+	// the webhook rejects such changes unless they are forced
+	switch replicas := statefulSetReplicas(desired); {
+	case replicas == statefulSetReplicas(current):
+	case replicas == 0 || statefulSetReplicas(current) == 0:
+		current.Spec.Replicas = desired.Spec.Replicas
+		changed = true
+	default:
+		r.Log.Info("ignoring change to etcd members",
+			"statefulset", stsKey,
+			"field", "spec.replicas")
+		r.Recorder.Eventf(pd, corev1.EventTypeWarning, "ImmutableFieldChanged",
+			"etcd members can not be added or removed after creation, ignoring changes to statefulset %s replicas", desired.Name)
+	}
+
+	if replaceTemplate(&current.ObjectMeta, &current.Spec.Template, &desired.Spec.Template) {
+		// hold back all pods, but the one with the highest ordinal
+		partition := statefulSetReplicas(current) - 1
+		current.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+			Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+				Partition: &partition,
+			},
+		}
+		changed = true
+	} else if partition := rollingUpdatePartition(current); partition > 0 {
+		// release the next ordinal once the cluster is healthy
+		if !statefulSetUpdated(current) || !r.isEtcdHealthy(ctx, current) {
+			return ErrEtcdNotReady
+		}
+		partition--
+		current.Spec.UpdateStrategy.RollingUpdate.Partition = &partition
+		changed = true
+	}
+
+	if changed {
+		if err := r.Patch(ctx, current, patch); err != nil {
+			return err
+		}
+	}
+
+	if rollingUpdatePartition(current) > 0 {
+		return ErrEtcdNotReady
+	}
+
+	return nil
+}
+
+// statefulSetReplicas returns the desired number of statefulset pods
+func statefulSetReplicas(sts *appsv1.StatefulSet) int32 {
+	if sts.Spec.Replicas == nil {
+		return 1
+	}
+	return *sts.Spec.Replicas
+}
+
+// rollingUpdatePartition returns the ordinal
+// at which the statefulset rollout is paused
+func rollingUpdatePartition(sts *appsv1.StatefulSet) int32 {
+	if sts.Spec.UpdateStrategy.RollingUpdate == nil ||
+		sts.Spec.UpdateStrategy.RollingUpdate.Partition == nil {
+		return 0
+	}
+	return *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+}
+
+// statefulSetUpdated returns true if all pods at or above
+// the partition are running the current revision and all pods are ready
+func statefulSetUpdated(sts *appsv1.StatefulSet) bool {
+	replicas := statefulSetReplicas(sts)
+
+	return sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.UpdatedReplicas >= replicas-rollingUpdatePartition(sts) &&
+		sts.Status.ReadyReplicas == replicas
+}
+
+// isEtcdHealthy queries the health endpoint of every etcd member
+// and returns true if all members report a healthy cluster
+func (r *PachydermReconciler) isEtcdHealthy(ctx context.Context, sts *appsv1.StatefulSet) bool {
+	ctx, cancel := context.WithTimeout(ctx, etcdHealthTimeout)
+	defer cancel()
+
+	for i := int32(0); i < statefulSetReplicas(sts); i++ {
+		member := fmt.Sprintf("http://%s-%d.%s.%s.svc:2379/health",
+			sts.Name, i, sts.Spec.ServiceName, sts.Namespace)
+
+		if err := etcdMemberHealth(ctx, member); err != nil {
+			r.Log.Info("etcd member is not healthy", "member", member, "error", err.Error())
+			return false
+		}
+	}
+
+	return true
+}
+
+func etcdMemberHealth(ctx context.Context, endpoint string) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	health := struct {
+		Health string `json:"health"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return err
+	}
+
+	if health.Health != "true" {
+		return fmt.Errorf("etcd reported health %q", health.Health)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("rolloutEtcd", func() {
+	// keepTemplate reports the pod template is unchanged
+	keepTemplate := func(*metav1.ObjectMeta, *corev1.PodTemplateSpec, *corev1.PodTemplateSpec) bool {
+		return false
+	}
+
+	table.DescribeTable("etcd replicas",
+		func(current, desired, expected int32, event bool) {
+			ctx := context.Background()
+			scheme := newTestScheme()
+			pd := newTestPachyderm()
+
+			sts := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: pd.Namespace},
+				Spec:       appsv1.StatefulSetSpec{Replicas: &current},
+			}
+			recorder := record.NewFakeRecorder(10)
+			r := &PachydermReconciler{
+				Client:   fake.NewFakeClientWithScheme(scheme, pd, sts.DeepCopy()),
+				Log:      ctrl.Log,
+				Scheme:   scheme,
+				Recorder: recorder,
+			}
+
+			sts.Spec.Replicas = &desired
+			Expect(r.rolloutEtcd(ctx, pd, sts, keepTemplate)).To(Succeed())
+
+			live := &appsv1.StatefulSet{}
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(sts), live)).To(Succeed())
+			Expect(*live.Spec.Replicas).To(Equal(expected))
+			if event {
+				Expect(recorder.Events).To(Receive(ContainSubstring("etcd members can not be added or removed")))
+			} else {
+				Expect(recorder.Events).NotTo(Receive())
+			}
+		},
+		table.Entry("pauses etcd", int32(1), int32(0), int32(0), false),
+		table.Entry("resumes etcd", int32(0), int32(3), int32(3), false),
+		table.Entry("does not add members", int32(1), int32(3), int32(1), true),
+		table.Entry("does not remove members", int32(3), int32(1), int32(3), true),
+	)
+
+	It("records the template hash without rolling out etcd", func() {
+		ctx := context.Background()
+		scheme := newTestScheme()
+		pd := newTestPachyderm()
+
+		replicas := int32(3)
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: pd.Namespace},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "etcd", Image: "pachyderm/etcd:v3.3.5"}},
+					},
+				},
+			},
+		}
+		r := &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, pd, sts.DeepCopy()),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+		Expect(r.updateEtcd(ctx, pd, sts.DeepCopy())).To(Succeed())
+
+		live := &appsv1.StatefulSet{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(sts), live)).To(Succeed())
+		Expect(live.Annotations).To(HaveKeyWithValue(templateHashAnnotation, templateHash(&sts.Spec.Template)))
+		Expect(rollingUpdatePartition(live)).To(BeZero())
+	})
+
+	It("rolls out template changes from the highest ordinal", func() {
+		ctx := context.Background()
+		scheme := newTestScheme()
+		pd := newTestPachyderm()
+
+		replicas := int32(3)
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: pd.Namespace},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "etcd", Image: "pachyderm/etcd:v3.3.5"}},
+					},
+				},
+			},
+		}
+		r := &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, pd, sts.DeepCopy()),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+
+		desired := sts.DeepCopy()
+		desired.Spec.Template.Spec.Containers[0].Image = "pachyderm/etcd:v3.4.9"
+		Expect(r.updateEtcd(ctx, pd, desired)).To(Equal(ErrEtcdNotReady))
+
+		live := &appsv1.StatefulSet{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(sts), live)).To(Succeed())
+		Expect(live.Spec.Template.Spec.Containers[0].Image).To(Equal("pachyderm/etcd:v3.4.9"))
+		Expect(rollingUpdatePartition(live)).To(Equal(int32(2)))
+
+		// the next ordinal is held back until the updated pod is ready
+		Expect(r.updateEtcd(ctx, pd, desired)).To(Equal(ErrEtcdNotReady))
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(sts), live)).To(Succeed())
+		Expect(rollingUpdatePartition(live)).To(Equal(int32(2)))
+	})
+})
@@ -0,0 +1,347 @@
+package generators
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+const (
+	// BackupUploadContainer is the name of the container uploading
+	// the backup artifacts. Its termination message lists the name
+	// and size in bytes of each uploaded artifact, one per line.
+	BackupUploadContainer = "upload"
+	// ErrUnsupportedBackupStorage is returned when the artifacts of
+	// a backup can not be uploaded to the selected storage backend
+	ErrUnsupportedBackupStorage PachydermError = "backups can only be uploaded to the amazon and minio storage backends"
+
+	backupDir           = "/backup"
+	backupBackoffLimit  = int32(2)
+	defaultBackupImage  = "minio/mc:RELEASE.2021-06-13T17-48-22Z"
+	defaultPostgresUser = "postgres"
+	defaultPostgresPort = int32(5432)
+
+	// backupPrefixRoot is the directory the backups are uploaded under
+	// by default. Backups default to the bucket used by pachd, the
+	// directory is named after the operator so it is kept apart from
+	// the objects written by pachd.
+	backupPrefixRoot = "pachyderm-operator/backups"
+)
+
+// BackupStorage returns the object storage the artifacts of the
+// backup are uploaded to, defaulting to the pachyderm storage
+func (c *PachydermComponents) BackupStorage(backup *aimlv1beta1.PachydermBackup) *aimlv1beta1.ObjectStorageOptions {
+	if backup.Spec.Storage != nil {
+		return backup.Spec.Storage
+	}
+	return &c.pachyderm.Spec.Pachd.Storage
+}
+
+// BackupPrefix returns the path in the bucket
+// the backup artifacts are uploaded under
+func BackupPrefix(backup *aimlv1beta1.PachydermBackup) string {
+	if backup.Spec.Prefix != "" {
+		return strings.Trim(backup.Spec.Prefix, "/")
+	}
+	return fmt.Sprintf("%s/%s/%s", backupPrefixRoot, backup.Namespace, backup.Name)
+}
+
+// BackupBucket returns the bucket the backup artifacts are uploaded to
+func (c *PachydermComponents) BackupBucket(backup *aimlv1beta1.PachydermBackup) string {
+	storage := c.BackupStorage(backup)
+	switch {
+	case storage.Backend == "amazon" && storage.Amazon != nil:
+		return storage.Amazon.Bucket
+	case storage.Backend == "minio" && storage.Minio != nil:
+		return storage.Minio.Bucket
+	}
+	return ""
+}
+
+// BackupArtifactLocation returns the location
+// of an artifact uploaded by the backup
+func (c *PachydermComponents) BackupArtifactLocation(backup *aimlv1beta1.PachydermBackup, name string) string {
+	return fmt.Sprintf("s3://%s/%s/%s", c.BackupBucket(backup), BackupPrefix(backup), name)
+}
+
+// BackupJobName returns the name of the job taking the backup
+func BackupJobName(backup *aimlv1beta1.PachydermBackup) string {
+	return fmt.Sprintf("%s-backup", backup.Name)
+}
+
+// BackupJob returns the job taking a snapshot of etcd and
+// dumping the postgresql databases of the pachyderm resource.
+// The artifacts are written to a shared volume by init
+// containers and uploaded by the minio client.
+func (c *PachydermComponents) BackupJob(backup *aimlv1beta1.PachydermBackup) (*batchv1.Job, error) {
+	pd := c.pachyderm
+
+	uploadEnv, err := c.backupUploadEnv(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	etcdSnapshot := []string{"etcdctl"}
+	if etcd := c.EtcdService(); etcd != nil {
+		port, _ := ServicePort(etcd, "client-port")
+		endpoint := fmt.Sprintf("http://%s.%s.svc:%d", etcd.Name, etcd.Namespace, port)
+
+		// present the etcd client certificate on the TLS client port
+		if port, ok := ServicePort(etcd, etcdClientTLSPortName); ok {
+			endpoint = fmt.Sprintf("https://%s.%s.svc:%d", etcd.Name, etcd.Namespace, port)
+			etcdSnapshot = append(etcdSnapshot,
+				"--cacert", filepath.Join(etcdClientTLSMountPath, CABundleKey),
+				"--cert", filepath.Join(etcdClientTLSMountPath, corev1.TLSCertKey),
+				"--key", filepath.Join(etcdClientTLSMountPath, corev1.TLSPrivateKeyKey))
+		}
+		etcdSnapshot = append(etcdSnapshot, "--endpoints", endpoint)
+	}
+	etcdSnapshot = append(etcdSnapshot, "snapshot", "save", backupDir+"/etcd.snapshot")
+
+	upload := corev1.Container{
+		Name:    BackupUploadContainer,
+		Image:   defaultBackupImage,
+		Command: []string{"/bin/sh", "-c", backupUploadScript},
+		Env:     uploadEnv,
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "backup", MountPath: backupDir},
+		},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+	setContainerImage(&upload, backup.Spec.Image)
+
+	labels := setInstanceLabel(map[string]string{
+		"app":   "pachyderm-backup",
+		"suite": "pachyderm",
+	}, pd)
+	backoffLimit := backupBackoffLimit
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      BackupJobName(backup),
+			Namespace: backup.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					InitContainers: []corev1.Container{
+						{
+							Name:    "etcd-snapshot",
+							Image:   containerImage(c.EtcdStatefulSet().Spec.Template.Spec, "etcd"),
+							Command: etcdSnapshot,
+							Env: []corev1.EnvVar{
+								{Name: "ETCDCTL_API", Value: "3"},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "backup", MountPath: backupDir},
+							},
+						},
+						{
+							Name:    "pg-dump",
+							Image:   containerImage(c.PostgreStatefulset().Spec.Template.Spec, "postgres"),
+							Command: []string{"/bin/sh", "-c", backupDumpScript},
+							Env:     c.backupPostgresEnv(backup),
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "backup", MountPath: backupDir},
+							},
+						},
+					},
+					Containers: []corev1.Container{upload},
+					Volumes: []corev1.Volume{
+						{
+							Name: "backup",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if c.PachdTLSEnabled() {
+		c.mountEtcdClientTLSSecret(&job.Spec.Template.Spec, "etcd-snapshot")
+		c.mountCABundle(&job.Spec.Template.Spec, "pg-dump")
+	}
+
+	return job, nil
+}
+
+// backupDumpScript dumps each database listed
+// in $DATABASES in the postgresql custom format
+const backupDumpScript = `set -e
+for db in $DATABASES; do
+  pg_dump --format=custom --file="` + backupDir + `/$db.dump" "$db"
+done
+`
+
+// backupUploadScript uploads the backup artifacts and writes their
+// sizes to the termination message. Session tokens can only be
+// passed to the minio client in the MC_HOST_<alias> variable.
+const backupUploadScript = `set -e
+if [ -n "$SESSION_TOKEN" ]; then
+  export MC_HOST_backup="$ENDPOINT_SCHEME://$ACCESS_KEY:$SECRET_KEY:$SESSION_TOKEN@$ENDPOINT_HOST"
+else
+  mc --config-dir /tmp/mc alias set backup "$ENDPOINT_SCHEME://$ENDPOINT_HOST" "$ACCESS_KEY" "$SECRET_KEY" >/dev/null
+fi
+mc --config-dir /tmp/mc cp --recursive ` + backupDir + `/ "backup/$BUCKET/$PREFIX/"
+cd ` + backupDir + `
+for f in *; do
+  echo "$f $(wc -c < "$f")"
+done > /dev/termination-log
+`
+
+// backupPostgresEnv returns the environment used by
+// pg_dump to connect to the pachyderm databases
+func (c *PachydermComponents) backupPostgresEnv(backup *aimlv1beta1.PachydermBackup) []corev1.EnvVar {
+	postgres := c.pachyderm.Spec.Pachd.Postgres
+
+	host := postgres.Host
+	if svc := c.instancePostgres(); svc != nil {
+		host = fmt.Sprintf("%s.%s.svc", svc.Name, svc.Namespace)
+	}
+	port := postgres.Port
+	if port == 0 {
+		port = defaultPostgresPort
+	}
+	user := postgres.User
+	if user == "" {
+		user = defaultPostgresUser
+	}
+	sslMode := postgres.SSL
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	if c.postgresTLSVerified() {
+		sslMode = postgresSSLMode
+	}
+	optional := true
+
+	envs := []corev1.EnvVar{
+		{Name: "PGHOST", Value: host},
+		{Name: "PGPORT", Value: fmt.Sprintf("%d", port)},
+		{Name: "PGUSER", Value: user},
+		{Name: "PGSSLMODE", Value: sslMode},
+		{
+			Name: "PGPASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: c.StorageSecretName()},
+					Key:                  "POSTGRES_PASSWORD",
+					Optional:             &optional,
+				},
+			},
+		},
+		{Name: "DATABASES", Value: strings.Join(backup.Spec.Databases, " ")},
+	}
+
+	if c.postgresTLSVerified() {
+		envs = append(envs, corev1.EnvVar{Name: "PGSSLROOTCERT", Value: filepath.Join(caBundleMountPath, CABundleKey)})
+	}
+	return envs
+}
+
+// backupUploadEnv returns the environment used by the minio
+// client to upload the backup artifacts. The credentials of the
+// pachyderm storage are read from the storage secret, where the
+// secret references and inline values are already resolved.
+func (c *PachydermComponents) backupUploadEnv(backup *aimlv1beta1.PachydermBackup) ([]corev1.EnvVar, error) {
+	storage := c.BackupStorage(backup)
+	fromStorageSecret := backup.Spec.Storage == nil
+
+	var scheme, host string
+	var id, secret, token corev1.EnvVar
+	switch {
+	case storage.Backend == "amazon" && storage.Amazon != nil:
+		amazon := storage.Amazon
+		scheme, host = "https", fmt.Sprintf("s3.%s.amazonaws.com", amazon.Region)
+		if amazon.CustomEndpoint != "" {
+			scheme, host = splitEndpoint(amazon.CustomEndpoint, !amazon.DisableSSL)
+		}
+		if fromStorageSecret {
+			id = c.storageSecretEnv("ACCESS_KEY", "AMAZON_ID")
+			secret = c.storageSecretEnv("SECRET_KEY", "AMAZON_SECRET")
+			token = c.storageSecretEnv("SESSION_TOKEN", "AMAZON_TOKEN")
+		} else {
+			id = credentialEnv("ACCESS_KEY", amazon.ID, amazon.IDFrom)
+			secret = credentialEnv("SECRET_KEY", amazon.Secret, amazon.SecretFrom)
+			token = credentialEnv("SESSION_TOKEN", amazon.Token, amazon.TokenFrom)
+		}
+	case storage.Backend == "minio" && storage.Minio != nil:
+		minio := storage.Minio
+		scheme, host = splitEndpoint(minio.Endpoint, minio.Secure == "true")
+		if fromStorageSecret {
+			id = c.storageSecretEnv("ACCESS_KEY", "minio-id")
+			secret = c.storageSecretEnv("SECRET_KEY", "minio-secret")
+		} else {
+			id = credentialEnv("ACCESS_KEY", minio.ID, minio.IDFrom)
+			secret = credentialEnv("SECRET_KEY", minio.Secret, minio.SecretFrom)
+		}
+		token = corev1.EnvVar{Name: "SESSION_TOKEN"}
+	default:
+		return nil, ErrUnsupportedBackupStorage
+	}
+
+	return []corev1.EnvVar{
+		{Name: "ENDPOINT_SCHEME", Value: scheme},
+		{Name: "ENDPOINT_HOST", Value: host},
+		{Name: "BUCKET", Value: c.BackupBucket(backup)},
+		{Name: "PREFIX", Value: BackupPrefix(backup)},
+		id,
+		secret,
+		token,
+	}, nil
+}
+
+// storageSecretEnv returns an environment
+// variable set from a key of the storage secret
+func (c *PachydermComponents) storageSecretEnv(name, key string) corev1.EnvVar {
+	optional := true
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: c.StorageSecretName()},
+				Key:                  key,
+				Optional:             &optional,
+			},
+		},
+	}
+}
+
+// credentialEnv returns an environment variable set from
+// the secret reference if set, or from the inline value
+func credentialEnv(name, value string, ref *corev1.SecretKeySelector) corev1.EnvVar {
+	if ref != nil {
+		return corev1.EnvVar{
+			Name:      name,
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: ref},
+		}
+	}
+	return corev1.EnvVar{Name: name, Value: value}
+}
+
+// splitEndpoint returns the scheme and host of an object storage
+// endpoint. The scheme is derived from secure if it is not set.
+func splitEndpoint(endpoint string, secure bool) (string, string) {
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		return endpoint[:i], strings.TrimSuffix(endpoint[i+3:], "/")
+	}
+	if secure {
+		return "https", endpoint
+	}
+	return "http", endpoint
+}
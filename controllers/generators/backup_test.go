@@ -0,0 +1,219 @@
+package generators
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+// envByName indexes environment variables by name
+func envByName(env []corev1.EnvVar) map[string]corev1.EnvVar {
+	vars := map[string]corev1.EnvVar{}
+	for _, v := range env {
+		vars[v.Name] = v
+	}
+	return vars
+}
+
+var _ = Describe("BackupJob", func() {
+	var (
+		pd     *aimlv1beta1.Pachyderm
+		backup *aimlv1beta1.PachydermBackup
+	)
+
+	BeforeEach(func() {
+		pd = &aimlv1beta1.Pachyderm{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pachyderm",
+				Namespace: "default",
+			},
+			Spec: aimlv1beta1.PachydermSpec{
+				Version: "2.0.0",
+				Pachd: aimlv1beta1.PachdOptions{
+					Storage: aimlv1beta1.ObjectStorageOptions{
+						Backend: "amazon",
+						Amazon: &aimlv1beta1.AmazonStorageOptions{
+							Bucket: "pachyderm-data",
+							Region: "us-east-1",
+							ID:     "AKIDEXAMPLE",
+							Secret: "secret",
+						},
+					},
+				},
+			},
+		}
+		backup = &aimlv1beta1.PachydermBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "nightly",
+				Namespace: "default",
+			},
+			Spec: aimlv1beta1.PachydermBackupSpec{
+				Databases: []string{"pachyderm", "dex"},
+			},
+		}
+	})
+
+	uploadEnv := func() map[string]corev1.EnvVar {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		job, err := components.BackupJob(backup)
+		Expect(err).NotTo(HaveOccurred())
+
+		containers := job.Spec.Template.Spec.Containers
+		Expect(containers).To(HaveLen(1))
+		Expect(containers[0].Name).To(Equal(BackupUploadContainer))
+		return envByName(containers[0].Env)
+	}
+
+	// storageSecretKey returns the key of the
+	// storage secret an environment variable is set from
+	storageSecretKey := func(v corev1.EnvVar) string {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v.ValueFrom).NotTo(BeNil())
+		Expect(v.ValueFrom.SecretKeyRef).NotTo(BeNil())
+		Expect(v.ValueFrom.SecretKeyRef.Name).To(Equal(components.StorageSecretName()))
+		return v.ValueFrom.SecretKeyRef.Key
+	}
+
+	It("uploads to a dedicated prefix of the pachd bucket by default", func() {
+		env := uploadEnv()
+		Expect(env["ENDPOINT_SCHEME"].Value).To(Equal("https"))
+		Expect(env["ENDPOINT_HOST"].Value).To(Equal("s3.us-east-1.amazonaws.com"))
+		Expect(env["BUCKET"].Value).To(Equal("pachyderm-data"))
+		Expect(env["PREFIX"].Value).To(Equal("pachyderm-operator/backups/default/nightly"))
+
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components.BackupArtifactLocation(backup, "etcd.snapshot")).
+			To(Equal("s3://pachyderm-data/pachyderm-operator/backups/default/nightly/etcd.snapshot"))
+	})
+
+	It("trims the slashes of the prefix", func() {
+		backup.Spec.Prefix = "/archive/pachyderm/"
+		Expect(uploadEnv()["PREFIX"].Value).To(Equal("archive/pachyderm"))
+	})
+
+	It("reads the amazon credentials of pachd from the storage secret", func() {
+		env := uploadEnv()
+		Expect(storageSecretKey(env["ACCESS_KEY"])).To(Equal("AMAZON_ID"))
+		Expect(storageSecretKey(env["SECRET_KEY"])).To(Equal("AMAZON_SECRET"))
+		Expect(storageSecretKey(env["SESSION_TOKEN"])).To(Equal("AMAZON_TOKEN"))
+	})
+
+	It("reads the minio credentials of pachd from the storage secret", func() {
+		pd.Spec.Pachd.Storage = aimlv1beta1.ObjectStorageOptions{
+			Backend: "minio",
+			Minio: &aimlv1beta1.MinioStorageOptions{
+				Bucket:   "pachyderm-data",
+				Endpoint: "minio.default.svc:9000",
+				ID:       "minio",
+				Secret:   "minio123",
+			},
+		}
+
+		env := uploadEnv()
+		Expect(env["ENDPOINT_SCHEME"].Value).To(Equal("http"))
+		Expect(env["ENDPOINT_HOST"].Value).To(Equal("minio.default.svc:9000"))
+		Expect(env["BUCKET"].Value).To(Equal("pachyderm-data"))
+		Expect(storageSecretKey(env["ACCESS_KEY"])).To(Equal("minio-id"))
+		Expect(storageSecretKey(env["SECRET_KEY"])).To(Equal("minio-secret"))
+		Expect(env).To(HaveKeyWithValue("SESSION_TOKEN", corev1.EnvVar{Name: "SESSION_TOKEN"}))
+	})
+
+	It("uses the credentials of the backup storage", func() {
+		tokenRef := &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "backup-credentials"},
+			Key:                  "token",
+		}
+		backup.Spec.Storage = &aimlv1beta1.ObjectStorageOptions{
+			Backend: "amazon",
+			Amazon: &aimlv1beta1.AmazonStorageOptions{
+				Bucket:         "backups",
+				CustomEndpoint: "s3.example.com",
+				DisableSSL:     true,
+				ID:             "backup-id",
+				Secret:         "backup-secret",
+				TokenFrom:      tokenRef,
+			},
+		}
+
+		env := uploadEnv()
+		Expect(env["ENDPOINT_SCHEME"].Value).To(Equal("http"))
+		Expect(env["ENDPOINT_HOST"].Value).To(Equal("s3.example.com"))
+		Expect(env["BUCKET"].Value).To(Equal("backups"))
+		Expect(env["ACCESS_KEY"].Value).To(Equal("backup-id"))
+		Expect(env["SECRET_KEY"].Value).To(Equal("backup-secret"))
+		Expect(env["SESSION_TOKEN"].ValueFrom.SecretKeyRef).To(Equal(tokenRef))
+	})
+
+	It("uses the inline session token of the backup storage", func() {
+		backup.Spec.Storage = &aimlv1beta1.ObjectStorageOptions{
+			Backend: "amazon",
+			Amazon: &aimlv1beta1.AmazonStorageOptions{
+				Bucket: "backups",
+				Region: "eu-west-1",
+				ID:     "backup-id",
+				Secret: "backup-secret",
+				Token:  "session",
+			},
+		}
+
+		env := uploadEnv()
+		Expect(env["ENDPOINT_HOST"].Value).To(Equal("s3.eu-west-1.amazonaws.com"))
+		Expect(env["SESSION_TOKEN"]).To(Equal(corev1.EnvVar{Name: "SESSION_TOKEN", Value: "session"}))
+	})
+
+	It("uses the secret references of the minio backup storage", func() {
+		idRef := &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "backup-credentials"},
+			Key:                  "id",
+		}
+		backup.Spec.Storage = &aimlv1beta1.ObjectStorageOptions{
+			Backend: "minio",
+			Minio: &aimlv1beta1.MinioStorageOptions{
+				Bucket:   "backups",
+				Endpoint: "https://minio.example.com/",
+				IDFrom:   idRef,
+				Secret:   "backup-secret",
+			},
+		}
+
+		env := uploadEnv()
+		Expect(env["ENDPOINT_SCHEME"].Value).To(Equal("https"))
+		Expect(env["ENDPOINT_HOST"].Value).To(Equal("minio.example.com"))
+		Expect(env["BUCKET"].Value).To(Equal("backups"))
+		Expect(env["ACCESS_KEY"].ValueFrom.SecretKeyRef).To(Equal(idRef))
+		Expect(env["SECRET_KEY"].Value).To(Equal("backup-secret"))
+		Expect(env["SESSION_TOKEN"].Value).To(BeEmpty())
+	})
+
+	It("rejects storage backends the minio client can not upload to", func() {
+		backup.Spec.Storage = &aimlv1beta1.ObjectStorageOptions{
+			Backend: "local",
+			Local:   &aimlv1beta1.LocalStorageOptions{HostPath: "/var/backups"},
+		}
+
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = components.BackupJob(backup)
+		Expect(err).To(MatchError(ErrUnsupportedBackupStorage))
+	})
+
+	It("dumps the databases of the backup", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		job, err := components.BackupJob(backup)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(job.Name).To(Equal("nightly-backup"))
+		initContainers := job.Spec.Template.Spec.InitContainers
+		Expect(initContainers).To(HaveLen(2))
+		Expect(initContainers[0].Name).To(Equal("etcd-snapshot"))
+		Expect(initContainers[1].Name).To(Equal("pg-dump"))
+		Expect(envByName(initContainers[1].Env)["DATABASES"].Value).To(Equal("pachyderm dex"))
+	})
+})
@@ -0,0 +1,107 @@
+package generators
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
+)
+
+// manifestCache holds the parsed manifests of each Pachyderm version.
+// The manifests of a version are read from the catalog and parsed once
+// per catalog revision, callers receive deep copies of the cached objects.
+type manifestCache struct {
+	mu      sync.RWMutex
+	entries map[string]manifestCacheEntry
+}
+
+// manifestCacheEntry holds the objects parsed
+// from the manifests of a catalog revision
+type manifestCacheEntry struct {
+	revision string
+	objects  []*unstructured.Unstructured
+}
+
+var parsedManifests = newManifestCache()
+
+func newManifestCache() *manifestCache {
+	return &manifestCache{
+		entries: map[string]manifestCacheEntry{},
+	}
+}
+
+// get returns deep copies of the objects in the manifests of a version
+func (m *manifestCache) get(version string) ([]*unstructured.Unstructured, error) {
+	key := catalog.Canonical(version)
+	if key == "" {
+		key = version
+	}
+
+	revision, err := catalogRevision()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the catalog revision: %w", err)
+	}
+
+	m.mu.RLock()
+	entry, ok := m.entries[key]
+	m.mu.RUnlock()
+
+	if !ok || entry.revision != revision {
+		objects, err := parseManifests(version)
+		if err != nil {
+			return nil, err
+		}
+
+		entry = manifestCacheEntry{revision: revision, objects: objects}
+		m.mu.Lock()
+		m.entries[key] = entry
+		m.mu.Unlock()
+	}
+
+	objects := make([]*unstructured.Unstructured, 0, len(entry.objects))
+	for _, obj := range entry.objects {
+		objects = append(objects, obj.DeepCopy())
+	}
+
+	return objects, nil
+}
+
+// reset drops the parsed manifests of all versions
+func (m *manifestCache) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = map[string]manifestCacheEntry{}
+}
+
+// catalogRevision returns the revision of the manifest
+// catalog, or an empty string if its manifests never change
+func catalogRevision() (string, error) {
+	if c, ok := manifestCatalog.(catalog.Revisioned); ok {
+		return c.Revision()
+	}
+	return "", nil
+}
+
+// parseManifests reads the manifests of a version
+// from the catalog and decodes the objects they contain
+func parseManifests(version string) ([]*unstructured.Unstructured, error) {
+	manifests, err := loadManifests(version)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []*unstructured.Unstructured{}
+	yamlDecoder := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
+	for i, doc := range manifests {
+		obj := &unstructured.Unstructured{}
+		if _, _, err := yamlDecoder.Decode(doc, nil, obj); err != nil {
+			return nil, fmt.Errorf("unable to decode object %d of the manifests of version %s: %w", i, version, err)
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
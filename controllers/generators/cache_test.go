@@ -0,0 +1,69 @@
+package generators
+
+import (
+	"context"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
+)
+
+var _ = Describe("manifestCache", func() {
+	AfterEach(func() {
+		SetCatalog(catalog.Embedded())
+	})
+
+	It("shares the parsed manifests of a version", func() {
+		SetCatalog(catalog.NewFSCatalog(fstest.MapFS{
+			"2.0.0/manifests.yaml": {Data: []byte("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: pachyderm\n")},
+		}))
+
+		objects, err := parsedManifests.get("2.0.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).To(HaveLen(1))
+		objects[0].SetName("changed")
+
+		objects, err = parsedManifests.get("v2.0.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects[0].GetName()).To(Equal("pachyderm"))
+	})
+
+	It("does not cache manifests with objects that can not be decoded", func() {
+		SetCatalog(catalog.NewFSCatalog(fstest.MapFS{
+			"2.0.0/manifests.yaml": {Data: []byte("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: pachyderm\n---\nname: no kind\n")},
+		}))
+
+		_, err := parsedManifests.get("2.0.0")
+		Expect(err).To(MatchError(ContainSubstring("unable to decode object 1")))
+		Expect(parsedManifests.entries).NotTo(HaveKey("v2.0.0"))
+	})
+
+	It("parses the manifests again when the config map changes", func() {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "pachyderm-versions", Namespace: "pachyderm-system"},
+			Data: map[string]string{
+				"2.0.0": "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: pachyderm\n",
+			},
+		}
+		c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme, cm)
+		SetCatalog(catalog.NewConfigMapCatalog(c, types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}))
+
+		objects, err := parsedManifests.get("2.0.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects[0].GetName()).To(Equal("pachyderm"))
+
+		cm.Data["2.0.0"] = "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: pachd\n"
+		Expect(c.Update(context.Background(), cm)).To(Succeed())
+
+		objects, err = parsedManifests.get("2.0.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects[0].GetName()).To(Equal("pachd"))
+	})
+})
@@ -3,6 +3,7 @@ package generators
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
@@ -13,6 +14,11 @@ import (
 
 var (
 	keyBitSize = 4096
+	// leafKeyBitSize is the size of the keys of
+	// certificates issued by the instance CA
+	leafKeyBitSize = 2048
+	// caValidity is the validity period of the instance CA
+	caValidity = 5 * 365 * 24 * time.Hour
 )
 
 const (
@@ -22,9 +28,14 @@ const (
 	caCertType = "ca"
 )
 
-func getCertTemplate(certificateType string) x509.Certificate {
+func getCertTemplate(certificateType string) (x509.Certificate, error) {
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return x509.Certificate{}, err
+	}
+
 	cert := x509.Certificate{
-		SerialNumber: big.NewInt(1),
+		SerialNumber: serialNumber,
 		Subject: pkix.Name{
 			Organization: []string{"Pachyderm, Inc."},
 			Country:      []string{"US"},
@@ -37,7 +48,9 @@ func getCertTemplate(certificateType string) x509.Certificate {
 	}
 
 	if certificateType == caCertType {
-		cert.KeyUsage |= x509.KeyUsageCertSign
+		cert.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+		cert.ExtKeyUsage = nil
+		cert.NotAfter = time.Now().Add(caValidity).UTC()
 		cert.IsCA = true
 	}
 
@@ -46,7 +59,12 @@ func getCertTemplate(certificateType string) x509.Certificate {
 		cert.IsCA = false
 	}
 
-	return cert
+	return cert, nil
+}
+
+// newSerialNumber returns a random 128 bit certificate serial number
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 }
 
 // PrivateKeyRSA returns a RSA private key
@@ -74,21 +92,78 @@ func encodeCertificateToPEM(cert *x509.Certificate) []byte {
 	)
 }
 
-// ClientCertificate returns certificate, privateKey and error
-// Takes an RSA private key and slice of hosts
-// Returns: certificate, error
-func newClientCertificate(key *rsa.PrivateKey, hosts []string) (*x509.Certificate, error) {
+// newCACertificate returns a self-signed CA certificate
+func newCACertificate(key *rsa.PrivateKey, commonName string) (*x509.Certificate, error) {
+	cert, err := getCertTemplate(caCertType)
+	if err != nil {
+		return nil, err
+	}
+	cert.Subject.CommonName = commonName
 
-	cert := getCertTemplate(clientCertType)
+	certificateDER, err := x509.CreateCertificate(rand.Reader, &cert, &cert, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(certificateDER)
+}
+
+// newSignedCertificate returns a certificate for the hosts signed by the CA
+func newSignedCertificate(key *rsa.PrivateKey, ca *certificateAuthority, commonName string, hosts []string, usages []x509.ExtKeyUsage) (*x509.Certificate, error) {
+	cert, err := getCertTemplate(clientCertType)
+	if err != nil {
+		return nil, err
+	}
+	cert.Subject.CommonName = commonName
+	cert.DNSNames = append(cert.DNSNames, hosts...)
+	cert.ExtKeyUsage = usages
 
-	if len(hosts) > 0 {
-		cert.DNSNames = append(cert.DNSNames, hosts...)
+	// leaf certificates must not outlive the CA
+	if cert.NotAfter.After(ca.cert.NotAfter) {
+		cert.NotAfter = ca.cert.NotAfter
 	}
 
-	certificateDER, err := x509.CreateCertificate(rand.Reader, &cert, &cert, &key.PublicKey, key)
+	certificateDER, err := x509.CreateCertificate(rand.Reader, &cert, ca.cert, &key.PublicKey, ca.key)
 	if err != nil {
 		return nil, err
 	}
 
 	return x509.ParseCertificate(certificateDER)
 }
+
+// certificateValid returns true if the PEM encoded certificate matches
+// the private key, is valid for all hosts and does not need renewal.
+// If roots is set, the certificate must also be signed by one of the roots.
+func certificateValid(certPEM, keyPEM []byte, hosts []string, roots *x509.CertPool, now time.Time) bool {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false
+	}
+
+	if now.Before(cert.NotBefore) || now.Add(certificateRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+
+	if roots != nil {
+		if _, err := cert.Verify(x509.VerifyOptions{
+			Roots:       roots,
+			CurrentTime: now,
+			KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return false
+		}
+	}
+
+	for _, host := range hosts {
+		if err := cert.VerifyHostname(host); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
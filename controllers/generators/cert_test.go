@@ -0,0 +1,148 @@
+package generators
+
+import (
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+var _ = Describe("certificateValid", func() {
+	var (
+		ca      *certificateAuthority
+		cert    *x509.Certificate
+		certPEM []byte
+		keyPEM  []byte
+		roots   *x509.CertPool
+	)
+
+	BeforeEach(func() {
+		caKey, err := newPrivateKeyRSA(leafKeyBitSize)
+		Expect(err).NotTo(HaveOccurred())
+		caCert, err := newCACertificate(caKey, "test CA")
+		Expect(err).NotTo(HaveOccurred())
+		ca = &certificateAuthority{cert: caCert, key: caKey}
+		roots = x509.NewCertPool()
+		roots.AddCert(caCert)
+
+		key, err := newPrivateKeyRSA(leafKeyBitSize)
+		Expect(err).NotTo(HaveOccurred())
+		cert, err = newSignedCertificate(key, ca, "pachd", []string{"pachd", "pachd.default.svc"},
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+		Expect(err).NotTo(HaveOccurred())
+		certPEM = encodeCertificateToPEM(cert)
+		keyPEM = encodePrivateKeyToPEM(key)
+	})
+
+	It("accepts a certificate issued for the hosts", func() {
+		Expect(certificateValid(certPEM, keyPEM, []string{"pachd.default.svc"}, roots, time.Now())).To(BeTrue())
+		Expect(certificateValid(certPEM, keyPEM, nil, nil, time.Now())).To(BeTrue())
+	})
+
+	It("rejects a certificate missing a host", func() {
+		Expect(certificateValid(certPEM, keyPEM, []string{"pachd.example.com"}, roots, time.Now())).To(BeFalse())
+	})
+
+	It("rejects a certificate not matching the key", func() {
+		other, err := newPrivateKeyRSA(leafKeyBitSize)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certificateValid(certPEM, encodePrivateKeyToPEM(other), nil, roots, time.Now())).To(BeFalse())
+		Expect(certificateValid(nil, nil, nil, nil, time.Now())).To(BeFalse())
+	})
+
+	It("rejects a certificate issued by another CA", func() {
+		otherKey, err := newPrivateKeyRSA(leafKeyBitSize)
+		Expect(err).NotTo(HaveOccurred())
+		otherCA, err := newCACertificate(otherKey, "other CA")
+		Expect(err).NotTo(HaveOccurred())
+		otherRoots := x509.NewCertPool()
+		otherRoots.AddCert(otherCA)
+		Expect(certificateValid(certPEM, keyPEM, nil, otherRoots, time.Now())).To(BeFalse())
+	})
+
+	It("renews certificates before they expire", func() {
+		renewAt := cert.NotAfter.Add(-certificateRenewBefore)
+		Expect(certificateValid(certPEM, keyPEM, nil, roots, renewAt.Add(-time.Hour))).To(BeTrue())
+		Expect(certificateValid(certPEM, keyPEM, nil, roots, renewAt.Add(time.Hour))).To(BeFalse())
+		Expect(certificateValid(certPEM, keyPEM, nil, roots, cert.NotBefore.Add(-time.Hour))).To(BeFalse())
+	})
+})
+
+var _ = Describe("pachd certificate", func() {
+	var pd *aimlv1beta1.Pachyderm
+
+	BeforeEach(func() {
+		pd = &aimlv1beta1.Pachyderm{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pachyderm",
+				Namespace:   "default",
+				Annotations: map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance},
+			},
+			Spec: aimlv1beta1.PachydermSpec{
+				Version: "2.0.0",
+				Pachd: aimlv1beta1.PachdOptions{
+					Storage: aimlv1beta1.ObjectStorageOptions{
+						Backend: "local",
+						Local:   &aimlv1beta1.LocalStorageOptions{HostPath: "/var/pachyderm"},
+					},
+					TLS: &aimlv1beta1.PachdTLSOptions{Enabled: true},
+				},
+			},
+		}
+	})
+
+	// pachdSecrets returns the generated secrets
+	// indexed by name, reusing the current secrets
+	pachdSecrets := func(current map[string]*corev1.Secret) (*PachydermComponents, map[string]*corev1.Secret) {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		for _, secret := range current {
+			components.SetCurrentSecret(secret.DeepCopy())
+		}
+
+		secrets, err := components.Secrets()
+		Expect(err).NotTo(HaveOccurred())
+		generated := map[string]*corev1.Secret{}
+		for _, secret := range secrets {
+			generated[secret.Name] = secret
+		}
+		return components, generated
+	}
+
+	It("includes the ingress and additional hosts", func() {
+		pd.Spec.Pachd.Ingress = &aimlv1beta1.PachdIngressOptions{Host: "pachd.example.com"}
+		pd.Spec.Pachd.TLS.AdditionalHosts = []string{"pachyderm.example.com"}
+		components, _ := pachdSecrets(nil)
+
+		hosts := components.PachdTLSHosts()
+		Expect(hosts).To(ContainElements(
+			components.PachdService().Name+".default.svc",
+			components.PachdPeerService().Name+".default.svc.cluster.local",
+			"pachd.example.com",
+			"pachyderm.example.com"))
+	})
+
+	It("issues a new certificate when the pachd hosts change", func() {
+		components, issued := pachdSecrets(nil)
+		name := components.PachdTLSSecretName()
+
+		pd.Spec.Pachd.TLS.AdditionalHosts = []string{"pachyderm.example.com"}
+		_, reissued := pachdSecrets(issued)
+		Expect(reissued[name].Data[corev1.TLSCertKey]).NotTo(Equal(issued[name].Data[corev1.TLSCertKey]))
+		Expect(parseCertificate(reissued[name]).VerifyHostname("pachyderm.example.com")).To(Succeed())
+
+		// the certificates of the other components are kept
+		Expect(reissued[components.CASecretName()].Data).To(Equal(issued[components.CASecretName()].Data))
+	})
+
+	It("mounts the certificate in pachd", func() {
+		components, _ := pachdSecrets(nil)
+		pachd := containerByName(components.PachdDeployment().Spec.Template.Spec, "pachd")
+		Expect(mountPaths(pachd)).To(HaveKeyWithValue("pachd-tls-cert", pachdTLSMountPath))
+	})
+})
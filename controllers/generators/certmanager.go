@@ -0,0 +1,129 @@
+package generators
+
+import (
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CertificateGVK is the group, version and kind of cert-manager certificates
+var CertificateGVK = schema.GroupVersionKind{
+	Group:   "cert-manager.io",
+	Version: "v1",
+	Kind:    "Certificate",
+}
+
+// pachdCertificateOptions returns the source of the pachd
+// certificate, or nil if TLS is disabled for pachd
+func (c *PachydermComponents) pachdCertificateOptions() *aimlv1beta1.TLSCertificateOptions {
+	if !c.PachdTLSEnabled() {
+		return nil
+	}
+	return &c.pachyderm.Spec.Pachd.TLS.TLSCertificateOptions
+}
+
+// PachdTLSIssuedByCA returns true if the pachd
+// certificate is issued by the instance CA
+func (c *PachydermComponents) PachdTLSIssuedByCA() bool {
+	opts := c.pachdCertificateOptions()
+	return opts != nil && opts.SecretName == "" && opts.CertManager == nil
+}
+
+// DashTLSSecretName returns the name of the secret
+// holding the certificate of the dash url
+func (c *PachydermComponents) DashTLSSecretName() string {
+	tls := c.pachyderm.Spec.Dashd.TLS
+	if tls != nil && tls.SecretName != "" {
+		return tls.SecretName
+	}
+	return instanceName(c.pachyderm, "dash-tls")
+}
+
+// dashTLSEnabled returns true if a certificate
+// is provided or requested for the dash url
+func (c *PachydermComponents) dashTLSEnabled() bool {
+	tls := c.pachyderm.Spec.Dashd.TLS
+	return tls != nil && (tls.SecretName != "" || tls.CertManager != nil)
+}
+
+// Certificates returns the cert-manager certificates requested
+// for the pachd APIs and the dash url. A certificate is only
+// requested if no existing secret is set by the user.
+func (c *PachydermComponents) Certificates() []*unstructured.Unstructured {
+	pd := c.pachyderm
+	certs := []*unstructured.Unstructured{}
+
+	if cert := c.PachdCertificate(); cert != nil {
+		certs = append(certs, cert)
+	}
+
+	if tls := pd.Spec.Dashd.TLS; tls != nil && tls.SecretName == "" && tls.CertManager != nil &&
+		!pd.Spec.Dashd.Disable && pd.Spec.Dashd.URL != "" {
+		certs = append(certs,
+			newCertificate(pd, "dash", c.DashTLSSecretName(), []string{pd.Spec.Dashd.URL}, tls.CertManager))
+	}
+
+	return certs
+}
+
+// PachdCertificate returns the cert-manager certificate
+// requested for pachd, or nil if none is requested
+func (c *PachydermComponents) PachdCertificate() *unstructured.Unstructured {
+	opts := c.pachdCertificateOptions()
+	if opts == nil || opts.SecretName != "" || opts.CertManager == nil {
+		return nil
+	}
+
+	return newCertificate(c.pachyderm, "pachd", c.PachdTLSSecretName(), c.PachdTLSHosts(), opts.CertManager)
+}
+
+// newCertificate returns a cert-manager certificate for the hosts,
+// stored in the secret mounted or referenced by the component
+func newCertificate(pd *aimlv1beta1.Pachyderm, app, secretName string, hosts []string, opts *aimlv1beta1.CertManagerOptions) *unstructured.Unstructured {
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(CertificateGVK)
+	cert.SetName(instanceName(pd, app))
+	cert.SetNamespace(pd.Namespace)
+	cert.SetLabels(setInstanceLabel(map[string]string{
+		"app":   app,
+		"suite": "pachyderm",
+	}, pd))
+
+	dnsNames := make([]interface{}, 0, len(hosts))
+	for _, host := range hosts {
+		dnsNames = append(dnsNames, host)
+	}
+
+	issuerRef := map[string]interface{}{
+		"name":  opts.IssuerRef.Name,
+		"kind":  "Issuer",
+		"group": "cert-manager.io",
+	}
+	if opts.IssuerRef.Kind != "" {
+		issuerRef["kind"] = opts.IssuerRef.Kind
+	}
+	if opts.IssuerRef.Group != "" {
+		issuerRef["group"] = opts.IssuerRef.Group
+	}
+
+	spec := map[string]interface{}{
+		"secretName": secretName,
+		"dnsNames":   dnsNames,
+		"issuerRef":  issuerRef,
+		"usages": []interface{}{
+			"server auth",
+			"digital signature",
+			"key encipherment",
+		},
+	}
+	if opts.Duration != nil {
+		spec["duration"] = opts.Duration.Duration.String()
+	}
+	if opts.RenewBefore != nil {
+		spec["renewBefore"] = opts.RenewBefore.Duration.String()
+	}
+
+	cert.Object["spec"] = spec
+
+	return cert
+}
@@ -0,0 +1,115 @@
+package generators
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+var _ = Describe("cert-manager certificates", func() {
+	var pd *aimlv1beta1.Pachyderm
+
+	BeforeEach(func() {
+		pd = &aimlv1beta1.Pachyderm{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pachyderm",
+				Namespace:   "default",
+				Annotations: map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance},
+			},
+			Spec: aimlv1beta1.PachydermSpec{
+				Version: "2.0.0",
+				Pachd: aimlv1beta1.PachdOptions{
+					Storage: aimlv1beta1.ObjectStorageOptions{
+						Backend: "local",
+						Local:   &aimlv1beta1.LocalStorageOptions{HostPath: "/var/pachyderm"},
+					},
+					TLS: &aimlv1beta1.PachdTLSOptions{
+						Enabled: true,
+						TLSCertificateOptions: aimlv1beta1.TLSCertificateOptions{
+							CertManager: &aimlv1beta1.CertManagerOptions{
+								IssuerRef: aimlv1beta1.CertManagerIssuerReference{Name: "letsencrypt"},
+							},
+						},
+					},
+				},
+			},
+		}
+	})
+
+	// nestedString returns a string field of the certificate spec
+	nestedString := func(cert *unstructured.Unstructured, fields ...string) string {
+		value, _, err := unstructured.NestedString(cert.Object, append([]string{"spec"}, fields...)...)
+		Expect(err).NotTo(HaveOccurred())
+		return value
+	}
+
+	It("requests the pachd certificate from the issuer", func() {
+		pd.Spec.Pachd.TLS.CertManager.RenewBefore = &metav1.Duration{Duration: 240 * time.Hour}
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components.PachdTLSIssuedByCA()).To(BeFalse())
+
+		cert := components.PachdCertificate()
+		Expect(cert).NotTo(BeNil())
+		Expect(cert.GroupVersionKind()).To(Equal(CertificateGVK))
+		Expect(nestedString(cert, "secretName")).To(Equal(components.PachdTLSSecretName()))
+		Expect(nestedString(cert, "issuerRef", "name")).To(Equal("letsencrypt"))
+		Expect(nestedString(cert, "issuerRef", "kind")).To(Equal("Issuer"))
+		Expect(nestedString(cert, "issuerRef", "group")).To(Equal("cert-manager.io"))
+		Expect(nestedString(cert, "renewBefore")).To(Equal("240h0m0s"))
+		Expect(nestedString(cert, "duration")).To(BeEmpty())
+
+		hosts, _, err := unstructured.NestedStringSlice(cert.Object, "spec", "dnsNames")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hosts).To(Equal(components.PachdTLSHosts()))
+
+		// the operator does not issue the pachd certificate
+		secrets, err := components.Secrets()
+		Expect(err).NotTo(HaveOccurred())
+		for _, secret := range secrets {
+			Expect(secret.Name).NotTo(Equal(components.PachdTLSSecretName()))
+		}
+		Expect(components.CertificateSecretNames()).To(ContainElement(components.PachdTLSSecretName()))
+	})
+
+	It("uses the secret set by the user", func() {
+		pd.Spec.Pachd.TLS.SecretName = "pachd-certificate"
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(components.PachdTLSSecretName()).To(Equal("pachd-certificate"))
+		Expect(components.PachdCertificate()).To(BeNil())
+		Expect(components.Certificates()).To(BeEmpty())
+
+		pachd := containerByName(components.PachdDeployment().Spec.Template.Spec, "pachd")
+		Expect(mountPaths(pachd)).To(HaveKeyWithValue("pachd-tls-cert", pachdTLSMountPath))
+	})
+
+	It("requests the dash certificate for the dash url", func() {
+		pd.Spec.Pachd.TLS = nil
+		pd.Spec.Dashd.TLS = &aimlv1beta1.TLSCertificateOptions{
+			CertManager: &aimlv1beta1.CertManagerOptions{
+				IssuerRef: aimlv1beta1.CertManagerIssuerReference{Name: "letsencrypt", Kind: "ClusterIssuer"},
+			},
+		}
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components.Certificates()).To(BeEmpty())
+
+		pd.Spec.Dashd.URL = "dash.example.com"
+		components, err = Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		certs := components.Certificates()
+		Expect(certs).To(HaveLen(1))
+		Expect(nestedString(certs[0], "secretName")).To(Equal(components.DashTLSSecretName()))
+		Expect(nestedString(certs[0], "issuerRef", "kind")).To(Equal("ClusterIssuer"))
+		hosts, _, err := unstructured.NestedStringSlice(certs[0].Object, "spec", "dnsNames")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hosts).To(Equal([]string{"dash.example.com"}))
+	})
+})
@@ -0,0 +1,146 @@
+package generators
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// checksumAnnotationPrefix prefixes the pod template annotations holding
+// the checksum of each generated secret and config map used by the pods.
+// Changes to the secrets and config maps change the pod template,
+// rolling out the workload.
+const checksumAnnotationPrefix = "checksum/"
+
+// dataChecksum returns the sha256 checksum of secret data
+func dataChecksum(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write(data[key])
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// configMapChecksum returns the sha256 checksum of config map data
+func configMapChecksum(cm *corev1.ConfigMap) string {
+	data := make(map[string][]byte, len(cm.Data)+len(cm.BinaryData))
+	for key, value := range cm.Data {
+		data[key] = []byte(value)
+	}
+	for key, value := range cm.BinaryData {
+		data[key] = value
+	}
+	return dataChecksum(data)
+}
+
+// checksumAnnotation returns the pod template annotation holding
+// the checksum of a generated secret or config map.
+// For example, checksum/storage-secret for the pachd storage secret.
+func (c *PachydermComponents) checksumAnnotation(name string) string {
+	name = strings.TrimPrefix(name, c.pachyderm.Name+"-")
+	return checksumAnnotationPrefix + strings.TrimPrefix(name, "pachyderm-")
+}
+
+// setConfigChecksums annotates the pod template with the checksum
+// of every generated secret and config map used by the pods
+func (c *PachydermComponents) setConfigChecksums(template *corev1.PodTemplateSpec) {
+	secrets, configMaps := podConfigReferences(&template.Spec)
+	if len(secrets) == 0 && len(configMaps) == 0 {
+		return
+	}
+
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+
+	// certificates that can not be issued fail the reconciliation
+	// of the secrets, before the workloads are deployed
+	generatedSecrets, _ := c.Secrets()
+	for _, secret := range generatedSecrets {
+		if secrets[secret.Name] {
+			template.Annotations[c.checksumAnnotation(secret.Name)] = dataChecksum(secret.Data)
+		}
+	}
+
+	generatedConfigMaps, _ := c.ConfgigMaps()
+	for _, cm := range generatedConfigMaps {
+		if configMaps[cm.Name] {
+			template.Annotations[c.checksumAnnotation(cm.Name)] = configMapChecksum(cm)
+		}
+	}
+
+	// secrets provided by the user or cert-manager
+	// are read from the cluster by the controller
+	for name, secret := range c.currentSecrets {
+		annotation := c.checksumAnnotation(name)
+		if _, ok := template.Annotations[annotation]; secrets[name] && !ok {
+			template.Annotations[annotation] = dataChecksum(secret.Data)
+		}
+	}
+}
+
+// podConfigReferences returns the names of the secrets
+// and config maps used by the pod volumes and containers
+func podConfigReferences(spec *corev1.PodSpec) (secrets, configMaps map[string]bool) {
+	secrets = map[string]bool{}
+	configMaps = map[string]bool{}
+
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil {
+			secrets[volume.Secret.SecretName] = true
+		}
+		if volume.ConfigMap != nil {
+			configMaps[volume.ConfigMap.Name] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					secrets[source.Secret.Name] = true
+				}
+				if source.ConfigMap != nil {
+					configMaps[source.ConfigMap.Name] = true
+				}
+			}
+		}
+	}
+
+	containers := append([]corev1.Container{}, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				secrets[envFrom.SecretRef.Name] = true
+			}
+			if envFrom.ConfigMapRef != nil {
+				configMaps[envFrom.ConfigMapRef.Name] = true
+			}
+		}
+
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				secrets[env.ValueFrom.SecretKeyRef.Name] = true
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				configMaps[env.ValueFrom.ConfigMapKeyRef.Name] = true
+			}
+		}
+	}
+
+	return secrets, configMaps
+}
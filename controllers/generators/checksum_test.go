@@ -0,0 +1,127 @@
+package generators
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+var _ = Describe("config checksums", func() {
+	var pd *aimlv1beta1.Pachyderm
+
+	BeforeEach(func() {
+		pd = &aimlv1beta1.Pachyderm{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pachyderm",
+				Namespace:   "default",
+				Annotations: map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance},
+			},
+			Spec: aimlv1beta1.PachydermSpec{
+				Version: "2.0.0",
+				Pachd: aimlv1beta1.PachdOptions{
+					Storage: aimlv1beta1.ObjectStorageOptions{
+						Backend: "minio",
+						Minio: &aimlv1beta1.MinioStorageOptions{
+							Bucket:   "pachyderm",
+							Endpoint: "minio.default.svc:9000",
+							ID:       "minio",
+							Secret:   "minio123",
+						},
+					},
+				},
+			},
+		}
+	})
+
+	// pachdAnnotations returns the pod template annotations of pachd
+	pachdAnnotations := func() map[string]string {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		return components.PachdDeployment().Spec.Template.Annotations
+	}
+
+	It("rolls out pachd when the storage secret changes", func() {
+		annotations := pachdAnnotations()
+		Expect(annotations).To(HaveKey("checksum/storage-secret"))
+		Expect(pachdAnnotations()).To(Equal(annotations))
+
+		pd.Spec.Pachd.Storage.Minio.Secret = "rotated"
+		Expect(pachdAnnotations()["checksum/storage-secret"]).NotTo(Equal(annotations["checksum/storage-secret"]))
+	})
+
+	It("does not depend on the order of the secret keys", func() {
+		Expect(dataChecksum(map[string][]byte{"a": []byte("1"), "b": []byte("2")})).
+			To(Equal(dataChecksum(map[string][]byte{"b": []byte("2"), "a": []byte("1")})))
+		Expect(dataChecksum(map[string][]byte{"a": []byte("12")})).
+			NotTo(Equal(dataChecksum(map[string][]byte{"a1": []byte("2")})))
+	})
+
+	It("annotates the workloads with the checksums of the config maps they mount", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		configMaps, err := components.ConfgigMaps()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configMaps).NotTo(BeEmpty())
+
+		annotations := components.PostgreStatefulset().Spec.Template.Annotations
+		Expect(annotations).To(HaveKeyWithValue("checksum/postgres-init-cm", configMapChecksum(configMaps[0])))
+		Expect(components.EtcdStatefulSet().Spec.Template.Annotations).NotTo(HaveKey(HavePrefix(checksumAnnotationPrefix)))
+	})
+
+	It("names the annotations after the unprefixed config names", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components.checksumAnnotation("pachyderm-pachyderm-storage-secret")).To(Equal("checksum/storage-secret"))
+		Expect(components.checksumAnnotation("pachyderm-postgres-init-cm")).To(Equal("checksum/postgres-init-cm"))
+	})
+
+	It("finds the secrets and config maps used by the pods", func() {
+		secretKey := func(name string) *corev1.SecretKeySelector {
+			return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}}
+		}
+		configMapKey := func(name string) *corev1.ConfigMapKeySelector {
+			return &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}}
+		}
+
+		spec := &corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "volume-secret"}}},
+				{VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "volume-cm"},
+				}}},
+				{VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{
+						{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "projected-secret"}}},
+						{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "projected-cm"}}},
+					},
+				}}},
+			},
+			InitContainers: []corev1.Container{{
+				EnvFrom: []corev1.EnvFromSource{
+					{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "init-secret"}}},
+				},
+			}},
+			Containers: []corev1.Container{{
+				EnvFrom: []corev1.EnvFromSource{
+					{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "env-from-cm"}}},
+				},
+				Env: []corev1.EnvVar{
+					{Name: "PLAIN", Value: "value"},
+					{Name: "SECRET", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: secretKey("env-secret")}},
+					{Name: "CONFIG", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: configMapKey("env-cm")}},
+				},
+			}},
+		}
+
+		secrets, configMaps := podConfigReferences(spec)
+		Expect(secrets).To(Equal(map[string]bool{
+			"volume-secret": true, "projected-secret": true, "init-secret": true, "env-secret": true,
+		}))
+		Expect(configMaps).To(Equal(map[string]bool{
+			"volume-cm": true, "projected-cm": true, "env-from-cm": true, "env-cm": true,
+		}))
+	})
+})
@@ -0,0 +1,152 @@
+package generators
+
+import (
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Ingresses returns the ingresses exposing
+// pachyderm components outside the cluster
+func (c *PachydermComponents) Ingresses() []*networkingv1.Ingress {
+	ingresses := []*networkingv1.Ingress{}
+
+	if ing := c.DashIngress(); ing != nil {
+		ingresses = append(ingresses, ing)
+	}
+
+	if ing := c.PachdIngress(); ing != nil {
+		ingresses = append(ingresses, ing)
+	}
+
+	return ingresses
+}
+
+// DashIngress returns the ingress exposing the dash UI.
+// The ingress is only created if the dash url is set.
+func (c *PachydermComponents) DashIngress() *networkingv1.Ingress {
+	pd := c.pachyderm
+	svc := c.DashService()
+	if pd.Spec.Dashd.Disable || pd.Spec.Dashd.URL == "" || svc == nil {
+		return nil
+	}
+
+	opts := aimlv1beta1.IngressOptions{}
+	if pd.Spec.Dashd.Ingress != nil {
+		opts = *pd.Spec.Dashd.Ingress
+	}
+	if opts.TLSSecretName == "" && c.dashTLSEnabled() {
+		opts.TLSSecretName = c.DashTLSSecretName()
+	}
+
+	ing := newIngress(pd, "dash", opts)
+	ing.Spec.Rules = []networkingv1.IngressRule{
+		ingressRule(pd.Spec.Dashd.URL, opts, svc.Name, "dash-http"),
+	}
+	setIngressTLS(ing, opts)
+
+	return ing
+}
+
+// PachdIngress returns the ingress exposing the pachd gRPC
+// API and S3 gateway. The ingress is only created if a host
+// is set for at least one of the pachd ports.
+func (c *PachydermComponents) PachdIngress() *networkingv1.Ingress {
+	pd := c.pachyderm
+	svc := c.PachdService()
+	if pd.Spec.Pachd.Ingress == nil || svc == nil {
+		return nil
+	}
+
+	opts := pd.Spec.Pachd.Ingress
+	ing := newIngress(pd, "pachd", opts.IngressOptions)
+
+	if opts.Host != "" {
+		ing.Spec.Rules = append(ing.Spec.Rules,
+			ingressRule(opts.Host, opts.IngressOptions, svc.Name, "api-grpc-port"))
+	}
+
+	if opts.S3GatewayHost != "" {
+		ing.Spec.Rules = append(ing.Spec.Rules,
+			ingressRule(opts.S3GatewayHost, opts.IngressOptions, svc.Name, "s3gateway-port"))
+	}
+
+	if len(ing.Spec.Rules) == 0 {
+		return nil
+	}
+	setIngressTLS(ing, opts.IngressOptions)
+
+	return ing
+}
+
+func newIngress(pd *aimlv1beta1.Pachyderm, app string, opts aimlv1beta1.IngressOptions) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instanceName(pd, app),
+			Namespace: pd.Namespace,
+			Labels: setInstanceLabel(map[string]string{
+				"app":   app,
+				"suite": "pachyderm",
+			}, pd),
+			Annotations: opts.Annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: opts.ClassName,
+		},
+	}
+}
+
+// ingressRule routes requests for the host to a named service port
+func ingressRule(host string, opts aimlv1beta1.IngressOptions, service, port string) networkingv1.IngressRule {
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+
+	pathType := networkingv1.PathTypePrefix
+	if opts.PathType != "" {
+		pathType = networkingv1.PathType(opts.PathType)
+	}
+
+	return networkingv1.IngressRule{
+		Host: host,
+		IngressRuleValue: networkingv1.IngressRuleValue{
+			HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{
+					{
+						Path:     path,
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{
+							Service: &networkingv1.IngressServiceBackend{
+								Name: service,
+								Port: networkingv1.ServiceBackendPort{
+									Name: port,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// setIngressTLS terminates TLS for all ingress
+// hosts using the certificate in the TLS secret
+func setIngressTLS(ing *networkingv1.Ingress, opts aimlv1beta1.IngressOptions) {
+	if opts.TLSSecretName == "" {
+		return
+	}
+
+	hosts := []string{}
+	for _, rule := range ing.Spec.Rules {
+		hosts = append(hosts, rule.Host)
+	}
+
+	ing.Spec.TLS = []networkingv1.IngressTLS{
+		{
+			Hosts:      hosts,
+			SecretName: opts.TLSSecretName,
+		},
+	}
+}
@@ -0,0 +1,117 @@
+package generators
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+var _ = Describe("ingresses", func() {
+	var pd *aimlv1beta1.Pachyderm
+
+	BeforeEach(func() {
+		pd = &aimlv1beta1.Pachyderm{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pachyderm",
+				Namespace:   "default",
+				Annotations: map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance},
+			},
+			Spec: aimlv1beta1.PachydermSpec{
+				Version: "2.0.0",
+				Pachd: aimlv1beta1.PachdOptions{
+					Storage: aimlv1beta1.ObjectStorageOptions{
+						Backend: "local",
+						Local:   &aimlv1beta1.LocalStorageOptions{HostPath: "/var/pachyderm"},
+					},
+				},
+			},
+		}
+	})
+
+	// backend returns the service and port name of an ingress rule
+	backend := func(rule networkingv1.IngressRule) (string, string) {
+		Expect(rule.HTTP.Paths).To(HaveLen(1))
+		svc := rule.HTTP.Paths[0].Backend.Service
+		return svc.Name, svc.Port.Name
+	}
+
+	It("only exposes the components with a host", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components.Ingresses()).To(BeEmpty())
+
+		pd.Spec.Pachd.Ingress = &aimlv1beta1.PachdIngressOptions{}
+		pd.Spec.Dashd.Ingress = &aimlv1beta1.IngressOptions{}
+		components, err = Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components.Ingresses()).To(BeEmpty())
+
+		pd.Spec.Dashd.URL = "dash.example.com"
+		pd.Spec.Dashd.Disable = true
+		components, err = Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components.Ingresses()).To(BeEmpty())
+	})
+
+	It("routes the dash url to the dash service", func() {
+		className := "nginx"
+		pd.Spec.Dashd.URL = "dash.example.com"
+		pd.Spec.Dashd.Ingress = &aimlv1beta1.IngressOptions{
+			ClassName:     &className,
+			TLSSecretName: "dash-certificate",
+			Annotations:   map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "true"},
+		}
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		ing := components.DashIngress()
+		Expect(ing).NotTo(BeNil())
+		Expect(ing.Name).To(Equal("pachyderm-dash"))
+		Expect(ing.Labels).To(HaveKeyWithValue(InstanceLabel, pd.Name))
+		Expect(ing.Annotations).To(Equal(pd.Spec.Dashd.Ingress.Annotations))
+		Expect(ing.Spec.IngressClassName).To(Equal(&className))
+
+		Expect(ing.Spec.Rules).To(HaveLen(1))
+		Expect(ing.Spec.Rules[0].Host).To(Equal("dash.example.com"))
+		Expect(*ing.Spec.Rules[0].HTTP.Paths[0].PathType).To(Equal(networkingv1.PathTypePrefix))
+		Expect(ing.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/"))
+		service, port := backend(ing.Spec.Rules[0])
+		Expect(service).To(Equal(components.DashService().Name))
+		Expect(port).To(Equal("dash-http"))
+
+		Expect(ing.Spec.TLS).To(Equal([]networkingv1.IngressTLS{
+			{Hosts: []string{"dash.example.com"}, SecretName: "dash-certificate"},
+		}))
+	})
+
+	It("routes the pachd hosts to the gRPC API and S3 gateway", func() {
+		pd.Spec.Pachd.Ingress = &aimlv1beta1.PachdIngressOptions{
+			IngressOptions: aimlv1beta1.IngressOptions{Path: "/pachd", PathType: "Exact"},
+			Host:           "pachd.example.com",
+			S3GatewayHost:  "s3.example.com",
+		}
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		ing := components.PachdIngress()
+		Expect(ing).NotTo(BeNil())
+		Expect(ing.Spec.TLS).To(BeEmpty())
+		Expect(ing.Spec.Rules).To(HaveLen(2))
+
+		ports := map[string]string{}
+		for _, rule := range ing.Spec.Rules {
+			Expect(rule.HTTP.Paths[0].Path).To(Equal("/pachd"))
+			Expect(*rule.HTTP.Paths[0].PathType).To(Equal(networkingv1.PathTypeExact))
+			service, port := backend(rule)
+			Expect(service).To(Equal(components.PachdService().Name))
+			ports[rule.Host] = port
+		}
+		Expect(ports).To(Equal(map[string]string{
+			"pachd.example.com": "api-grpc-port",
+			"s3.example.com":    "s3gateway-port",
+		}))
+	})
+})
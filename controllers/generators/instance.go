@@ -0,0 +1,243 @@
+package generators
+
+import (
+	"fmt"
+	"strings"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// InstanceLabel is the label identifying the
+	// Pachyderm resource that a component belongs to
+	InstanceLabel = "aiml.pachyderm.com/instance"
+	// InstanceNamespaceLabel is the label identifying the namespace of
+	// the Pachyderm resource that a cluster scoped component belongs to
+	InstanceNamespaceLabel = "aiml.pachyderm.com/instance-namespace"
+)
+
+// LegacyNames returns true if the objects of the pachyderm resource
+// keep the unprefixed names used by earlier versions of the operator
+func LegacyNames(pd *aimlv1beta1.Pachyderm) bool {
+	return pd.Annotations[aimlv1beta1.NamingAnnotation] == aimlv1beta1.NamingLegacy
+}
+
+// instanceName returns the name of a component
+// object owned by the pachyderm resource
+func instanceName(pd *aimlv1beta1.Pachyderm, name string) string {
+	if LegacyNames(pd) {
+		return name
+	}
+	return fmt.Sprintf("%s-%s", pd.Name, name)
+}
+
+// clusterInstanceName returns the name of a cluster
+// scoped object owned by the pachyderm resource
+func clusterInstanceName(pd *aimlv1beta1.Pachyderm, name string) string {
+	return fmt.Sprintf("%s-%s-%s", pd.Namespace, pd.Name, name)
+}
+
+// LegacyClusterName returns the unprefixed name given by earlier
+// versions of the operator to a cluster scoped object
+func LegacyClusterName(pd *aimlv1beta1.Pachyderm, name string) string {
+	return strings.TrimPrefix(name, clusterInstanceName(pd, ""))
+}
+
+// ClusterOwnerLabels returns the labels identifying cluster
+// scoped objects that belong to the pachyderm resource
+func ClusterOwnerLabels(pd *aimlv1beta1.Pachyderm) map[string]string {
+	return map[string]string{
+		InstanceLabel:          pd.Name,
+		InstanceNamespaceLabel: pd.Namespace,
+	}
+}
+
+// setClusterInstanceMeta prefixes the name of a cluster scoped object
+// with the pachyderm resource namespace and name, and labels the object.
+// Cluster scoped objects can not be owned by namespaced objects, so the
+// labels are used to find them when the pachyderm resource is deleted.
+func setClusterInstanceMeta(obj *metav1.ObjectMeta, pd *aimlv1beta1.Pachyderm) {
+	obj.Name = clusterInstanceName(pd, obj.Name)
+	obj.Namespace = ""
+	if obj.Labels == nil {
+		obj.Labels = map[string]string{}
+	}
+	for key, value := range ClusterOwnerLabels(pd) {
+		obj.Labels[key] = value
+	}
+}
+
+// setInstanceLabel adds the instance label to a set of labels
+func setInstanceLabel(labels map[string]string, pd *aimlv1beta1.Pachyderm) map[string]string {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[InstanceLabel] = pd.Name
+	return labels
+}
+
+// setInstanceMeta prefixes the object name with
+// the pachyderm resource name and labels the object
+func setInstanceMeta(obj *metav1.ObjectMeta, pd *aimlv1beta1.Pachyderm) {
+	obj.Name = instanceName(pd, obj.Name)
+	obj.Labels = setInstanceLabel(obj.Labels, pd)
+}
+
+// setInstanceNames renames all objects parsed from the manifests
+// and rewrites the references between them, so that each pachyderm
+// resource owns an isolated set of components
+func (c *PachydermComponents) setInstanceNames(pd *aimlv1beta1.Pachyderm) {
+	for i := range c.ServiceAccounts {
+		setInstanceMeta(&c.ServiceAccounts[i].ObjectMeta, pd)
+	}
+
+	for _, secret := range c.secrets {
+		setInstanceMeta(&secret.ObjectMeta, pd)
+	}
+
+	for _, cm := range c.configMaps {
+		setInstanceMeta(&cm.ObjectMeta, pd)
+	}
+
+	for i := range c.Roles {
+		setInstanceMeta(&c.Roles[i].ObjectMeta, pd)
+	}
+
+	for i := range c.RoleBindings {
+		rb := &c.RoleBindings[i]
+		setInstanceMeta(&rb.ObjectMeta, pd)
+		rb.RoleRef.Name = instanceName(pd, rb.RoleRef.Name)
+		for j := range rb.Subjects {
+			rb.Subjects[j].Name = instanceName(pd, rb.Subjects[j].Name)
+		}
+	}
+
+	for i := range c.ClusterRoles {
+		setClusterInstanceMeta(&c.ClusterRoles[i].ObjectMeta, pd)
+	}
+
+	for i := range c.ClusterRoleBindings {
+		crb := &c.ClusterRoleBindings[i]
+		setClusterInstanceMeta(&crb.ObjectMeta, pd)
+		crb.RoleRef.Name = clusterInstanceName(pd, crb.RoleRef.Name)
+		for j := range crb.Subjects {
+			crb.Subjects[j].Name = instanceName(pd, crb.Subjects[j].Name)
+		}
+	}
+
+	for i := range c.Services {
+		svc := &c.Services[i]
+		setInstanceMeta(&svc.ObjectMeta, pd)
+		if !LegacyNames(pd) {
+			svc.Spec.Selector = setInstanceLabel(svc.Spec.Selector, pd)
+		}
+	}
+
+	for _, deploy := range []*appsv1.Deployment{c.pachdDeploy, c.dashDeploy} {
+		if deploy == nil {
+			continue
+		}
+		setInstanceMeta(&deploy.ObjectMeta, pd)
+		deploy.Spec.Selector = setInstanceSelector(deploy.Spec.Selector, pd)
+		deploy.Spec.Template.Labels = setInstanceLabel(deploy.Spec.Template.Labels, pd)
+		setPodReferences(&deploy.Spec.Template.Spec, pd)
+	}
+
+	for _, sts := range []*appsv1.StatefulSet{c.etcdStatefulSet, c.postgreStatefulSet} {
+		if sts == nil {
+			continue
+		}
+		setInstanceMeta(&sts.ObjectMeta, pd)
+		sts.Spec.Selector = setInstanceSelector(sts.Spec.Selector, pd)
+		sts.Spec.Template.Labels = setInstanceLabel(sts.Spec.Template.Labels, pd)
+		setPodReferences(&sts.Spec.Template.Spec, pd)
+
+		// point pod DNS names at the renamed governing service
+		headless := sts.Spec.ServiceName
+		sts.Spec.ServiceName = instanceName(pd, headless)
+		for j := range sts.Spec.Template.Spec.Containers {
+			container := &sts.Spec.Template.Spec.Containers[j]
+			for k, arg := range container.Args {
+				container.Args[k] = strings.ReplaceAll(arg,
+					fmt.Sprintf(".%s.", headless),
+					fmt.Sprintf(".%s.", sts.Spec.ServiceName))
+			}
+		}
+
+		for j := range sts.Spec.VolumeClaimTemplates {
+			vct := &sts.Spec.VolumeClaimTemplates[j]
+			vct.Labels = setInstanceLabel(vct.Labels, pd)
+		}
+	}
+
+	if c.Pod != nil {
+		setInstanceMeta(&c.Pod.ObjectMeta, pd)
+		for j := range c.Pod.Spec.Containers {
+			container := &c.Pod.Spec.Containers[j]
+			for k, arg := range container.Args {
+				container.Args[k] = strings.ReplaceAll(arg,
+					"nc -vz pachd-peer ",
+					fmt.Sprintf("nc -vz %s ", instanceName(pd, "pachd-peer")))
+			}
+		}
+	}
+}
+
+// setInstanceSelector adds the instance label to a label selector.
+// Selectors of workloads are immutable, so legacy selectors are kept.
+func setInstanceSelector(selector *metav1.LabelSelector, pd *aimlv1beta1.Pachyderm) *metav1.LabelSelector {
+	if selector == nil {
+		selector = &metav1.LabelSelector{}
+	}
+	if LegacyNames(pd) {
+		return selector
+	}
+	selector.MatchLabels = setInstanceLabel(selector.MatchLabels, pd)
+	return selector
+}
+
+// setPodReferences renames the service account, secrets
+// and config maps referenced by a pod template
+func setPodReferences(spec *corev1.PodSpec, pd *aimlv1beta1.Pachyderm) {
+	if spec.ServiceAccountName != "" {
+		spec.ServiceAccountName = instanceName(pd, spec.ServiceAccountName)
+	}
+
+	for i := range spec.Volumes {
+		volume := &spec.Volumes[i]
+		if volume.Secret != nil {
+			volume.Secret.SecretName = instanceName(pd, volume.Secret.SecretName)
+		}
+		if volume.ConfigMap != nil {
+			volume.ConfigMap.Name = instanceName(pd, volume.ConfigMap.Name)
+		}
+	}
+
+	for i := range spec.Containers {
+		for j := range spec.Containers[i].EnvFrom {
+			envFrom := &spec.Containers[i].EnvFrom[j]
+			if envFrom.SecretRef != nil {
+				envFrom.SecretRef.Name = instanceName(pd, envFrom.SecretRef.Name)
+			}
+			if envFrom.ConfigMapRef != nil {
+				envFrom.ConfigMapRef.Name = instanceName(pd, envFrom.ConfigMapRef.Name)
+			}
+		}
+	}
+}
+
+// setEnvVar sets the value of an environment variable,
+// adding the variable if it is not already set
+func setEnvVar(envs []corev1.EnvVar, name, value string) []corev1.EnvVar {
+	for i := range envs {
+		if envs[i].Name == name {
+			envs[i].Value = value
+			envs[i].ValueFrom = nil
+			return envs
+		}
+	}
+	return append(envs, corev1.EnvVar{Name: name, Value: value})
+}
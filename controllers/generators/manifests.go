@@ -5,26 +5,30 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"strings"
 
 	goyaml "github.com/go-yaml/yaml"
 	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 )
 
 // PachydermComponents is a structure that contains a slice of
 // all the Kubernetes resources that make up a Pachyderm deployment
 type PachydermComponents struct {
 	gcsCredentials      []byte
+	storageCredentials  StorageCredentials
+	currentSecrets      map[string]*corev1.Secret
+	ca                  *certificateAuthority
 	pachyderm           *aimlv1beta1.Pachyderm
 	dashDeploy          *appsv1.Deployment
 	pachdDeploy         *appsv1.Deployment
@@ -50,51 +54,58 @@ func (c *PachydermComponents) getGCSCredentials() []byte {
 	return c.gcsCredentials
 }
 
-// PachydermError defines custom error
-// type used by the operator
-type PachydermError string
-
-func (e PachydermError) Error() string {
-	return string(e)
+// StorageCredentials holds the credentials read from the secret
+// keys referenced by the pachyderm resource. Credentials are only
+// set if the matching secret reference is used.
+type StorageCredentials struct {
+	// Access ID of the object storage backend
+	ID []byte
+	// Secret key of the object storage backend
+	Secret []byte
+	// Session token of the object storage backend
+	Token []byte
+	// Password of the postgresql user
+	PostgresPassword []byte
 }
 
-func getManifestPath(version string) string {
-	manifestPath := filepath.Join("/", "manifests", version[1:], "manifests.yaml")
+// SetStorageCredentials sets the credentials
+// used to populate the storage secret
+func (c *PachydermComponents) SetStorageCredentials(credentials StorageCredentials) {
+	c.storageCredentials = credentials
+}
 
-	// Check operator is not running in Openshift
-	if !isKubernetes() {
-		wd, err := os.Getwd()
-		if err != nil {
-			return manifestPath
-		}
-		manifestPath = filepath.Join(wd, "hack", "manifests", version, "manifests.yaml")
+// credential returns the value read from a secret reference,
+// falling back to the deprecated plaintext value
+func credential(fromSecret []byte, value string) []byte {
+	if fromSecret != nil {
+		return fromSecret
 	}
-	return manifestPath
+	return toBytes(value)
 }
 
-// isKubernetes() function checks if the pod is
-// runnign in a Kubernetes environment
-func isKubernetes() bool {
-	const serviceAccountMount string = "/run/secrets/kubernetes.io/serviceaccount"
+// PachydermError defines custom error
+// type used by the operator
+type PachydermError string
 
-	fileInfo, err := os.Stat(serviceAccountMount)
-	if err != nil {
-		// if file is not found
-		return false
-	}
+func (e PachydermError) Error() string {
+	return string(e)
+}
 
-	// check if Kubernetes port environment variable exists
-	_, ok := os.LookupEnv("KUBERNETES_PORT")
+// manifestCatalog provides the manifests of each Pachyderm version
+var manifestCatalog catalog.Catalog = catalog.Embedded()
 
-	return fileInfo.IsDir() && ok
+// SetCatalog sets the catalog providing the manifests
+// of the Pachyderm versions deployed by the operator
+func SetCatalog(c catalog.Catalog) {
+	manifestCatalog = c
+	parsedManifests.reset()
 }
 
 func loadManifests(version string) ([][]byte, error) {
 	var objects [][]byte
 
-	// Read manifests from file
-	manifestPath := getManifestPath(version)
-	data, err := ioutil.ReadFile(manifestPath)
+	// Read manifests from the catalog
+	data, err := manifestCatalog.Manifests(version)
 	if err != nil {
 		return nil, err
 	}
@@ -103,8 +114,15 @@ func loadManifests(version string) ([][]byte, error) {
 	decodr := goyaml.NewDecoder(bytes.NewReader(data))
 	for {
 		var value interface{}
-		if err := decodr.Decode(&value); err == io.EOF {
-			break
+		if err := decodr.Decode(&value); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		// skip empty documents
+		if value == nil {
+			continue
 		}
 		valueBytes, err := goyaml.Marshal(value)
 		if err != nil {
@@ -116,73 +134,66 @@ func loadManifests(version string) ([][]byte, error) {
 	return objects, nil
 }
 
-func getPachydermComponents(pd *aimlv1beta1.Pachyderm) *PachydermComponents {
+func getPachydermComponents(pd *aimlv1beta1.Pachyderm) (*PachydermComponents, error) {
 	components := &PachydermComponents{}
 
-	manifests, err := loadManifests(pd.Spec.Version)
+	objects, err := parsedManifests.get(pd.Spec.Version)
 	if err != nil {
-		fmt.Println("error reading manifests.", err.Error())
+		return nil, fmt.Errorf("unable to read the manifests of version %s: %w", pd.Spec.Version, err)
 	}
 
-	for _, doc := range manifests {
-		yamlDecoder := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
-		obj := &unstructured.Unstructured{}
-		_, gvk, err := yamlDecoder.Decode(doc, nil, obj)
-		if err != nil {
-			fmt.Println("error converting to unstructured type.", err.Error())
-		}
-
+	for _, obj := range objects {
 		// Convert from unstructured.Unstructured to kubernetes types
-		switch gvk.Kind {
+		switch obj.GetKind() {
 		case "Deployment":
 			if err := components.parseDeployment(obj, pd.Namespace); err != nil {
-				fmt.Println("error parsing deployment.", err.Error())
+				return nil, fmt.Errorf("unable to parse the manifest of a deployment: %w", err)
 			}
 		case "StatefulSet":
 			if err := components.parseStatefulSet(obj, pd.Namespace); err != nil {
-				fmt.Println("error parsing statefulset.", err.Error())
+				return nil, fmt.Errorf("unable to parse the manifest of a statefulset: %w", err)
 			}
 		case "Pod":
 			if err := components.parsePod(obj, pd.Namespace); err != nil {
-				fmt.Println("error parsing pod.", err.Error())
+				return nil, fmt.Errorf("unable to parse the manifest of a pod: %w", err)
 			}
 		case "ServiceAccount":
 			var sa corev1.ServiceAccount
 			if err := toTypedResource(obj, &sa); err != nil {
-				fmt.Println("error converting to service account.", err.Error())
+				return nil, fmt.Errorf("unable to convert the manifest to a service account: %w", err)
 			}
 			sa.Namespace = pd.Namespace
 			components.ServiceAccounts = append(components.ServiceAccounts, sa)
 		case "Secret":
 			var secret corev1.Secret
 			if err := toTypedResource(obj, &secret); err != nil {
-				fmt.Println("error converting to secret.", err.Error())
+				return nil, fmt.Errorf("unable to convert the manifest to a secret: %w", err)
 			}
 			secret.Namespace = pd.Namespace
 			components.secrets = append(components.secrets, &secret)
 		case "ConfigMap":
 			var cm corev1.ConfigMap
 			if err := toTypedResource(obj, &cm); err != nil {
-				fmt.Println("error converting to config map.", err.Error())
+				return nil, fmt.Errorf("unable to convert the manifest to a config map: %w", err)
 			}
 			cm.Namespace = pd.Namespace
 			components.configMaps = append(components.configMaps, &cm)
 		case "StorageClass":
 			var sc storagev1.StorageClass
 			if err := toTypedResource(obj, &sc); err != nil {
-				fmt.Println("error converting to secret.", err.Error())
+				return nil, fmt.Errorf("unable to convert the manifest to a storage class: %w", err)
 			}
 			components.storageClass = sc
 		case "ClusterRole":
 			var clusterrole rbacv1.ClusterRole
 			if err := toTypedResource(obj, &clusterrole); err != nil {
-				fmt.Println("error converting to cluster role.", err.Error())
+				return nil, fmt.Errorf("unable to convert the manifest to a cluster role: %w", err)
 			}
 			components.ClusterRoles = append(components.ClusterRoles, clusterrole)
 		case "ClusterRoleBinding":
 			var clusterRoleBinding rbacv1.ClusterRoleBinding
 			if err := toTypedResource(obj, &clusterRoleBinding); err != nil {
-				fmt.Println("error converting to cluster role.", err.Error())
+				return nil, fmt.Errorf("unable to convert the manifest to a cluster role binding: %w", err)
 			}
 			for i := range clusterRoleBinding.Subjects {
 				clusterRoleBinding.Subjects[i].Namespace = pd.Namespace
@@ -191,34 +202,95 @@ func getPachydermComponents(pd *aimlv1beta1.Pachyderm) *PachydermComponents {
 		case "Role":
 			var role rbacv1.Role
 			if err := toTypedResource(obj, &role); err != nil {
-				fmt.Println("error converting to cluster role.", err.Error())
+				return nil, fmt.Errorf("unable to convert the manifest to a role: %w", err)
 			}
 			role.Namespace = pd.Namespace
 			components.Roles = append(components.Roles, role)
 		case "RoleBinding":
 			var roleBinding rbacv1.RoleBinding
 			if err := toTypedResource(obj, &roleBinding); err != nil {
-				fmt.Println("error converting to cluster role.", err.Error())
+				return nil, fmt.Errorf("unable to convert the manifest to a role binding: %w", err)
 			}
 			roleBinding.Namespace = pd.Namespace
 			components.RoleBindings = append(components.RoleBindings, roleBinding)
 		case "Service":
 			var svc corev1.Service
 			if err := toTypedResource(obj, &svc); err != nil {
-				fmt.Println("error converting to cluster role.", err.Error())
+				return nil, fmt.Errorf("unable to convert the manifest to a service: %w", err)
 			}
 			svc.Namespace = pd.Namespace
 			components.Services = append(components.Services, svc)
 		}
 	}
 
-	return components
+	// prefix objects with the pachyderm resource name
+	components.setInstanceNames(pd)
+
+	return components, nil
 }
 
 func toTypedResource(unstructured *unstructured.Unstructured, object interface{}) error {
 	return runtime.DefaultUnstructuredConverter.FromUnstructured(unstructured.Object, object)
 }
 
+// setContainerResources sets the resource requests and limits
+// of a container if provided in the pachyderm resource
+func setContainerResources(container *corev1.Container, resources *corev1.ResourceRequirements) {
+	if resources == nil {
+		return
+	}
+
+	if resources.Limits != nil {
+		container.Resources.Limits = resources.Limits
+	}
+
+	if resources.Requests != nil {
+		container.Resources.Requests = resources.Requests
+	}
+}
+
+// setContainerImage applies the user provided
+// image overrides to a container
+func setContainerImage(container *corev1.Container, image *aimlv1beta1.ImageOverride) {
+	if image == nil {
+		return
+	}
+
+	if image.Repository != "" {
+		tag := image.ImageTag
+		if tag == "" {
+			tag = imageTag(container.Image)
+		}
+
+		container.Image = image.Repository
+		if tag != "" {
+			container.Image = strings.Join([]string{image.Repository, tag}, ":")
+		}
+	} else if image.ImageTag != "" {
+		container.Image = strings.Join([]string{imageRepository(container.Image), image.ImageTag}, ":")
+	}
+
+	if image.PullPolicy != "" {
+		container.ImagePullPolicy = corev1.PullPolicy(image.PullPolicy)
+	}
+}
+
+// imageRepository returns the image without the tag
+func imageRepository(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+	return image
+}
+
+// imageTag returns the tag of an image
+func imageTag(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
 func (c *PachydermComponents) parseDeployment(obj *unstructured.Unstructured, namespace string) error {
 	var deployment appsv1.Deployment
 	if err := toTypedResource(obj, &deployment); err != nil {
@@ -242,7 +314,7 @@ func (c *PachydermComponents) parseDeployment(obj *unstructured.Unstructured, na
 func (c *PachydermComponents) parseStatefulSet(obj *unstructured.Unstructured, namespace string) error {
 	var sts appsv1.StatefulSet
 	if err := toTypedResource(obj, &sts); err != nil {
-		fmt.Println("error converting to statefulset.", err.Error())
+		return err
 	}
 
 	if !reflect.DeepEqual(sts, appsv1.StatefulSet{}) {
@@ -334,42 +406,57 @@ func (c *PachydermComponents) StorageClass() *storagev1.StorageClass {
 }
 
 // Secrets returns secrets used by the pachyderm resource
-func (c *PachydermComponents) Secrets() []*corev1.Secret {
-	pd := c.pachyderm
-
+func (c *PachydermComponents) Secrets() ([]*corev1.Secret, error) {
 	for _, secret := range c.secrets {
-		if secret.Name == "pachyderm-storage-secret" {
+		if secret.Name == c.StorageSecretName() {
 			c.setupStorageSecret(secret)
 		}
 
-		if secret.Name == "pachd-tls-cert" {
-			setupPachdTLSSecret(secret, pd)
+		if c.isCertificateSecret(secret.Name) {
+			if err := c.setupCertificateSecret(secret); err != nil {
+				return nil, fmt.Errorf("unable to issue certificate for secret %s: %w", secret.Name, err)
+			}
 		}
 	}
 
-	return c.secrets
+	return c.secrets, nil
 }
 
-func (c *PachydermComponents) ConfgigMaps() []*corev1.ConfigMap {
+func (c *PachydermComponents) ConfgigMaps() ([]*corev1.ConfigMap, error) {
 	for _, cm := range c.configMaps {
 		cm.Namespace = c.pachyderm.Namespace
+
+		if cm.Name == c.CABundleName() {
+			if err := c.setupCABundle(cm); err != nil {
+				return nil, fmt.Errorf("unable to publish the CA bundle %s: %w", cm.Name, err)
+			}
+		}
 	}
-	return c.configMaps
+	return c.configMaps, nil
 }
 
 func (c *PachydermComponents) setupStorageSecret(secret *corev1.Secret) {
 	pd := c.pachyderm
+	creds := c.storageCredentials
 	if pd.Spec.Pachd.Storage.Backend == "local" {
 		secret.Data = map[string][]byte{}
 	}
 
-	if pd.Spec.Pachd.Storage.Backend == "amazon" {
+	// the storage blocks are required by the validating webhook,
+	// but resources created before the webhook was deployed
+	// must not crash the operator
+	if pd.Spec.Pachd.Storage.Backend == "amazon" && pd.Spec.Pachd.Storage.Amazon != nil {
+		reverse := true
+		if pd.Spec.Pachd.Storage.Amazon.Reverse != nil {
+			reverse = *pd.Spec.Pachd.Storage.Amazon.Reverse
+		}
+
 		secret.Data = map[string][]byte{
 			"AMAZON_BUCKET":       toBytes(pd.Spec.Pachd.Storage.Amazon.Bucket),
-			"AMAZON_SECRET":       toBytes(pd.Spec.Pachd.Storage.Amazon.Secret),
+			"AMAZON_SECRET":       credential(creds.Secret, pd.Spec.Pachd.Storage.Amazon.Secret),
 			"AMAZON_REGION":       toBytes(pd.Spec.Pachd.Storage.Amazon.Region),
-			"AMAZON_TOKEN":        toBytes(pd.Spec.Pachd.Storage.Amazon.Token),
-			"AMAZON_ID":           toBytes(pd.Spec.Pachd.Storage.Amazon.ID),
+			"AMAZON_TOKEN":        credential(creds.Token, pd.Spec.Pachd.Storage.Amazon.Token),
+			"AMAZON_ID":           credential(creds.ID, pd.Spec.Pachd.Storage.Amazon.ID),
 			"AMAZON_DISTRIBUTION": toBytes(pd.Spec.Pachd.Storage.Amazon.CloudFrontDistribution),
 			"CUSTOM_ENDPOINT":     toBytes(pd.Spec.Pachd.Storage.Amazon.CustomEndpoint),
 			"DISABLE_SSL":         toBytes(fmt.Sprintf("%t", pd.Spec.Pachd.Storage.Amazon.DisableSSL)),
@@ -378,37 +465,51 @@ func (c *PachydermComponents) setupStorageSecret(secret *corev1.Secret) {
 			"NO_VERIFY_SSL":       toBytes(fmt.Sprintf("%t", pd.Spec.Pachd.Storage.Amazon.VerifySSL)),
 			"PART_SIZE":           toBytes(fmt.Sprintf("%d", pd.Spec.Pachd.Storage.Amazon.PartSize)),
 			"RETRIES":             toBytes(fmt.Sprintf("%d", pd.Spec.Pachd.Storage.Amazon.Retries)),
-			"REVERSE":             toBytes(fmt.Sprintf("%t", *pd.Spec.Pachd.Storage.Amazon.Reverse)),
+			"REVERSE":             toBytes(fmt.Sprintf("%t", reverse)),
 			"TIMEOUT":             toBytes(pd.Spec.Pachd.Storage.Amazon.Timeout),
 			"UPLOAD_ACL":          toBytes(pd.Spec.Pachd.Storage.Amazon.UploadACL),
 		}
 	}
 
-	if pd.Spec.Pachd.Storage.Backend == "minio" {
+	if pd.Spec.Pachd.Storage.Backend == "minio" && pd.Spec.Pachd.Storage.Minio != nil {
 		secret.Data = map[string][]byte{
 			"minio-bucket":    toBytes(pd.Spec.Pachd.Storage.Minio.Bucket),
 			"minio-endpoint":  toBytes(pd.Spec.Pachd.Storage.Minio.Endpoint),
-			"minio-id":        toBytes(pd.Spec.Pachd.Storage.Minio.ID),
-			"minio-secret":    toBytes(pd.Spec.Pachd.Storage.Minio.Secret),
+			"minio-id":        credential(creds.ID, pd.Spec.Pachd.Storage.Minio.ID),
+			"minio-secret":    credential(creds.Secret, pd.Spec.Pachd.Storage.Minio.Secret),
 			"minio-secure":    toBytes(pd.Spec.Pachd.Storage.Minio.Secure),
 			"minio-signature": toBytes(pd.Spec.Pachd.Storage.Minio.Signature),
 		}
 	}
 
-	if pd.Spec.Pachd.Storage.Backend == "google" {
+	if pd.Spec.Pachd.Storage.Backend == "google" && pd.Spec.Pachd.Storage.Google != nil {
 		secret.Data = map[string][]byte{
 			"google-bucket": toBytes(pd.Spec.Pachd.Storage.Google.Bucket),
 			"google-cred":   c.getGCSCredentials(),
 		}
 	}
 
-	if pd.Spec.Pachd.Storage.Backend == "microsoft" {
+	if pd.Spec.Pachd.Storage.Backend == "microsoft" && pd.Spec.Pachd.Storage.Microsoft != nil {
 		secret.Data = map[string][]byte{
 			"microsoft-container": toBytes(pd.Spec.Pachd.Storage.Microsoft.Container),
-			"microsoft-secret":    toBytes(pd.Spec.Pachd.Storage.Microsoft.Secret),
-			"microsoft-id":        toBytes(pd.Spec.Pachd.Storage.Microsoft.ID),
+			"microsoft-secret":    credential(creds.Secret, pd.Spec.Pachd.Storage.Microsoft.Secret),
+			"microsoft-id":        credential(creds.ID, pd.Spec.Pachd.Storage.Microsoft.ID),
 		}
 	}
+
+	// pachd reads the database password from the environment
+	// populated by this secret. Unlike the storage credentials,
+	// the inline password is not base64 encoded by the webhook.
+	password := creds.PostgresPassword
+	if password == nil {
+		password = []byte(pd.Spec.Pachd.Postgres.Password)
+	}
+	if len(password) > 0 {
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data["POSTGRES_PASSWORD"] = password
+	}
 }
 
 // func getGCSCredentialSecret(pd *aimlv1beta1.Pachyderm) ([]byte, error) {
@@ -444,46 +545,81 @@ func toBytes(value string) []byte {
 	return []byte(value)
 }
 
-// generate self-signed TLS secret
-func setupPachdTLSSecret(secret *corev1.Secret, pd *aimlv1beta1.Pachyderm) {
-	rsaKey, err := newPrivateKeyRSA(keyBitSize)
-	if err != nil {
-		fmt.Println("error:", err.Error())
+// EtcdStatefulSet returns the etcd statefulset resource
+func (c *PachydermComponents) EtcdStatefulSet() *appsv1.StatefulSet {
+	pd := c.pachyderm
+	sts := c.etcdStatefulSet
+
+	// set number of etcd nodes
+	if pd.Spec.Etcd.DynamicNodes > 0 {
+		replicas := pd.Spec.Etcd.DynamicNodes
+		sts.Spec.Replicas = &replicas
 	}
 
-	x509Cert, err := newClientCertificate(rsaKey, []string{"example.pachyderm.com"})
-	if err != nil {
-		fmt.Println("error:", err.Error())
+	for i, container := range sts.Spec.Template.Spec.Containers {
+		if container.Name == "etcd" {
+			// set resource requests and limits
+			setContainerResources(&sts.Spec.Template.Spec.Containers[i], pd.Spec.Etcd.Resources)
+			setContainerImage(&sts.Spec.Template.Spec.Containers[i], pd.Spec.Etcd.Image)
+
+			// list all etcd members in the initial cluster
+			for j, arg := range container.Args {
+				sts.Spec.Template.Spec.Containers[i].Args[j] = etcdInitialClusterArg.ReplaceAllLiteralString(arg, etcdInitialCluster(sts, c.etcdPeerScheme()))
+			}
+		}
 	}
 
-	secret.Data = map[string][]byte{
-		"tls.crt": encodeCertificateToPEM(x509Cert),
-		"tls.key": encodePrivateKeyToPEM(rsaKey),
+	if c.PachdTLSEnabled() {
+		c.setupEtcdTLS(&sts.Spec.Template.Spec)
 	}
-}
 
-// EtcdStatefulSet returns the etcd statefulset resource
-func (c *PachydermComponents) EtcdStatefulSet() *appsv1.StatefulSet {
-	pd := c.pachyderm
+	c.setConfigChecksums(&sts.Spec.Template)
+
+	// scale down after the initial cluster is listed,
+	// so pausing etcd does not change its pod template
+	setPausedReplicas(&sts.Spec.Replicas, EtcdPaused(pd))
 
-	// set resource requests and limits
-	if !reflect.DeepEqual(pd.Spec.Etcd, aimlv1beta1.EtcdOptions{}) {
-		for _, container := range c.etcdStatefulSet.Spec.Template.Spec.Containers {
-			if container.Name == "etcd" {
-				if pd.Spec.Etcd.Resources != nil {
-					container.Resources.Limits = pd.Spec.Etcd.Resources.Limits
-					container.Resources.Requests = pd.Spec.Etcd.Resources.Requests
+	for i := range sts.Spec.VolumeClaimTemplates {
+		sts.Spec.VolumeClaimTemplates[i].Namespace = pd.Namespace
+
+		// set etcd storage class
+		if pd.Spec.Etcd.StorageClass != "" {
+			storageClass := pd.Spec.Etcd.StorageClass
+			sts.Spec.VolumeClaimTemplates[i].Spec.StorageClassName = &storageClass
+		}
+
+		// set etcd storage size
+		if pd.Spec.Etcd.StorageSize != "" {
+			if size, err := resource.ParseQuantity(pd.Spec.Etcd.StorageSize); err == nil {
+				if sts.Spec.VolumeClaimTemplates[i].Spec.Resources.Requests == nil {
+					sts.Spec.VolumeClaimTemplates[i].Spec.Resources.Requests = corev1.ResourceList{}
 				}
+				sts.Spec.VolumeClaimTemplates[i].Spec.Resources.Requests[corev1.ResourceStorage] = size
 			}
 		}
 	}
 
-	// set etcd storage class
-	for i := range c.etcdStatefulSet.Spec.VolumeClaimTemplates {
-		c.etcdStatefulSet.Spec.VolumeClaimTemplates[i].Namespace = pd.Namespace
+	return sts
+}
+
+var etcdInitialClusterArg = regexp.MustCompile(`--initial-cluster=[^"\s]*`)
+
+// etcdInitialCluster returns the --initial-cluster
+// flag listing every member of the etcd statefulset
+func etcdInitialCluster(sts *appsv1.StatefulSet, scheme string) string {
+	var replicas int32 = 1
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+
+	members := []string{}
+	for i := int32(0); i < replicas; i++ {
+		member := fmt.Sprintf("%s-%d", sts.Name, i)
+		members = append(members,
+			fmt.Sprintf("%s=%s://%s.%s.${NAMESPACE}.svc.cluster.local:2380", member, scheme, member, sts.Spec.ServiceName))
 	}
 
-	return c.etcdStatefulSet
+	return "--initial-cluster=" + strings.Join(members, ",")
 }
 
 // PachdDeployment returns the pachd deployment resource
@@ -493,15 +629,17 @@ func (c *PachydermComponents) PachdDeployment() *appsv1.Deployment {
 
 	for i, container := range deploy.Spec.Template.Spec.Containers {
 		if container.Name == "pachd" {
-			deploy.Spec.Template.Spec.Containers[i].Env = pachdEnvVarirables(c.pachyderm)
+			deploy.Spec.Template.Spec.Containers[i].Env = c.pachdInstanceEnv(pachdEnvVarirables(c.pachyderm))
+			setContainerResources(&deploy.Spec.Template.Spec.Containers[i], &pachyderm.Spec.Pachd.Resources)
+			setContainerImage(&deploy.Spec.Template.Spec.Containers[i], pachyderm.Spec.Pachd.Image)
 		}
 	}
 
-	if pachyderm.Spec.Pachd.Storage.Backend == "local" {
-		for _, volume := range deploy.Spec.Template.Spec.Volumes {
+	if pachyderm.Spec.Pachd.Storage.Backend == "local" && pachyderm.Spec.Pachd.Storage.Local != nil {
+		for i, volume := range deploy.Spec.Template.Spec.Volumes {
 			if volume.Name == "pach-disk" {
 				dirOrCreate := corev1.HostPathDirectoryOrCreate
-				volume = corev1.Volume{
+				deploy.Spec.Template.Spec.Volumes[i] = corev1.Volume{
 					Name: "pach-disk",
 					VolumeSource: corev1.VolumeSource{
 						HostPath: &corev1.HostPathVolumeSource{
@@ -514,24 +652,170 @@ func (c *PachydermComponents) PachdDeployment() *appsv1.Deployment {
 		}
 	}
 
+	if pachdTLSEnabled(pachyderm) {
+		c.mountPachdTLSSecret(&deploy.Spec.Template.Spec)
+		c.mountCABundle(&deploy.Spec.Template.Spec, "pachd")
+	}
+
+	// roll out pachd when its configuration changes,
+	// since pachd reads the storage secret from the environment
+	c.setConfigChecksums(&deploy.Spec.Template)
+	setPausedReplicas(&deploy.Spec.Replicas, Paused(pachyderm))
+
 	return c.pachdDeploy
 }
 
+// pachdInstanceEnv points pachd at the
+// services owned by the pachyderm resource
+func (c *PachydermComponents) pachdInstanceEnv(envs []corev1.EnvVar) []corev1.EnvVar {
+	pd := c.pachyderm
+
+	if postgres := c.instancePostgres(); postgres != nil {
+		envs = setEnvVar(envs, "POSTGRES_HOST", postgres.Name)
+	}
+
+	if c.postgresTLSVerified() {
+		envs = setEnvVar(envs, "POSTGRES_SERVICE_SSL", postgresSSLMode)
+		envs = setEnvVar(envs, "PGSSLROOTCERT", filepath.Join(caBundleMountPath, CABundleKey))
+	}
+
+	if etcd := c.EtcdService(); etcd != nil {
+		envs = setEnvVar(envs, "ETCD_SERVICE_HOST", etcd.Name)
+		if port, ok := ServicePort(etcd, "client-port"); ok {
+			envs = setEnvVar(envs, "ETCD_SERVICE_PORT", fmt.Sprintf("%d", port))
+		}
+	}
+
+	if pd.Spec.Worker != nil && pd.Spec.Worker.ServiceAccountName == "pachyderm-worker" {
+		envs = setEnvVar(envs, "WORKER_SERVICE_ACCOUNT", instanceName(pd, "pachyderm-worker"))
+	}
+
+	return envs
+}
+
 // DashDeployment returns the dash deployment resource
 func (c *PachydermComponents) DashDeployment() *appsv1.Deployment {
-	return c.dashDeploy
+	deploy := c.dashDeploy
+	setPausedReplicas(&deploy.Spec.Replicas, Paused(c.pachyderm))
+
+	peer := c.PachdPeerService()
+	if peer == nil {
+		return deploy
+	}
+	port, _ := ServicePort(peer, "api-grpc-peer-port")
+
+	for i, container := range deploy.Spec.Template.Spec.Containers {
+		if container.Name == "dash" {
+			deploy.Spec.Template.Spec.Containers[i].Env = setEnvVar(container.Env, "PACHD_ADDRESS",
+				fmt.Sprintf("%s.%s.svc.cluster.local:%d", peer.Name, peer.Namespace, port))
+		}
+	}
+	c.setConfigChecksums(&deploy.Spec.Template)
+
+	return deploy
 }
 
 // PostgreStatefulset returns the postgresql statefulset resource
 func (c *PachydermComponents) PostgreStatefulset() *appsv1.StatefulSet {
-	return c.postgreStatefulSet
+	sts := c.postgreStatefulSet
+	if c.PachdTLSEnabled() {
+		c.setupPostgresTLS(&sts.Spec.Template.Spec)
+	}
+	c.setConfigChecksums(&sts.Spec.Template)
+	return sts
+}
+
+// instancePostgres returns the postgresql service of this instance
+// if pachd uses it, or nil if an external database is configured
+func (c *PachydermComponents) instancePostgres() *corev1.Service {
+	host := c.pachyderm.Spec.Pachd.Postgres.Host
+	if host != "" && host != "postgres" {
+		return nil
+	}
+	return c.PostgresService()
+}
+
+// service returns the service with the given name
+func (c *PachydermComponents) service(name string) *corev1.Service {
+	for i := range c.Services {
+		if c.Services[i].Name == name {
+			return &c.Services[i]
+		}
+	}
+	return nil
+}
+
+// EtcdService returns the service used by clients to connect to etcd
+func (c *PachydermComponents) EtcdService() *corev1.Service {
+	return c.service(instanceName(c.pachyderm, "etcd"))
+}
+
+// PostgresService returns the service used by clients to connect to postgresql
+func (c *PachydermComponents) PostgresService() *corev1.Service {
+	return c.service(instanceName(c.pachyderm, "postgres"))
+}
+
+// PachdService returns the service exposing the pachd APIs
+func (c *PachydermComponents) PachdService() *corev1.Service {
+	return c.service(instanceName(c.pachyderm, "pachd"))
+}
+
+// PachdPeerService returns the service used by pachd peers and workers
+func (c *PachydermComponents) PachdPeerService() *corev1.Service {
+	return c.service(instanceName(c.pachyderm, "pachd-peer"))
+}
+
+// DashService returns the service exposing the dash UI
+func (c *PachydermComponents) DashService() *corev1.Service {
+	return c.service(instanceName(c.pachyderm, "dash"))
+}
+
+// PachdTLSSecretName returns the name of the
+// secret holding the pachd TLS certificate
+func (c *PachydermComponents) PachdTLSSecretName() string {
+	if opts := c.pachdCertificateOptions(); opts != nil && opts.SecretName != "" {
+		return opts.SecretName
+	}
+	return instanceName(c.pachyderm, "pachd-tls-cert")
+}
+
+// StorageSecretName returns the name of the secret
+// holding the object storage configuration for pachd
+func (c *PachydermComponents) StorageSecretName() string {
+	return instanceName(c.pachyderm, "pachyderm-storage-secret")
+}
+
+// ServicePort returns the port of a
+// service with the given port name
+func ServicePort(svc *corev1.Service, name string) (int32, bool) {
+	for _, port := range svc.Spec.Ports {
+		if port.Name == name {
+			return port.Port, true
+		}
+	}
+	return 0, false
 }
 
 // Prepare takes a pachyderm custom resource and returns
-// child resources based on the pachyderm custom resource
-func Prepare(pd *aimlv1beta1.Pachyderm) *PachydermComponents {
-	components := getPachydermComponents(pd)
+// child resources based on the pachyderm custom resource.
+// An error is returned if the manifests of the version
+// can not be read from the version catalog.
+func Prepare(pd *aimlv1beta1.Pachyderm) (*PachydermComponents, error) {
+	components, err := getPachydermComponents(pd)
+	if err != nil {
+		return nil, err
+	}
+
 	// set pachyderm resource as parent
 	components.pachyderm = pd
-	return components
+
+	// issue certificates from the instance CA,
+	// securing etcd and postgresql along with pachd
+	if pachdTLSEnabled(pd) {
+		components.secrets = append(components.secrets, components.newCertificateSecrets()...)
+		components.configMaps = append(components.configMaps, components.newCABundle())
+		components.addEtcdClientTLSPort()
+	}
+
+	return components, nil
 }
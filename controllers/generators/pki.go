@@ -0,0 +1,353 @@
+package generators
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CABundleKey is the key of the CA bundle config map
+// holding the certificate of the instance CA
+const CABundleKey = "ca.crt"
+
+// certificateAuthority is the CA issuing the
+// certificates of a pachyderm instance
+type certificateAuthority struct {
+	cert    *x509.Certificate
+	key     *rsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// certificateSpec describes a certificate issued by the instance CA
+type certificateSpec struct {
+	secretName string
+	app        string
+	commonName string
+	hosts      []string
+	usages     []x509.ExtKeyUsage
+}
+
+// CASecretName returns the name of the secret holding the instance CA
+func (c *PachydermComponents) CASecretName() string {
+	return instanceName(c.pachyderm, "pachyderm-ca")
+}
+
+// CABundleName returns the name of the config map
+// publishing the instance CA certificate to clients
+func (c *PachydermComponents) CABundleName() string {
+	return instanceName(c.pachyderm, "pachyderm-ca-bundle")
+}
+
+// EtcdClientTLSSecretName returns the name of the secret
+// holding the certificate etcd serves to its clients
+func (c *PachydermComponents) EtcdClientTLSSecretName() string {
+	return instanceName(c.pachyderm, "etcd-client-tls")
+}
+
+// EtcdPeerTLSSecretName returns the name of the
+// secret holding the etcd peer certificate
+func (c *PachydermComponents) EtcdPeerTLSSecretName() string {
+	return instanceName(c.pachyderm, "etcd-peer-tls")
+}
+
+// PostgresTLSSecretName returns the name of the
+// secret holding the postgresql server certificate
+func (c *PachydermComponents) PostgresTLSSecretName() string {
+	return instanceName(c.pachyderm, "postgres-tls")
+}
+
+// SetCurrentSecret passes a secret read from the cluster to the
+// generators. Certificates in the current secrets are reused while
+// they are valid and are not about to expire.
+func (c *PachydermComponents) SetCurrentSecret(secret *corev1.Secret) {
+	if c.currentSecrets == nil {
+		c.currentSecrets = map[string]*corev1.Secret{}
+	}
+	c.currentSecrets[secret.Name] = secret
+}
+
+// CertificateSecretNames returns the names of the secrets holding
+// the instance CA, the certificates it issued and the pachd
+// certificate if it is provided by the user or cert-manager
+func (c *PachydermComponents) CertificateSecretNames() []string {
+	names := []string{c.CASecretName()}
+	for _, spec := range c.certificateSpecs() {
+		names = append(names, spec.secretName)
+	}
+	if c.PachdTLSEnabled() && !c.PachdTLSIssuedByCA() {
+		names = append(names, c.PachdTLSSecretName())
+	}
+	return names
+}
+
+// serviceHosts returns the DNS names of a service
+func serviceHosts(svc *corev1.Service) []string {
+	if svc == nil {
+		return []string{}
+	}
+
+	return []string{
+		svc.Name,
+		fmt.Sprintf("%s.%s", svc.Name, svc.Namespace),
+		fmt.Sprintf("%s.%s.svc", svc.Name, svc.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", svc.Name, svc.Namespace),
+	}
+}
+
+// certificateSpecs returns the certificates issued by the instance CA
+func (c *PachydermComponents) certificateSpecs() []certificateSpec {
+	serverAuth := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	mutualAuth := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	specs := []certificateSpec{}
+
+	// the etcd client certificate is served by etcd and
+	// presented by the backup jobs connecting to etcd
+	if etcd := c.EtcdService(); etcd != nil {
+		specs = append(specs, certificateSpec{
+			secretName: c.EtcdClientTLSSecretName(),
+			app:        "etcd",
+			commonName: "etcd",
+			hosts:      append(serviceHosts(etcd), "localhost"),
+			usages:     mutualAuth,
+		})
+	}
+
+	// etcd members connect to each other
+	// using the governing service pod DNS names
+	if sts := c.etcdStatefulSet; sts != nil {
+		peerHosts := []string{}
+		for _, host := range serviceHosts(c.service(sts.Spec.ServiceName)) {
+			peerHosts = append(peerHosts, host, "*."+host)
+		}
+		specs = append(specs, certificateSpec{
+			secretName: c.EtcdPeerTLSSecretName(),
+			app:        "etcd",
+			commonName: "etcd-peer",
+			hosts:      peerHosts,
+			usages:     mutualAuth,
+		})
+	}
+
+	if postgres := c.PostgresService(); postgres != nil {
+		specs = append(specs, certificateSpec{
+			secretName: c.PostgresTLSSecretName(),
+			app:        "postgres",
+			commonName: "postgres",
+			hosts: append(serviceHosts(postgres),
+				serviceHosts(c.service(instanceName(c.pachyderm, "postgres-headless")))...),
+			usages: serverAuth,
+		})
+	}
+
+	if c.PachdTLSIssuedByCA() {
+		specs = append(specs, certificateSpec{
+			secretName: c.PachdTLSSecretName(),
+			app:        "pachd",
+			commonName: "pachd",
+			hosts:      c.PachdTLSHosts(),
+			usages:     serverAuth,
+		})
+	}
+
+	return specs
+}
+
+// newCertificateSecrets returns the secrets holding the instance
+// CA and the certificates it issued. The secret data is
+// populated when the secrets are returned by Secrets.
+func (c *PachydermComponents) newCertificateSecrets() []*corev1.Secret {
+	secrets := []*corev1.Secret{
+		c.newTLSSecret(c.CASecretName(), "pachyderm"),
+	}
+	for _, spec := range c.certificateSpecs() {
+		secrets = append(secrets, c.newTLSSecret(spec.secretName, spec.app))
+	}
+	return secrets
+}
+
+func (c *PachydermComponents) newTLSSecret(name, app string) *corev1.Secret {
+	pd := c.pachyderm
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: pd.Namespace,
+			Labels: setInstanceLabel(map[string]string{
+				"app":   app,
+				"suite": "pachyderm",
+			}, pd),
+		},
+		Type: corev1.SecretTypeTLS,
+	}
+}
+
+// newCABundle returns the config map publishing the instance CA
+func (c *PachydermComponents) newCABundle() *corev1.ConfigMap {
+	pd := c.pachyderm
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.CABundleName(),
+			Namespace: pd.Namespace,
+			Labels: setInstanceLabel(map[string]string{
+				"app":   "pachyderm",
+				"suite": "pachyderm",
+			}, pd),
+		},
+	}
+}
+
+// certificateAuthority returns the instance CA. The current CA is
+// reused while it is valid, otherwise a new CA is created.
+// Replacing the CA causes all certificates it issued to be replaced.
+func (c *PachydermComponents) certificateAuthority() (*certificateAuthority, error) {
+	if c.ca != nil {
+		return c.ca, nil
+	}
+
+	if current, ok := c.currentSecrets[c.CASecretName()]; ok &&
+		certificateValid(current.Data[corev1.TLSCertKey], current.Data[corev1.TLSPrivateKeyKey], nil, nil, time.Now()) {
+		if ca, err := parseCertificateAuthority(current.Data[corev1.TLSCertKey], current.Data[corev1.TLSPrivateKeyKey]); err == nil {
+			c.ca = ca
+			return c.ca, nil
+		}
+	}
+
+	key, err := newPrivateKeyRSA(keyBitSize)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := newCACertificate(key, fmt.Sprintf("%s.%s pachyderm CA", c.pachyderm.Name, c.pachyderm.Namespace))
+	if err != nil {
+		return nil, err
+	}
+
+	c.ca = &certificateAuthority{
+		cert:    cert,
+		key:     key,
+		certPEM: encodeCertificateToPEM(cert),
+		keyPEM:  encodePrivateKeyToPEM(key),
+	}
+
+	return c.ca, nil
+}
+
+// parseCertificateAuthority parses a PEM encoded CA certificate and key
+func parseCertificateAuthority(certPEM, keyPEM []byte) (*certificateAuthority, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, fmt.Errorf("unable to decode CA certificate and key")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %s is not a CA", cert.Subject.CommonName)
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificateAuthority{
+		cert:    cert,
+		key:     key,
+		certPEM: certPEM,
+		keyPEM:  keyPEM,
+	}, nil
+}
+
+// isCertificateSecret returns true if the secret holds
+// the instance CA or a certificate issued by it
+func (c *PachydermComponents) isCertificateSecret(name string) bool {
+	for _, secretName := range c.CertificateSecretNames() {
+		if name == secretName {
+			return true
+		}
+	}
+	return false
+}
+
+// setupCertificateSecret populates a secret holding the instance CA or
+// a certificate it issued. Current certificates are reused while they
+// are valid, otherwise a new certificate is issued.
+func (c *PachydermComponents) setupCertificateSecret(secret *corev1.Secret) error {
+	// certificates are only issued
+	// once for the pachyderm components
+	if len(secret.Data[corev1.TLSCertKey]) > 0 {
+		return nil
+	}
+
+	ca, err := c.certificateAuthority()
+	if err != nil {
+		return err
+	}
+
+	if secret.Name == c.CASecretName() {
+		secret.Data = map[string][]byte{
+			corev1.TLSCertKey:       ca.certPEM,
+			corev1.TLSPrivateKeyKey: ca.keyPEM,
+		}
+		return nil
+	}
+
+	for _, spec := range c.certificateSpecs() {
+		if spec.secretName != secret.Name {
+			continue
+		}
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+
+		if current, ok := c.currentSecrets[secret.Name]; ok &&
+			certificateValid(current.Data[corev1.TLSCertKey], current.Data[corev1.TLSPrivateKeyKey], spec.hosts, roots, time.Now()) {
+			secret.Data = map[string][]byte{
+				corev1.TLSCertKey:       current.Data[corev1.TLSCertKey],
+				corev1.TLSPrivateKeyKey: current.Data[corev1.TLSPrivateKeyKey],
+				CABundleKey:             ca.certPEM,
+			}
+			return nil
+		}
+
+		key, err := newPrivateKeyRSA(leafKeyBitSize)
+		if err != nil {
+			return err
+		}
+
+		cert, err := newSignedCertificate(key, ca, spec.commonName, spec.hosts, spec.usages)
+		if err != nil {
+			return err
+		}
+
+		secret.Data = map[string][]byte{
+			corev1.TLSCertKey:       encodeCertificateToPEM(cert),
+			corev1.TLSPrivateKeyKey: encodePrivateKeyToPEM(key),
+			CABundleKey:             ca.certPEM,
+		}
+	}
+
+	return nil
+}
+
+// setupCABundle publishes the instance CA certificate
+func (c *PachydermComponents) setupCABundle(cm *corev1.ConfigMap) error {
+	ca, err := c.certificateAuthority()
+	if err != nil {
+		return err
+	}
+
+	cm.Data = map[string]string{
+		CABundleKey: string(ca.certPEM),
+	}
+	return nil
+}
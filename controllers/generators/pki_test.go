@@ -0,0 +1,236 @@
+package generators
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+// parseCertificate parses the certificate of a TLS secret
+func parseCertificate(secret *corev1.Secret) *x509.Certificate {
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	Expect(block).NotTo(BeNil())
+	cert, err := x509.ParseCertificate(block.Bytes)
+	Expect(err).NotTo(HaveOccurred())
+	return cert
+}
+
+// containerByName returns the named container of the pod
+func containerByName(spec corev1.PodSpec, name string) corev1.Container {
+	containers := append([]corev1.Container{}, spec.InitContainers...)
+	for _, container := range append(containers, spec.Containers...) {
+		if container.Name == name {
+			return container
+		}
+	}
+	Fail("container " + name + " not found")
+	return corev1.Container{}
+}
+
+// mountPaths indexes the volume mounts of a container by volume name
+func mountPaths(container corev1.Container) map[string]string {
+	paths := map[string]string{}
+	for _, mount := range container.VolumeMounts {
+		paths[mount.Name] = mount.MountPath
+	}
+	return paths
+}
+
+var _ = Describe("instance CA", func() {
+	var pd *aimlv1beta1.Pachyderm
+
+	BeforeEach(func() {
+		pd = &aimlv1beta1.Pachyderm{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pachyderm",
+				Namespace:   "default",
+				Annotations: map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance},
+			},
+			Spec: aimlv1beta1.PachydermSpec{
+				Version: "2.0.0",
+				Pachd: aimlv1beta1.PachdOptions{
+					Storage: aimlv1beta1.ObjectStorageOptions{
+						Backend: "local",
+						Local:   &aimlv1beta1.LocalStorageOptions{HostPath: "/var/pachyderm"},
+					},
+					TLS: &aimlv1beta1.PachdTLSOptions{Enabled: true},
+				},
+			},
+		}
+	})
+
+	// issuedSecrets returns the secrets issued by the instance CA
+	issuedSecrets := func(components *PachydermComponents) map[string]*corev1.Secret {
+		secrets, err := components.Secrets()
+		Expect(err).NotTo(HaveOccurred())
+
+		issued := map[string]*corev1.Secret{}
+		for _, secret := range secrets {
+			if components.isCertificateSecret(secret.Name) {
+				issued[secret.Name] = secret
+			}
+		}
+		return issued
+	}
+
+	It("issues the leaf certificates of pachd, etcd and postgresql", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		secrets := issuedSecrets(components)
+
+		ca := parseCertificate(secrets[components.CASecretName()])
+		Expect(ca.IsCA).To(BeTrue())
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+
+		etcd := components.EtcdService()
+		headless := components.service(components.EtcdStatefulSet().Spec.ServiceName)
+		postgres := components.PostgresService()
+		leaves := map[string]struct {
+			host  string
+			usage x509.ExtKeyUsage
+		}{
+			components.EtcdClientTLSSecretName(): {etcd.Name + ".default.svc", x509.ExtKeyUsageClientAuth},
+			components.EtcdPeerTLSSecretName():   {components.EtcdStatefulSet().Name + "-0." + headless.Name + ".default.svc.cluster.local", x509.ExtKeyUsageClientAuth},
+			components.PostgresTLSSecretName():   {postgres.Name, x509.ExtKeyUsageServerAuth},
+			components.PachdTLSSecretName():      {components.PachdService().Name + ".default.svc", x509.ExtKeyUsageServerAuth},
+		}
+		Expect(secrets).To(HaveLen(len(leaves) + 1))
+
+		serials := map[string]bool{ca.SerialNumber.String(): true}
+		for name, leaf := range leaves {
+			Expect(secrets).To(HaveKey(name))
+			Expect(secrets[name].Data[CABundleKey]).To(Equal(secrets[components.CASecretName()].Data[corev1.TLSCertKey]))
+
+			cert := parseCertificate(secrets[name])
+			_, err := cert.Verify(x509.VerifyOptions{
+				DNSName:   leaf.host,
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{leaf.usage},
+			})
+			Expect(err).NotTo(HaveOccurred(), "certificate of %s", name)
+
+			Expect(serials).NotTo(HaveKey(cert.SerialNumber.String()))
+			serials[cert.SerialNumber.String()] = true
+		}
+	})
+
+	It("reuses the certificates it issued", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		issued := issuedSecrets(components)
+
+		components, err = Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		for _, secret := range issued {
+			components.SetCurrentSecret(secret.DeepCopy())
+		}
+		for name, secret := range issuedSecrets(components) {
+			Expect(secret.Data).To(Equal(issued[name].Data), "certificate of %s", name)
+		}
+	})
+
+	It("serves the etcd clients and peers over TLS", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		components.EtcdStatefulSet()
+		spec := components.EtcdStatefulSet().Spec.Template.Spec
+
+		etcd := containerByName(spec, "etcd")
+		Expect(etcd.Args).To(HaveLen(1))
+		Expect(strings.Count(etcd.Args[0], "--cert-file=")).To(Equal(1))
+		for _, flag := range []string{
+			"--listen-client-urls=http://0.0.0.0:2379,https://0.0.0.0:2378",
+			"--listen-peer-urls=https://0.0.0.0:2380",
+			"--initial-advertise-peer-urls=https://",
+			"--initial-cluster=" + components.EtcdStatefulSet().Name + "-0=https://",
+			"--cert-file=/etcd-tls/client/tls.crt",
+			"--client-cert-auth",
+			"--peer-trusted-ca-file=/etcd-tls/peer/ca.crt",
+			"--peer-client-cert-auth",
+		} {
+			Expect(etcd.Args[0]).To(ContainSubstring(flag))
+		}
+		Expect(mountPaths(etcd)).To(HaveKeyWithValue("etcd-client-tls", etcdClientTLSMountPath))
+		Expect(mountPaths(etcd)).To(HaveKeyWithValue("etcd-peer-tls", etcdPeerTLSMountPath))
+
+		port, ok := containerPort(etcd, etcdClientTLSPortName)
+		Expect(ok).To(BeTrue())
+		Expect(port).To(Equal(etcdClientTLSPort))
+		port, ok = ServicePort(components.EtcdService(), etcdClientTLSPortName)
+		Expect(ok).To(BeTrue())
+		Expect(port).To(Equal(etcdClientTLSPort))
+
+		template := components.EtcdStatefulSet().Spec.Template
+		Expect(template.Annotations).To(HaveKey(components.checksumAnnotation(components.EtcdPeerTLSSecretName())))
+	})
+
+	It("serves postgresql over TLS", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		components.PostgreStatefulset()
+		spec := components.PostgreStatefulset().Spec.Template.Spec
+
+		Expect(spec.InitContainers).To(HaveLen(1))
+		initContainer := containerByName(spec, "postgres-tls")
+		Expect(mountPaths(initContainer)).To(HaveKeyWithValue("postgres-tls", postgresTLSMountPath))
+		Expect(mountPaths(initContainer)).To(HaveKey("postgres-tls-secret"))
+
+		postgres := containerByName(spec, "postgres")
+		Expect(postgres.Args).To(ContainElements("ssl=on", "ssl_key_file=/postgres-tls/tls.key"))
+		Expect(mountPaths(postgres)).To(HaveKeyWithValue("postgres-tls", postgresTLSMountPath))
+	})
+
+	It("verifies the postgresql certificate from pachd and the backup jobs", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		pachd := containerByName(components.PachdDeployment().Spec.Template.Spec, "pachd")
+		env := envByName(pachd.Env)
+		Expect(env["POSTGRES_SERVICE_SSL"].Value).To(Equal("verify-full"))
+		Expect(env["PGSSLROOTCERT"].Value).To(Equal("/pachyderm-ca/ca.crt"))
+		Expect(mountPaths(pachd)).To(HaveKeyWithValue("pachyderm-ca", caBundleMountPath))
+
+		job, err := components.BackupJob(&aimlv1beta1.PachydermBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default"},
+			Spec: aimlv1beta1.PachydermBackupSpec{
+				Storage: &aimlv1beta1.ObjectStorageOptions{
+					Backend: "minio",
+					Minio:   &aimlv1beta1.MinioStorageOptions{Bucket: "backups", Endpoint: "minio:9000"},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		dump := containerByName(job.Spec.Template.Spec, "pg-dump")
+		Expect(envByName(dump.Env)["PGSSLMODE"].Value).To(Equal("verify-full"))
+		Expect(mountPaths(dump)).To(HaveKeyWithValue("pachyderm-ca", caBundleMountPath))
+
+		snapshot := containerByName(job.Spec.Template.Spec, "etcd-snapshot")
+		Expect(snapshot.Command).To(ContainElements("--cert", "/etcd-tls/client/tls.crt"))
+		Expect(snapshot.Command).To(ContainElement("https://" + components.EtcdService().Name + ".default.svc:2378"))
+		Expect(mountPaths(snapshot)).To(HaveKeyWithValue("etcd-client-tls", etcdClientTLSMountPath))
+	})
+
+	It("keeps etcd and postgresql in plaintext without TLS", func() {
+		pd.Spec.Pachd.TLS = nil
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(issuedSecrets(components)).To(BeEmpty())
+		etcd := containerByName(components.EtcdStatefulSet().Spec.Template.Spec, "etcd")
+		Expect(etcd.Args[0]).To(ContainSubstring("--listen-peer-urls=http://"))
+		Expect(etcd.Args[0]).NotTo(ContainSubstring("--cert-file"))
+		Expect(components.PostgreStatefulset().Spec.Template.Spec.InitContainers).To(BeEmpty())
+
+		pachd := containerByName(components.PachdDeployment().Spec.Template.Spec, "pachd")
+		Expect(envByName(pachd.Env)).NotTo(HaveKey("PGSSLROOTCERT"))
+	})
+})
@@ -0,0 +1,202 @@
+package generators
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+const (
+	// ErrUnsupportedRestoreEtcd is returned when the backup is restored
+	// into a pachyderm resource running more than one etcd member
+	ErrUnsupportedRestoreEtcd PachydermError = "backups can only be restored into a single member etcd cluster"
+
+	etcdDataDir = "/var/data/etcd"
+)
+
+// Paused returns true while a restore holds the pachd,
+// dash and etcd workloads of the pachyderm resource scaled down
+func Paused(pd *aimlv1beta1.Pachyderm) bool {
+	return pd.Annotations[aimlv1beta1.RestoreAnnotation] != ""
+}
+
+// EtcdPaused returns true once the restore holding the
+// pachyderm resource scaled down etcd after pachd and dash
+func EtcdPaused(pd *aimlv1beta1.Pachyderm) bool {
+	return Paused(pd) && pd.Annotations[aimlv1beta1.RestoreEtcdAnnotation] != ""
+}
+
+// setPausedReplicas scales a workload down while it is paused.
+// Unset replicas default to a single pod, so the workload
+// is scaled back up once the restore is done.
+func setPausedReplicas(replicas **int32, paused bool) {
+	var desired int32 = 1
+	if *replicas != nil {
+		desired = **replicas
+	}
+	if paused {
+		desired = 0
+	}
+	*replicas = &desired
+}
+
+// RestoreJobName returns the name of the job restoring the backup
+func RestoreJobName(restore *aimlv1beta1.PachydermRestore) string {
+	return fmt.Sprintf("%s-restore", restore.Name)
+}
+
+// EtcdDataClaimName returns the name of the volume
+// claim holding the data of the first etcd member
+func (c *PachydermComponents) EtcdDataClaimName() string {
+	sts := c.EtcdStatefulSet()
+	name := "etcd-storage"
+	if len(sts.Spec.VolumeClaimTemplates) > 0 {
+		name = sts.Spec.VolumeClaimTemplates[0].Name
+	}
+	return fmt.Sprintf("%s-%s-0", name, sts.Name)
+}
+
+// RestoreJob returns the job restoring a backup into the pachyderm
+// resource. The artifacts are downloaded from the storage of the
+// source components, the pachyderm resource the backup was taken
+// from. The etcd data directory is replaced with the restored
+// snapshot, so etcd must be scaled down while the job runs.
+func (c *PachydermComponents) RestoreJob(restore *aimlv1beta1.PachydermRestore, backup *aimlv1beta1.PachydermBackup, source *PachydermComponents) (*batchv1.Job, error) {
+	pd := c.pachyderm
+
+	if pd.Spec.Etcd.DynamicNodes > 1 {
+		return nil, ErrUnsupportedRestoreEtcd
+	}
+
+	downloadEnv, err := source.backupUploadEnv(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	etcd := c.EtcdStatefulSet()
+	member := fmt.Sprintf("%s-0", etcd.Name)
+	peerURL := fmt.Sprintf("%s://%s.%s.%s.svc.cluster.local:2380", c.etcdPeerScheme(), member, etcd.Spec.ServiceName, etcd.Namespace)
+
+	download := corev1.Container{
+		Name:    "download",
+		Image:   defaultBackupImage,
+		Command: []string{"/bin/sh", "-c", restoreDownloadScript},
+		Env:     downloadEnv,
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "backup", MountPath: backupDir},
+		},
+	}
+	setContainerImage(&download, restore.Spec.Image)
+
+	labels := setInstanceLabel(map[string]string{
+		"app":   "pachyderm-restore",
+		"suite": "pachyderm",
+	}, pd)
+	backoffLimit := backupBackoffLimit
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RestoreJobName(restore),
+			Namespace: restore.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					InitContainers: []corev1.Container{
+						download,
+						{
+							Name:    "etcd-restore",
+							Image:   containerImage(etcd.Spec.Template.Spec, "etcd"),
+							Command: []string{"/bin/sh", "-c", restoreEtcdScript},
+							Env: []corev1.EnvVar{
+								{Name: "ETCDCTL_API", Value: "3"},
+								{Name: "ETCD_NAME", Value: member},
+								{Name: "ETCD_PEER_URL", Value: peerURL},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "backup", MountPath: backupDir},
+								{Name: "etcd-storage", MountPath: etcdDataDir},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "pg-restore",
+							Image:   containerImage(c.PostgreStatefulset().Spec.Template.Spec, "postgres"),
+							Command: []string{"/bin/sh", "-c", restoreDumpScript},
+							Env:     c.backupPostgresEnv(backup),
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "backup", MountPath: backupDir},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "backup",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+						{
+							Name: "etcd-storage",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: c.EtcdDataClaimName(),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if c.PachdTLSEnabled() {
+		c.mountCABundle(&job.Spec.Template.Spec, "pg-restore")
+	}
+
+	return job, nil
+}
+
+// restoreDownloadScript downloads the backup artifacts
+// uploaded under $PREFIX by the backup job
+const restoreDownloadScript = `set -e
+if [ -n "$SESSION_TOKEN" ]; then
+  export MC_HOST_backup="$ENDPOINT_SCHEME://$ACCESS_KEY:$SECRET_KEY:$SESSION_TOKEN@$ENDPOINT_HOST"
+else
+  mc --config-dir /tmp/mc alias set backup "$ENDPOINT_SCHEME://$ENDPOINT_HOST" "$ACCESS_KEY" "$SECRET_KEY" >/dev/null
+fi
+mc --config-dir /tmp/mc cp --recursive "backup/$BUCKET/$PREFIX/" ` + backupDir + `/
+`
+
+// restoreEtcdScript restores the etcd snapshot as the first member
+// of a new cluster and replaces the data directory of that member
+const restoreEtcdScript = `set -e
+rm -rf ` + backupDir + `/etcd.restore
+etcdctl snapshot restore ` + backupDir + `/etcd.snapshot \
+  --name "$ETCD_NAME" \
+  --initial-cluster "$ETCD_NAME=$ETCD_PEER_URL" \
+  --initial-cluster-token pach-cluster \
+  --initial-advertise-peer-urls "$ETCD_PEER_URL" \
+  --data-dir ` + backupDir + `/etcd.restore
+rm -rf ` + etcdDataDir + `/member
+cp -a ` + backupDir + `/etcd.restore/member ` + etcdDataDir + `/member
+`
+
+// restoreDumpScript restores each database listed in $DATABASES,
+// dropping the objects of the database before recreating them
+const restoreDumpScript = `set -e
+for db in $DATABASES; do
+  pg_restore --clean --if-exists --no-owner --dbname="$db" "` + backupDir + `/$db.dump"
+done
+`
@@ -0,0 +1,55 @@
+package generators
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+var _ = Describe("paused workloads", func() {
+	var pd *aimlv1beta1.Pachyderm
+
+	BeforeEach(func() {
+		pd = &aimlv1beta1.Pachyderm{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pachyderm",
+				Namespace:   "default",
+				Annotations: map[string]string{aimlv1beta1.RestoreAnnotation: "restore"},
+			},
+			Spec: aimlv1beta1.PachydermSpec{
+				Version: "2.0.0",
+				Pachd: aimlv1beta1.PachdOptions{
+					Storage: aimlv1beta1.ObjectStorageOptions{
+						Backend: "local",
+						Local:   &aimlv1beta1.LocalStorageOptions{HostPath: "/var/pachyderm"},
+					},
+				},
+			},
+		}
+	})
+
+	It("keeps etcd running while pachd and dash scale down", func() {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*components.PachdDeployment().Spec.Replicas).To(BeZero())
+		Expect(*components.DashDeployment().Spec.Replicas).To(BeZero())
+		Expect(*components.EtcdStatefulSet().Spec.Replicas).To(BeNumerically("==", 1))
+	})
+
+	It("scales etcd down once the restore pauses it", func() {
+		pd.Annotations[aimlv1beta1.RestoreEtcdAnnotation] = "restore"
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*components.EtcdStatefulSet().Spec.Replicas).To(BeZero())
+	})
+
+	It("ignores the etcd annotation of resources that are not paused", func() {
+		pd.Annotations = map[string]string{aimlv1beta1.RestoreEtcdAnnotation: "restore"}
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*components.PachdDeployment().Spec.Replicas).To(BeNumerically("==", 1))
+		Expect(*components.EtcdStatefulSet().Spec.Replicas).To(BeNumerically("==", 1))
+	})
+})
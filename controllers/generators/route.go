@@ -0,0 +1,126 @@
+package generators
+
+import (
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// RouteGVK is the group, version and kind of OpenShift routes
+var RouteGVK = schema.GroupVersionKind{
+	Group:   "route.openshift.io",
+	Version: "v1",
+	Kind:    "Route",
+}
+
+// Routes returns the OpenShift routes exposing pachyderm
+// components outside the cluster. Routes are generated for
+// the same hosts as the ingresses returned by Ingresses.
+func (c *PachydermComponents) Routes() []*unstructured.Unstructured {
+	pd := c.pachyderm
+	routes := []*unstructured.Unstructured{}
+
+	if svc := c.DashService(); svc != nil &&
+		!pd.Spec.Dashd.Disable && pd.Spec.Dashd.URL != "" {
+		opts := aimlv1beta1.IngressOptions{}
+		if pd.Spec.Dashd.Ingress != nil {
+			opts = *pd.Spec.Dashd.Ingress
+		}
+
+		routes = append(routes,
+			newRoute(pd, "dash", "dash", pd.Spec.Dashd.URL, opts, "edge", svc.Name, "dash-http"))
+	}
+
+	if svc := c.PachdService(); svc != nil && pd.Spec.Pachd.Ingress != nil {
+		opts := pd.Spec.Pachd.Ingress
+
+		// the router can only pass connections through
+		// to pachd if pachd serves its APIs over TLS
+		termination := "edge"
+		if pachdTLSEnabled(pd) {
+			termination = "passthrough"
+		}
+
+		if opts.Host != "" {
+			routes = append(routes,
+				newRoute(pd, "pachd", "pachd", opts.Host, opts.IngressOptions, termination, svc.Name, "api-grpc-port"))
+		}
+
+		if opts.S3GatewayHost != "" {
+			routes = append(routes,
+				newRoute(pd, "pachd-s3gateway", "pachd", opts.S3GatewayHost, opts.IngressOptions, termination, svc.Name, "s3gateway-port"))
+		}
+	}
+
+	return routes
+}
+
+// newRoute returns a route sending requests for
+// the host to a named port of the component service
+func newRoute(pd *aimlv1beta1.Pachyderm, name, app, host string, opts aimlv1beta1.IngressOptions, termination, service, port string) *unstructured.Unstructured {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(RouteGVK)
+	route.SetName(instanceName(pd, name))
+	route.SetNamespace(pd.Namespace)
+	route.SetLabels(setInstanceLabel(map[string]string{
+		"app":   app,
+		"suite": "pachyderm",
+	}, pd))
+	if len(opts.Annotations) > 0 {
+		route.SetAnnotations(opts.Annotations)
+	}
+
+	insecurePolicy := "Redirect"
+	destinationCA := ""
+	if opts.Route != nil {
+		if opts.Route.Termination != "" {
+			termination = opts.Route.Termination
+		}
+		if opts.Route.InsecureEdgeTerminationPolicy != "" {
+			insecurePolicy = opts.Route.InsecureEdgeTerminationPolicy
+		}
+		destinationCA = opts.Route.DestinationCACertificate
+	}
+
+	tls := map[string]interface{}{
+		"termination": termination,
+	}
+	switch termination {
+	case "edge":
+		tls["insecureEdgeTerminationPolicy"] = insecurePolicy
+	case "passthrough":
+		// passthrough routes do not accept the Allow policy
+		if insecurePolicy != "Allow" {
+			tls["insecureEdgeTerminationPolicy"] = insecurePolicy
+		}
+	case "reencrypt":
+		tls["insecureEdgeTerminationPolicy"] = insecurePolicy
+		if destinationCA != "" {
+			tls["destinationCACertificate"] = destinationCA
+		}
+	}
+
+	spec := map[string]interface{}{
+		"host": host,
+		"to": map[string]interface{}{
+			"kind":   "Service",
+			"name":   service,
+			"weight": int64(100),
+		},
+		"port": map[string]interface{}{
+			"targetPort": port,
+		},
+		"tls":            tls,
+		"wildcardPolicy": "None",
+	}
+
+	// paths are not supported by passthrough routes,
+	// since the router does not decrypt requests
+	if termination != "passthrough" && opts.Path != "" && opts.Path != "/" {
+		spec["path"] = opts.Path
+	}
+
+	route.Object["spec"] = spec
+
+	return route
+}
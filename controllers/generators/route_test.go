@@ -0,0 +1,107 @@
+package generators
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+)
+
+var _ = Describe("routes", func() {
+	var pd *aimlv1beta1.Pachyderm
+
+	BeforeEach(func() {
+		pd = &aimlv1beta1.Pachyderm{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pachyderm",
+				Namespace:   "default",
+				Annotations: map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance},
+			},
+			Spec: aimlv1beta1.PachydermSpec{
+				Version: "2.0.0",
+				Pachd: aimlv1beta1.PachdOptions{
+					Storage: aimlv1beta1.ObjectStorageOptions{
+						Backend: "local",
+						Local:   &aimlv1beta1.LocalStorageOptions{HostPath: "/var/pachyderm"},
+					},
+					Ingress: &aimlv1beta1.PachdIngressOptions{
+						IngressOptions: aimlv1beta1.IngressOptions{Path: "/pachd"},
+						Host:           "pachd.example.com",
+						S3GatewayHost:  "s3.example.com",
+					},
+				},
+				Dashd: aimlv1beta1.DashOptions{URL: "dash.example.com"},
+			},
+		}
+	})
+
+	// routesByName indexes the spec of the generated routes by name
+	routesByName := func() map[string]map[string]interface{} {
+		components, err := Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		routes := map[string]map[string]interface{}{}
+		for _, route := range components.Routes() {
+			Expect(route.GroupVersionKind()).To(Equal(RouteGVK))
+			Expect(route.GetLabels()).To(HaveKeyWithValue(InstanceLabel, pd.Name))
+			spec, _, err := unstructured.NestedMap(route.Object, "spec")
+			Expect(err).NotTo(HaveOccurred())
+			routes[route.GetName()] = spec
+		}
+		return routes
+	}
+
+	It("exposes the hosts of the ingresses", func() {
+		routes := routesByName()
+		Expect(routes).To(HaveLen(3))
+
+		Expect(routes).To(HaveKey("pachyderm-dash"))
+		Expect(routes["pachyderm-dash"]).To(HaveKeyWithValue("host", "dash.example.com"))
+		Expect(routes["pachyderm-dash"]).To(HaveKeyWithValue("port", map[string]interface{}{"targetPort": "dash-http"}))
+		Expect(routes["pachyderm-dash"]).NotTo(HaveKey("path"))
+
+		for name, port := range map[string]string{
+			"pachyderm-pachd":           "api-grpc-port",
+			"pachyderm-pachd-s3gateway": "s3gateway-port",
+		} {
+			Expect(routes).To(HaveKey(name))
+			Expect(routes[name]).To(HaveKeyWithValue("port", map[string]interface{}{"targetPort": port}))
+			Expect(routes[name]).To(HaveKeyWithValue("path", "/pachd"))
+			Expect(routes[name]["tls"]).To(Equal(map[string]interface{}{
+				"termination":                   "edge",
+				"insecureEdgeTerminationPolicy": "Redirect",
+			}))
+		}
+	})
+
+	It("passes connections through to pachd when pachd serves TLS", func() {
+		pd.Spec.Pachd.TLS = &aimlv1beta1.PachdTLSOptions{Enabled: true}
+		routes := routesByName()
+
+		Expect(routes["pachyderm-pachd"]["tls"]).To(Equal(map[string]interface{}{
+			"termination":                   "passthrough",
+			"insecureEdgeTerminationPolicy": "Redirect",
+		}))
+		Expect(routes["pachyderm-pachd"]).NotTo(HaveKey("path"))
+		Expect(routes["pachyderm-dash"]["tls"]).To(HaveKeyWithValue("termination", "edge"))
+	})
+
+	It("applies the route options", func() {
+		pd.Spec.Pachd.TLS = &aimlv1beta1.PachdTLSOptions{Enabled: true}
+		pd.Spec.Pachd.Ingress.Route = &aimlv1beta1.RouteOptions{
+			Termination:                   "reencrypt",
+			InsecureEdgeTerminationPolicy: "None",
+			DestinationCACertificate:      "-----BEGIN CERTIFICATE-----",
+		}
+		routes := routesByName()
+
+		Expect(routes["pachyderm-pachd"]["tls"]).To(Equal(map[string]interface{}{
+			"termination":                   "reencrypt",
+			"insecureEdgeTerminationPolicy": "None",
+			"destinationCACertificate":      "-----BEGIN CERTIFICATE-----",
+		}))
+		Expect(routes["pachyderm-pachd"]).To(HaveKeyWithValue("path", "/pachd"))
+	})
+})
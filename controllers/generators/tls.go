@@ -0,0 +1,317 @@
+package generators
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// certificateRenewBefore is the time before a certificate
+	// expires at which the certificate is replaced.
+	// Pachyderm resources are resynced well within this window.
+	certificateRenewBefore = 30 * 24 * time.Hour
+
+	// pachdTLSMountPath is the directory pachd
+	// loads its TLS certificate and key from
+	pachdTLSMountPath = "/pachd-tls-cert"
+
+	// caBundleMountPath is the directory clients of
+	// etcd and postgresql load the instance CA from
+	caBundleMountPath = "/pachyderm-ca"
+
+	// etcdClientTLSMountPath and etcdPeerTLSMountPath are the
+	// directories the etcd certificates are mounted in
+	etcdClientTLSMountPath = "/etcd-tls/client"
+	etcdPeerTLSMountPath   = "/etcd-tls/peer"
+
+	// etcdClientTLSPort is the port etcd serves its clients over TLS.
+	// pachd does not support TLS connections to etcd, so the
+	// plaintext client port is still served alongside it.
+	etcdClientTLSPort     = int32(2378)
+	etcdClientTLSPortName = "client-tls-port"
+
+	// postgresTLSMountPath is the directory postgresql loads its
+	// certificate from. The certificate secret is copied there by
+	// an init container, since postgresql refuses to load a key
+	// readable by other users.
+	postgresTLSMountPath = "/postgres-tls"
+
+	// postgresSSLMode is the ssl mode postgresql clients use to
+	// verify the certificate issued by the instance CA
+	postgresSSLMode = "verify-full"
+)
+
+// pachdTLSEnabled returns true if pachd serves its APIs over TLS
+func pachdTLSEnabled(pd *aimlv1beta1.Pachyderm) bool {
+	return pd.Spec.Pachd.TLS != nil && pd.Spec.Pachd.TLS.Enabled
+}
+
+// PachdTLSEnabled returns true if pachd serves its APIs over TLS
+func (c *PachydermComponents) PachdTLSEnabled() bool {
+	return pachdTLSEnabled(c.pachyderm)
+}
+
+// PachdTLSHosts returns the DNS names included in the pachd certificate
+func (c *PachydermComponents) PachdTLSHosts() []string {
+	pd := c.pachyderm
+	hosts := []string{}
+
+	hosts = append(hosts, serviceHosts(c.PachdService())...)
+	hosts = append(hosts, serviceHosts(c.PachdPeerService())...)
+
+	if pd.Spec.Pachd.Ingress != nil {
+		for _, host := range []string{pd.Spec.Pachd.Ingress.Host, pd.Spec.Pachd.Ingress.S3GatewayHost} {
+			if host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	if pd.Spec.Pachd.TLS != nil {
+		hosts = append(hosts, pd.Spec.Pachd.TLS.AdditionalHosts...)
+	}
+
+	return hosts
+}
+
+// mountPachdTLSSecret mounts the pachd TLS secret
+// in the directory pachd loads its certificate from
+func (c *PachydermComponents) mountPachdTLSSecret(spec *corev1.PodSpec) {
+	mountVolume(spec, corev1.Volume{
+		Name: "pachd-tls-cert",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: c.PachdTLSSecretName(),
+			},
+		},
+	}, pachdTLSMountPath, "pachd")
+}
+
+// mountCABundle mounts the instance CA bundle in the named containers
+func (c *PachydermComponents) mountCABundle(spec *corev1.PodSpec, containers ...string) {
+	mountVolume(spec, corev1.Volume{
+		Name: "pachyderm-ca",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: c.CABundleName()},
+			},
+		},
+	}, caBundleMountPath, containers...)
+}
+
+// mountEtcdClientTLSSecret mounts the etcd client certificate
+// and the instance CA bundle in the named containers
+func (c *PachydermComponents) mountEtcdClientTLSSecret(spec *corev1.PodSpec, containers ...string) {
+	mountVolume(spec, corev1.Volume{
+		Name: "etcd-client-tls",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: c.EtcdClientTLSSecretName(),
+			},
+		},
+	}, etcdClientTLSMountPath, containers...)
+}
+
+// mountVolume adds the volume to the pod and mounts it read
+// only in the named containers and init containers.
+// The volume is only added once.
+func mountVolume(spec *corev1.PodSpec, volume corev1.Volume, mountPath string, containers ...string) {
+	for _, v := range spec.Volumes {
+		if v.Name == volume.Name {
+			return
+		}
+	}
+	spec.Volumes = append(spec.Volumes, volume)
+
+	mount := corev1.VolumeMount{
+		Name:      volume.Name,
+		MountPath: mountPath,
+		ReadOnly:  true,
+	}
+	for _, name := range containers {
+		for i := range spec.InitContainers {
+			if spec.InitContainers[i].Name == name {
+				spec.InitContainers[i].VolumeMounts = append(spec.InitContainers[i].VolumeMounts, mount)
+			}
+		}
+		for i := range spec.Containers {
+			if spec.Containers[i].Name == name {
+				spec.Containers[i].VolumeMounts = append(spec.Containers[i].VolumeMounts, mount)
+			}
+		}
+	}
+}
+
+// etcdPeerScheme returns the scheme of the etcd peer urls.
+// Members connect to each other over TLS once the
+// instance CA issued the etcd peer certificate.
+func (c *PachydermComponents) etcdPeerScheme() string {
+	if c.PachdTLSEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+var (
+	etcdClientURLsArg = regexp.MustCompile(`--(listen|advertise)-client-urls=[^"\s]*`)
+	etcdPeerURLsArg   = regexp.MustCompile(`(--listen-peer-urls=|--initial-advertise-peer-urls=)http://`)
+)
+
+// etcdTLSArgs adds the TLS client listener and serves the
+// etcd peers over TLS. Clients must present a certificate
+// issued by the instance CA on the TLS client port.
+func etcdTLSArgs(arg string) string {
+	if strings.Contains(arg, "--cert-file=") {
+		return arg
+	}
+
+	arg = etcdClientURLsArg.ReplaceAllString(arg, fmt.Sprintf("${0},https://0.0.0.0:%d", etcdClientTLSPort))
+	arg = etcdPeerURLsArg.ReplaceAllString(arg, "${1}https://")
+
+	for _, flag := range []string{
+		"--cert-file=" + filepath.Join(etcdClientTLSMountPath, corev1.TLSCertKey),
+		"--key-file=" + filepath.Join(etcdClientTLSMountPath, corev1.TLSPrivateKeyKey),
+		"--trusted-ca-file=" + filepath.Join(etcdClientTLSMountPath, CABundleKey),
+		"--client-cert-auth",
+		"--peer-cert-file=" + filepath.Join(etcdPeerTLSMountPath, corev1.TLSCertKey),
+		"--peer-key-file=" + filepath.Join(etcdPeerTLSMountPath, corev1.TLSPrivateKeyKey),
+		"--peer-trusted-ca-file=" + filepath.Join(etcdPeerTLSMountPath, CABundleKey),
+		"--peer-client-cert-auth",
+	} {
+		arg += fmt.Sprintf(` "%s"`, flag)
+	}
+	return arg
+}
+
+// setupEtcdTLS mounts the etcd certificates and
+// serves the etcd clients and peers over TLS
+func (c *PachydermComponents) setupEtcdTLS(spec *corev1.PodSpec) {
+	for i, container := range spec.Containers {
+		if container.Name != "etcd" {
+			continue
+		}
+
+		for j, arg := range container.Args {
+			spec.Containers[i].Args[j] = etcdTLSArgs(arg)
+		}
+
+		if _, ok := containerPort(container, etcdClientTLSPortName); !ok {
+			spec.Containers[i].Ports = append(spec.Containers[i].Ports, corev1.ContainerPort{
+				Name:          etcdClientTLSPortName,
+				ContainerPort: etcdClientTLSPort,
+			})
+		}
+	}
+
+	c.mountEtcdClientTLSSecret(spec, "etcd")
+	mountVolume(spec, corev1.Volume{
+		Name: "etcd-peer-tls",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: c.EtcdPeerTLSSecretName(),
+			},
+		},
+	}, etcdPeerTLSMountPath, "etcd")
+}
+
+// containerPort returns the named port of the container
+func containerPort(container corev1.Container, name string) (int32, bool) {
+	for _, port := range container.Ports {
+		if port.Name == name {
+			return port.ContainerPort, true
+		}
+	}
+	return 0, false
+}
+
+// addEtcdClientTLSPort exposes the TLS client port on the etcd service
+func (c *PachydermComponents) addEtcdClientTLSPort() {
+	svc := c.EtcdService()
+	if svc == nil {
+		return
+	}
+	if _, ok := ServicePort(svc, etcdClientTLSPortName); ok {
+		return
+	}
+	svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+		Name:       etcdClientTLSPortName,
+		Port:       etcdClientTLSPort,
+		TargetPort: intstr.FromString(etcdClientTLSPortName),
+	})
+}
+
+// postgresTLSScript copies the postgresql certificate, so
+// the key is only readable by the postgres user
+const postgresTLSScript = `set -e
+install -m 0644 /postgres-tls-secret/tls.crt ` + postgresTLSMountPath + `/tls.crt
+install -o postgres -g postgres -m 0600 /postgres-tls-secret/tls.key ` + postgresTLSMountPath + `/tls.key
+`
+
+// setupPostgresTLS copies the postgresql certificate
+// to the data directory and enables TLS connections
+func (c *PachydermComponents) setupPostgresTLS(spec *corev1.PodSpec) {
+	for _, container := range spec.InitContainers {
+		if container.Name == "postgres-tls" {
+			return
+		}
+	}
+
+	spec.InitContainers = append(spec.InitContainers, corev1.Container{
+		Name:    "postgres-tls",
+		Image:   containerImage(*spec, "postgres"),
+		Command: []string{"/bin/sh", "-c", postgresTLSScript},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "postgres-tls", MountPath: postgresTLSMountPath},
+		},
+	})
+
+	mountVolume(spec, corev1.Volume{
+		Name: "postgres-tls-secret",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: c.PostgresTLSSecretName(),
+			},
+		},
+	}, "/postgres-tls-secret", "postgres-tls")
+	mountVolume(spec, corev1.Volume{
+		Name: "postgres-tls",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}, postgresTLSMountPath, "postgres")
+
+	for i, container := range spec.Containers {
+		if container.Name == "postgres" {
+			spec.Containers[i].Args = []string{
+				"postgres",
+				"-c", "ssl=on",
+				"-c", "ssl_cert_file=" + filepath.Join(postgresTLSMountPath, corev1.TLSCertKey),
+				"-c", "ssl_key_file=" + filepath.Join(postgresTLSMountPath, corev1.TLSPrivateKeyKey),
+			}
+		}
+	}
+}
+
+// postgresTLSVerified returns true if the postgresql of the
+// resource is used and serves the certificate issued by the
+// instance CA, which its clients verify
+func (c *PachydermComponents) postgresTLSVerified() bool {
+	return c.PachdTLSEnabled() && c.instancePostgres() != nil
+}
+
+// containerImage returns the image of the named container of a pod
+func containerImage(spec corev1.PodSpec, name string) string {
+	for _, container := range spec.Containers {
+		if container.Name == name {
+			return container.Image
+		}
+	}
+	return ""
+}
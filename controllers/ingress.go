@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+// reconcileIngresses creates or updates the ingresses exposing
+// pachyderm components, and deletes ingresses that are no
+// longer required by the pachyderm resource
+func (r *PachydermReconciler) reconcileIngresses(ctx context.Context, components *generators.PachydermComponents) error {
+	pd := components.Parent()
+	desired := map[string]bool{}
+
+	for _, ing := range components.Ingresses() {
+		desired[ing.Name] = true
+
+		if err := controllerutil.SetControllerReference(pd, ing, r.Scheme); err != nil {
+			return err
+		}
+
+		if err := r.Create(ctx, ing); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return err
+			}
+
+			current := &networkingv1.Ingress{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(ing), current); err != nil {
+				return err
+			}
+
+			patch := client.MergeFrom(current.DeepCopy())
+			if ingressChanged(current, ing) {
+				if err := r.Patch(ctx, current, patch); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingresses,
+		client.InNamespace(pd.Namespace),
+		client.MatchingLabels{generators.InstanceLabel: pd.Name}); err != nil {
+		return err
+	}
+
+	for i := range ingresses.Items {
+		ing := &ingresses.Items[i]
+		if desired[ing.Name] || !metav1.IsControlledBy(ing, pd) {
+			continue
+		}
+
+		if err := r.Delete(ctx, ing); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("reconcileIngresses", func() {
+	It("creates the ingresses and deletes those no longer required", func() {
+		ctx := context.Background()
+		scheme := newTestScheme()
+		pd := newTestPachyderm()
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+		pd.Spec.Dashd.URL = "dash.example.com"
+		pd.Spec.Pachd.Ingress = &aimlv1beta1.PachdIngressOptions{Host: "pachd.example.com"}
+
+		r := &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, pd),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.reconcileIngresses(ctx, components)).To(Succeed())
+
+		pachdKey := types.NamespacedName{Name: components.PachdIngress().Name, Namespace: pd.Namespace}
+		dashKey := types.NamespacedName{Name: components.DashIngress().Name, Namespace: pd.Namespace}
+		for _, key := range []types.NamespacedName{pachdKey, dashKey} {
+			Expect(r.Get(ctx, key, &networkingv1.Ingress{})).To(Succeed())
+		}
+
+		// the new host is patched, and the pachd ingress removed
+		pd.Spec.Dashd.URL = "ui.example.com"
+		pd.Spec.Pachd.Ingress = nil
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.reconcileIngresses(ctx, components)).To(Succeed())
+
+		dash := &networkingv1.Ingress{}
+		Expect(r.Get(ctx, dashKey, dash)).To(Succeed())
+		Expect(dash.Spec.Rules[0].Host).To(Equal("ui.example.com"))
+		err = r.Get(ctx, pachdKey, &networkingv1.Ingress{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+// reconcileNaming records how the objects of the pachyderm resource
+// are named the first time it is reconciled. Resources deployed by
+// earlier versions of the operator own an etcd statefulset with the
+// unprefixed name, and keep the legacy names so their workloads and
+// volume claims are not replaced by new, empty ones.
+func (r *PachydermReconciler) reconcileNaming(ctx context.Context, pd *aimlv1beta1.Pachyderm) error {
+	if pd.DeletionTimestamp != nil || pd.Annotations[aimlv1beta1.NamingAnnotation] != "" {
+		return nil
+	}
+
+	legacy := pd.DeepCopy()
+	legacy.Annotations = mergeStringMaps(legacy.Annotations, map[string]string{
+		aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingLegacy,
+	})
+	components, err := generators.Prepare(legacy)
+	if err != nil {
+		return stepFailed("ManifestsNotLoaded", err)
+	}
+
+	naming := aimlv1beta1.NamingInstance
+	etcd := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(components.EtcdStatefulSet()), etcd); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+	} else if metav1.IsControlledBy(etcd, pd) {
+		naming = aimlv1beta1.NamingLegacy
+	}
+
+	if naming == aimlv1beta1.NamingLegacy {
+		if err := r.adoptLegacyVolumeClaims(ctx, components); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(pd, corev1.EventTypeNormal, "LegacyNamesKept",
+			"keeping the names of objects deployed by an earlier version of the operator, statefulset %s is reused", etcd.Name)
+	}
+
+	patch := client.MergeFrom(pd.DeepCopy())
+	pd.Annotations = mergeStringMaps(pd.Annotations, map[string]string{
+		aimlv1beta1.NamingAnnotation: naming,
+	})
+
+	return r.Patch(ctx, pd, patch)
+}
+
+// adoptLegacyVolumeClaims labels the volume claims of the legacy
+// statefulsets with the instance label, so the deletion policy
+// finds them like the volume claims of prefixed statefulsets
+func (r *PachydermReconciler) adoptLegacyVolumeClaims(ctx context.Context, components *generators.PachydermComponents) error {
+	pd := components.Parent()
+
+	prefixes := []string{}
+	for _, sts := range []*appsv1.StatefulSet{components.EtcdStatefulSet(), components.PostgreStatefulset()} {
+		for _, vct := range sts.Spec.VolumeClaimTemplates {
+			prefixes = append(prefixes, vct.Name+"-"+sts.Name+"-")
+		}
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcs, client.InNamespace(pd.Namespace)); err != nil {
+		return err
+	}
+
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if _, ok := pvc.Labels[generators.InstanceLabel]; ok || !hasAnyPrefix(pvc.Name, prefixes) {
+			continue
+		}
+
+		patch := client.MergeFrom(pvc.DeepCopy())
+		pvc.Labels = mergeStringMaps(pvc.Labels, map[string]string{
+			generators.InstanceLabel: pd.Name,
+		})
+		if err := r.Patch(ctx, pvc, patch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasAnyPrefix returns true if name starts with one of the prefixes
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteLegacyClusterRBAC deletes the cluster role bindings and cluster
+// roles deployed with unprefixed names by earlier versions of the
+// operator, which are replaced by the objects of the pachyderm resource.
+// Legacy bindings are only deleted when all their subjects are in the
+// namespace of the resource, and legacy cluster roles once no cluster
+// role binding refers to them.
+func (r *PachydermReconciler) deleteLegacyClusterRBAC(ctx context.Context, components *generators.PachydermComponents) error {
+	pd := components.Parent()
+
+	for _, crb := range components.ClusterRoleBindings {
+		legacy := &rbacv1.ClusterRoleBinding{}
+		legacyKey := types.NamespacedName{Name: generators.LegacyClusterName(pd, crb.Name)}
+		if err := r.Get(ctx, legacyKey, legacy); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if !isLegacyClusterObject(legacy) || !subjectsInNamespace(legacy.Subjects, pd.Namespace) {
+			continue
+		}
+
+		if err := r.Delete(ctx, legacy); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		r.Recorder.Eventf(pd, corev1.EventTypeNormal, "LegacyObjectDeleted",
+			"deleted cluster role binding %s, replaced by %s", legacy.Name, crb.Name)
+	}
+
+	var bindings *rbacv1.ClusterRoleBindingList
+	for _, role := range components.ClusterRoles {
+		legacy := &rbacv1.ClusterRole{}
+		legacyKey := types.NamespacedName{Name: generators.LegacyClusterName(pd, role.Name)}
+		if err := r.Get(ctx, legacyKey, legacy); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if !isLegacyClusterObject(legacy) {
+			continue
+		}
+
+		if bindings == nil {
+			bindings = &rbacv1.ClusterRoleBindingList{}
+			if err := r.List(ctx, bindings); err != nil {
+				return err
+			}
+		}
+		if clusterRoleBound(bindings.Items, legacy.Name) {
+			continue
+		}
+
+		if err := r.Delete(ctx, legacy); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		r.Recorder.Eventf(pd, corev1.EventTypeNormal, "LegacyObjectDeleted",
+			"deleted cluster role %s, replaced by %s", legacy.Name, role.Name)
+	}
+
+	return nil
+}
+
+// isLegacyClusterObject returns true if a cluster scoped object was
+// deployed from the pachyderm manifests by an earlier operator version,
+// which did not label the objects with the pachyderm resource
+func isLegacyClusterObject(obj client.Object) bool {
+	labels := obj.GetLabels()
+	_, owned := labels[generators.InstanceLabel]
+	return !owned && labels["suite"] == "pachyderm"
+}
+
+// subjectsInNamespace returns true if all the
+// subjects of a binding are in the namespace
+func subjectsInNamespace(subjects []rbacv1.Subject, namespace string) bool {
+	for _, subject := range subjects {
+		if subject.Namespace != namespace {
+			return false
+		}
+	}
+	return true
+}
+
+// clusterRoleBound returns true if a cluster
+// role binding refers to the cluster role
+func clusterRoleBound(bindings []rbacv1.ClusterRoleBinding, name string) bool {
+	for _, crb := range bindings {
+		if crb.RoleRef.Kind == "ClusterRole" && crb.RoleRef.Name == name {
+			return true
+		}
+	}
+	return false
+}
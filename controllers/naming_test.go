@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("reconcileNaming", func() {
+	var (
+		ctx    context.Context
+		scheme *runtime.Scheme
+		pd     *aimlv1beta1.Pachyderm
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = newTestScheme()
+		pd = newTestPachyderm()
+	})
+
+	reconciler := func(objs ...runtime.Object) *PachydermReconciler {
+		return &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, append(objs, pd)...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	}
+
+	It("prefixes the objects of new resources", func() {
+		r := reconciler()
+		Expect(r.reconcileNaming(ctx, pd)).To(Succeed())
+		Expect(pd.Annotations).To(HaveKeyWithValue(aimlv1beta1.NamingAnnotation, aimlv1beta1.NamingInstance))
+
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components.EtcdStatefulSet().Name).To(Equal("pachyderm-etcd"))
+		Expect(components.PachdDeployment().Name).To(Equal("pachyderm-pachd"))
+	})
+
+	It("keeps the names of resources deployed by an earlier operator", func() {
+		// objects created before the names were prefixed
+		etcd := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: pd.Namespace},
+			Spec: appsv1.StatefulSetSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "etcd", "suite": "pachyderm"}},
+			},
+		}
+		Expect(controllerutil.SetControllerReference(pd, etcd, scheme)).To(Succeed())
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "etcd-storage-etcd-0", Namespace: pd.Namespace},
+		}
+		unrelated := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data-other-0", Namespace: pd.Namespace},
+		}
+
+		r := reconciler(etcd, pvc, unrelated)
+		Expect(r.reconcileNaming(ctx, pd)).To(Succeed())
+		Expect(pd.Annotations).To(HaveKeyWithValue(aimlv1beta1.NamingAnnotation, aimlv1beta1.NamingLegacy))
+
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pvc), pvc)).To(Succeed())
+		Expect(pvc.Labels).To(HaveKeyWithValue(generators.InstanceLabel, pd.Name))
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(unrelated), unrelated)).To(Succeed())
+		Expect(unrelated.Labels).NotTo(HaveKey(generators.InstanceLabel))
+
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		sts := components.EtcdStatefulSet()
+		Expect(sts.Name).To(Equal("etcd"))
+		Expect(sts.Spec.Selector).To(Equal(etcd.Spec.Selector))
+		Expect(components.PachdDeployment().Name).To(Equal("pachd"))
+		Expect(components.PostgresService().Name).To(Equal("postgres"))
+		Expect(components.PostgresService().Spec.Selector).NotTo(HaveKey(generators.InstanceLabel))
+		Expect(components.StorageSecretName()).To(Equal("pachyderm-storage-secret"))
+	})
+
+	It("does not adopt objects owned by another resource", func() {
+		other := newTestPachyderm()
+		other.Name = "other"
+		other.UID = "8f5e0f8a-6a0c-4d6f-9f6b-2b3c1d1e0a22"
+		etcd := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: pd.Namespace},
+		}
+		Expect(controllerutil.SetControllerReference(other, etcd, scheme)).To(Succeed())
+
+		r := reconciler(etcd)
+		Expect(r.reconcileNaming(ctx, pd)).To(Succeed())
+		Expect(pd.Annotations).To(HaveKeyWithValue(aimlv1beta1.NamingAnnotation, aimlv1beta1.NamingInstance))
+	})
+
+	It("reports versions missing from the version catalog", func() {
+		pd.Spec.Version = "1.9.0"
+		r := reconciler()
+		err := r.reconcileNaming(ctx, pd)
+		Expect(err).To(HaveOccurred())
+
+		var stepErr *reconcileError
+		Expect(errors.As(err, &stepErr)).To(BeTrue())
+		Expect(stepErr.reason).To(Equal("ManifestsNotLoaded"))
+	})
+
+	It("keeps the recorded naming", func() {
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingLegacy}
+		r := reconciler()
+		Expect(r.reconcileNaming(ctx, pd)).To(Succeed())
+		Expect(pd.Annotations).To(HaveKeyWithValue(aimlv1beta1.NamingAnnotation, aimlv1beta1.NamingLegacy))
+	})
+})
+
+var _ = Describe("deleteLegacyClusterRBAC", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		pd         *aimlv1beta1.Pachyderm
+		components *generators.PachydermComponents
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = newTestScheme()
+		pd = newTestPachyderm()
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingLegacy}
+
+		var err error
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// legacyObjects returns the cluster role and binding
+	// deployed by an earlier version of the operator
+	legacyObjects := func(namespace string) (*rbacv1.ClusterRole, *rbacv1.ClusterRoleBinding) {
+		labels := map[string]string{"app": "", "suite": "pachyderm"}
+		role := &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "pachyderm", Labels: labels},
+		}
+		crb := &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "pachyderm", Labels: labels},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "pachyderm"},
+			Subjects: []rbacv1.Subject{
+				{Kind: "ServiceAccount", Name: "pachyderm", Namespace: namespace},
+			},
+		}
+		return role, crb
+	}
+
+	reconcile := func(objs ...runtime.Object) *PachydermReconciler {
+		r := &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, append(objs, pd)...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+		Expect(r.reconcileClusterRoles(ctx, components)).To(Succeed())
+		Expect(r.reconcileClusterRoleBindings(ctx, components)).To(Succeed())
+		return r
+	}
+
+	It("replaces the cluster role and binding of earlier operators", func() {
+		role, crb := legacyObjects(pd.Namespace)
+		r := reconcile(role, crb)
+
+		Expect(apierrors.IsNotFound(r.Get(ctx, client.ObjectKeyFromObject(crb), crb))).To(BeTrue())
+		Expect(apierrors.IsNotFound(r.Get(ctx, client.ObjectKeyFromObject(role), role))).To(BeTrue())
+
+		instance := &rbacv1.ClusterRoleBinding{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(&components.ClusterRoleBindings[0]), instance)).To(Succeed())
+		Expect(instance.Labels).To(HaveKeyWithValue(generators.InstanceLabel, pd.Name))
+	})
+
+	It("keeps a binding granting permissions to another namespace", func() {
+		role, crb := legacyObjects("other")
+		r := reconcile(role, crb)
+
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(crb), crb)).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(role), role)).To(Succeed())
+	})
+
+	It("keeps objects that were not deployed by an earlier operator", func() {
+		role, crb := legacyObjects(pd.Namespace)
+		role.Labels = nil
+		crb.Labels = nil
+		r := reconcile(role, crb)
+
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(crb), crb)).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(role), role)).To(Succeed())
+	})
+})
@@ -19,23 +19,28 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"net"
 	"reflect"
-	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
 	"github.com/opdev/pachyderm-operator/controllers/generators"
+	"github.com/opdev/pachyderm-operator/controllers/probe"
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
@@ -46,15 +51,36 @@ import (
 const (
 	pachydermFinalizer string = "finalizer.pachyderm.com"
 
+	// secretRefIndex indexes pachyderm resources
+	// by the names of the secrets they reference
+	secretRefIndex string = ".spec.secretRefs"
+
 	// ErrEtcdNotReady is returned when Etcd is not ready
 	ErrEtcdNotReady generators.PachydermError = "waiting for etcd"
+
+	// ErrCertificateNotReady is returned when a cert-manager
+	// certificate requested for pachd has not been issued yet
+	ErrCertificateNotReady generators.PachydermError = "waiting for certificate"
+
+	// ErrUpgradeInProgress is returned while an upgrade waits
+	// for the components of the current step to become ready
+	ErrUpgradeInProgress generators.PachydermError = "waiting for upgrade step"
 )
 
 // PachydermReconciler reconciles a Pachyderm object
 type PachydermReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Prober checks whether pachd is ready to serve requests
+	Prober probe.Prober
+	// EnableRoutes exposes components using
+	// OpenShift routes instead of ingresses
+	EnableRoutes bool
+	// EnableCertManager allows pachyderm resources
+	// to request certificates from cert-manager
+	EnableCertManager bool
 }
 
 //+kubebuilder:rbac:groups=aiml.pachyderm.com,resources=pachyderms,verbs=get;list;watch;create;update;patch;delete
@@ -64,6 +90,8 @@ type PachydermReconciler struct {
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;update;patch;delete;deletecollection
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch;create;update;patch;delete
@@ -71,12 +99,16 @@ type PachydermReconciler struct {
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=pods/log,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=endpoints,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=core,resources=replicationcontrollers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=replicationcontrollers/scale,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterrolebindings,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterrolebindings,verbs=get;list;watch;create;update;patch;delete;deletecollection
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes/custom-host,verbs=create
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=security.openshift.io,resources=securitycontextconstraints,resourceNames=anyuid,verbs=use
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -99,6 +131,13 @@ func (r *PachydermReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	if err := r.reconcileNaming(ctx, pd); err != nil {
+		if statusErr := r.reportFailure(ctx, pd, err); statusErr != nil {
+			r.Log.Error(statusErr, "unable to report failure", "pachyderm", req.NamespacedName)
+		}
+		return ctrl.Result{}, err
+	}
+
 	if err := r.reconcileStatus(ctx, pd); err != nil {
 		if errors.IsNotFound(err) {
 			return ctrl.Result{}, nil
@@ -110,9 +149,16 @@ func (r *PachydermReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	}
 
 	if err := r.reconcilePachydermObj(ctx, pd); err != nil {
-		if err == ErrEtcdNotReady {
+		if isWaiting(err) {
 			return ctrl.Result{RequeueAfter: 2 * time.Second}, nil
 		}
+		if statusErr := r.reportFailure(ctx, pd, err); statusErr != nil {
+			r.Log.Error(statusErr, "unable to report failure", "pachyderm", req.NamespacedName)
+		}
+		return ctrl.Result{}, err
+	}
+
+	if err := r.clearFailure(ctx, pd); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -121,18 +167,69 @@ func (r *PachydermReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PachydermReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if r.Prober == nil {
+		r.Prober = probe.NewGRPCProber(probe.DefaultTimeout)
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &aimlv1beta1.Pachyderm{}, secretRefIndex,
+		func(obj client.Object) []string {
+			return obj.(*aimlv1beta1.Pachyderm).ReferencedSecrets()
+		}); err != nil {
+		return err
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&aimlv1beta1.Pachyderm{}).
 		Owns(&networkingv1.Ingress{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.Service{}).
 		Owns(&corev1.Secret{}).
 		Owns(&rbacv1.Role{}).
 		Owns(&rbacv1.RoleBinding{}).
+		Owns(&aimlv1beta1.PachydermBackup{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.pachydermsForSecret))
+
+	if r.EnableRoutes {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(generators.RouteGVK)
+		builder = builder.Owns(route)
+	}
+
+	if r.EnableCertManager {
+		cert := &unstructured.Unstructured{}
+		cert.SetGroupVersionKind(generators.CertificateGVK)
+		builder = builder.Owns(cert)
+	}
+
+	return builder.
 		WithEventFilter(filterEvents()).
 		Complete(r)
 }
 
+// pachydermsForSecret returns reconcile requests for
+// the pachyderm resources referencing the secret
+func (r *PachydermReconciler) pachydermsForSecret(secret client.Object) []reconcile.Request {
+	pds := &aimlv1beta1.PachydermList{}
+	if err := r.List(context.Background(), pds,
+		client.InNamespace(secret.GetNamespace()),
+		client.MatchingFields{secretRefIndex: secret.GetName()}); err != nil {
+		r.Log.Error(err, "unable to list pachyderm resources referencing secret",
+			"secret", client.ObjectKeyFromObject(secret))
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, pd := range pds.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&pd),
+		})
+	}
+
+	return requests
+}
+
 func filterEvents() predicate.Funcs {
 	return predicate.Funcs{
 		DeleteFunc: func(event.DeleteEvent) bool {
@@ -154,7 +251,79 @@ func (r *PachydermReconciler) validatePachyderm(ctx context.Context, components
 		components.SetGoogleCredentials(credentials)
 	}
 
-	return nil
+	if err := r.reconcileCertificates(ctx, components); err != nil {
+		return err
+	}
+
+	credentials, err := r.storageCredentials(ctx, pd)
+	if err != nil {
+		return err
+	}
+	components.SetStorageCredentials(credentials)
+
+	return r.reportDeprecatedFields(ctx, pd)
+}
+
+// storageCredentials reads the credentials from the secret
+// keys referenced by the pachyderm resource
+func (r *PachydermReconciler) storageCredentials(ctx context.Context, pd *aimlv1beta1.Pachyderm) (generators.StorageCredentials, error) {
+	credentials := generators.StorageCredentials{}
+	storage := pd.Spec.Pachd.Storage
+
+	refs := map[*[]byte]*corev1.SecretKeySelector{
+		&credentials.PostgresPassword: pd.Spec.Pachd.Postgres.PasswordFrom,
+	}
+
+	switch {
+	case storage.Backend == "amazon" && storage.Amazon != nil:
+		refs[&credentials.ID] = storage.Amazon.IDFrom
+		refs[&credentials.Secret] = storage.Amazon.SecretFrom
+		refs[&credentials.Token] = storage.Amazon.TokenFrom
+	case storage.Backend == "minio" && storage.Minio != nil:
+		refs[&credentials.ID] = storage.Minio.IDFrom
+		refs[&credentials.Secret] = storage.Minio.SecretFrom
+	case storage.Backend == "microsoft" && storage.Microsoft != nil:
+		refs[&credentials.ID] = storage.Microsoft.IDFrom
+		refs[&credentials.Secret] = storage.Microsoft.SecretFrom
+	}
+
+	for value, ref := range refs {
+		if ref == nil {
+			continue
+		}
+
+		data, err := r.secretKeyValue(ctx, pd.Namespace, ref)
+		if err != nil {
+			return credentials, err
+		}
+		*value = data
+	}
+
+	return credentials, nil
+}
+
+// secretKeyValue returns the value of the secret key
+func (r *PachydermReconciler) secretKeyValue(ctx context.Context, namespace string, ref *corev1.SecretKeySelector) ([]byte, error) {
+	optional := ref.Optional != nil && *ref.Optional
+	secretKey := types.NamespacedName{
+		Namespace: namespace,
+		Name:      ref.Name,
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, secretKey, secret); err != nil {
+		if errors.IsNotFound(err) && optional {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	value, ok := secret.Data[ref.Key]
+	if !ok && !optional {
+		return nil, fmt.Errorf("key %s not found in secret %s", ref.Key, ref.Name)
+	}
+
+	return value, nil
 }
 
 func (r *PachydermReconciler) googleCredentialsJSON(ctx context.Context, pd *aimlv1beta1.Pachyderm) ([]byte, error) {
@@ -175,150 +344,94 @@ func (r *PachydermReconciler) googleCredentialsJSON(ctx context.Context, pd *aim
 }
 
 func (r *PachydermReconciler) reconcilePachydermObj(ctx context.Context, pd *aimlv1beta1.Pachyderm) error {
-	components := generators.Prepare(pd)
+	components, err := generators.Prepare(pd)
+	if err != nil {
+		return stepFailed("ManifestsNotLoaded", err)
+	}
 
 	// perform pre-checks
 	if err := r.validatePachyderm(ctx, components); err != nil {
-		return err
+		return stepFailed("ValidationFailed", err)
 	}
 
 	// Deploy service accounts
 	if err := r.reconcileServiceAccounts(ctx, components); err != nil {
-		return err
+		return stepFailed("ServiceAccountsFailed", err)
 	}
 
 	// roles
 	if err := r.reconcileRoles(ctx, components); err != nil {
-		return err
+		return stepFailed("RolesFailed", err)
 	}
 
 	// role bindings
 	if err := r.reconcileRoleBindings(ctx, components); err != nil {
-		return err
+		return stepFailed("RoleBindingsFailed", err)
 	}
 
 	// cluster roles
 	if err := r.reconcileClusterRoles(ctx, components); err != nil {
-		return err
+		return stepFailed("ClusterRolesFailed", err)
 	}
 
 	// cluster role bindings
 	if err := r.reconcileClusterRoleBindings(ctx, components); err != nil {
-		return err
+		return stepFailed("ClusterRoleBindingsFailed", err)
 	}
 
-	// Deploy secrets
-	if err := r.reconcileSecrets(ctx, components); err != nil {
-		return err
-	}
+	// secrets, configmaps and services are deployed
+	// with pachd, see upgradeSteps
 
-	// Deploy configmaps
-	if err := r.reconcileConfigMaps(ctx, components); err != nil {
-		return err
+	// Deploy routes on OpenShift, ingresses otherwise
+	if r.EnableRoutes {
+		if err := r.reconcileRoutes(ctx, components); err != nil {
+			return stepFailed("RoutesFailed", err)
+		}
+	} else if err := r.reconcileIngresses(ctx, components); err != nil {
+		return stepFailed("IngressesFailed", err)
 	}
 
-	// Deploy services
-	if err := r.reconcileServices(ctx, components); err != nil {
-		return err
+	// Request certificates from cert-manager
+	if err := r.reconcileCertificateRequests(ctx, components); err != nil {
+		return stepFailed("CertificatesFailed", err)
 	}
 
 	// Deploy storage class
 	if err := r.reconcileStorageClass(ctx, components); err != nil {
-		return err
-	}
-
-	if err := r.deployEtcd(ctx, components); err != nil {
-		return err
-	}
-
-	if err := r.deployPostgres(ctx, components); err != nil {
-		return err
+		return stepFailed("StorageClassFailed", err)
 	}
 
-	if err := r.deployPachd(ctx, components); err != nil {
-		return err
-	}
-
-	if err := r.deployDash(ctx, components); err != nil {
-		return err
-	}
-
-	return nil
+	return r.deployComponents(ctx, components)
 }
 
-// TODO: cleanup Pachyderm objects
-// - service accounts
+// cleanupPachydermResources deletes the objects that
+// are not garbage collected with the pachyderm resource
 func (r *PachydermReconciler) cleanupPachydermResources(ctx context.Context, pd *aimlv1beta1.Pachyderm) error {
-	pds := &aimlv1beta1.PachydermList{}
-	if err := r.List(ctx, pds, client.InNamespace(pd.Namespace)); err != nil {
+	components, err := generators.Prepare(pd)
+	if err != nil {
 		return err
 	}
 
-	// delete cluster resources
-	components := generators.Prepare(pd)
-	if len(pds.Items) <= 1 {
-		// delete roles
-		for _, role := range components.Roles {
-			if err := r.Delete(ctx, &role); err != nil {
-				if errors.IsNotFound(err) {
-					return nil
-				}
-				return err
-			}
-		}
-
-		// delete role bindings
-		for _, rb := range components.RoleBindings {
-			if err := r.Delete(ctx, &rb); err != nil {
-				if errors.IsNotFound(err) {
-					return nil
-				}
-				return err
-			}
-		}
-
-		// delete service accounts
-		for _, sa := range components.ServiceAccounts {
-			if err := r.Delete(ctx, &sa); err != nil {
-				if errors.IsNotFound(err) {
-					return nil
-				}
-				return err
-			}
-		}
+	// namespaced objects are named after the pachyderm
+	// resource, so they are not shared with other instances
+	objects := []client.Object{}
+	for i := range components.Roles {
+		objects = append(objects, &components.Roles[i])
 	}
-
-	// clean up cluster resources
-	if err := r.List(ctx, pds); err != nil {
-		if errors.IsNotFound(err) {
-			return nil
-		}
-		return err
+	for i := range components.RoleBindings {
+		objects = append(objects, &components.RoleBindings[i])
+	}
+	for i := range components.ServiceAccounts {
+		objects = append(objects, &components.ServiceAccounts[i])
 	}
 
-	if len(pds.Items) <= 1 {
-		// delete cluster role bindings
-		for _, crb := range components.ClusterRoleBindings {
-			if err := r.Delete(ctx, &crb); err != nil {
-				if errors.IsNotFound(err) {
-					return nil
-				}
-				return err
-			}
-		}
-
-		// delete cluster roles
-		for _, cr := range components.ClusterRoles {
-			if err := r.Delete(ctx, &cr); err != nil {
-				if errors.IsNotFound(err) {
-					return nil
-				}
-				return err
-			}
+	for _, obj := range objects {
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			return err
 		}
 	}
 
-	return nil
+	return r.applyDeletionPolicy(ctx, components)
 }
 
 // TODO: set finalizer and status for Pachyderm resource
@@ -346,8 +459,29 @@ func (r *PachydermReconciler) reconcileStatus(ctx context.Context, pd *aimlv1bet
 		current.Status.Phase = aimlv1beta1.PhaseInitializing
 	}
 
-	if r.isPachydermRunning(ctx, pd) && pd.DeletionTimestamp == nil {
-		current.Status.Phase = aimlv1beta1.PhaseRunning
+	if pd.DeletionTimestamp == nil {
+		// manifests that can not be loaded are reported
+		// as a failed step by reconcilePachydermObj
+		ready := false
+		if components, err := generators.Prepare(current); err == nil {
+			if _, err := r.loadCertificateSecrets(ctx, components); err != nil {
+				return err
+			}
+			ready = r.setComponentConditions(ctx, components)
+		}
+
+		if ready && current.Status.Phase != aimlv1beta1.PhaseFailed {
+			current.Status.Phase = aimlv1beta1.PhaseRunning
+		}
+
+		// the current version of a new deployment is recorded once
+		// all its components are ready, later changes to the version
+		// are rolled out as upgrades
+		current.Status.TargetVersion = catalog.Canonical(current.Spec.Version)
+		if ready && current.Status.CurrentVersion == "" {
+			current.Status.CurrentVersion = current.Status.TargetVersion
+		}
+		current.Status.ObservedGeneration = current.Generation
 	}
 
 	if err := r.Status().Patch(ctx, current, client.MergeFrom(pd)); err != nil {
@@ -360,53 +494,6 @@ func (r *PachydermReconciler) reconcileStatus(ctx context.Context, pd *aimlv1bet
 	return nil
 }
 
-func (r *PachydermReconciler) isPachydermRunning(ctx context.Context, pd *aimlv1beta1.Pachyderm) bool {
-	// check status of etcd
-	etcdSvc := types.NamespacedName{
-		Name:      "etcd",
-		Namespace: pd.Namespace,
-	}
-	if !r.isServiceReady(ctx, etcdSvc) {
-		return false
-	}
-
-	// check status of pachd
-	pachdSvc := types.NamespacedName{
-		Name:      "pachd",
-		Namespace: pd.Namespace,
-	}
-	if !r.isServiceReady(ctx, pachdSvc) {
-		return false
-	}
-
-	if !pd.Spec.Dashd.Disable {
-		// check status of dash
-		dashSvc := types.NamespacedName{
-			Name:      "dash",
-			Namespace: pd.Namespace,
-		}
-		if !r.isServiceReady(ctx, dashSvc) {
-			return false
-		}
-	}
-
-	// pachd-peer connection test
-	return testPachdPeerConnection(ctx, pd)
-}
-
-func testPachdPeerConnection(ctx context.Context, pd *aimlv1beta1.Pachyderm) bool {
-	hostname := strings.Join([]string{"pachd-peer", pd.Namespace}, ".")
-	pachdPeer := fmt.Sprintf("%s:%s", hostname, "30653")
-
-	conn, err := net.Dial("tcp", pachdPeer)
-	if err != nil {
-		return false
-	}
-	defer conn.Close()
-
-	return (conn != nil)
-}
-
 func (r *PachydermReconciler) reconcileFinalizer(ctx context.Context, pd *aimlv1beta1.Pachyderm) error {
 	currentFinalizers := pd.Finalizers
 
@@ -480,7 +567,10 @@ func (r *PachydermReconciler) reconcileClusterRoles(ctx context.Context, compone
 
 		if err := r.Create(ctx, &clusterrole); err != nil {
 			if errors.IsAlreadyExists(err) {
-				return nil
+				if err := r.checkClusterOwner(ctx, components.Parent(), &rbacv1.ClusterRole{}, clusterrole.Name); err != nil {
+					return err
+				}
+				continue
 			}
 
 			return err
@@ -514,13 +604,39 @@ func (r *PachydermReconciler) reconcileClusterRoleBindings(ctx context.Context,
 
 		if err := r.Create(ctx, &crb); err != nil {
 			if errors.IsAlreadyExists(err) {
-				return nil
+				if err := r.checkClusterOwner(ctx, components.Parent(), &rbacv1.ClusterRoleBinding{}, crb.Name); err != nil {
+					return err
+				}
+				continue
 			}
 
 			return err
 		}
 	}
 
+	// the bindings deployed by earlier versions of the operator
+	// are replaced by the bindings of the pachyderm resource
+	if generators.LegacyNames(components.Parent()) {
+		return r.deleteLegacyClusterRBAC(ctx, components)
+	}
+
+	return nil
+}
+
+// checkClusterOwner checks an existing cluster scoped object belongs
+// to the pachyderm resource. The names of cluster scoped objects join
+// the namespace and name of the resource, which two resources can share.
+func (r *PachydermReconciler) checkClusterOwner(ctx context.Context, pd *aimlv1beta1.Pachyderm, obj client.Object, name string) error {
+	if err := r.Get(ctx, types.NamespacedName{Name: name}, obj); err != nil {
+		return err
+	}
+
+	labels := obj.GetLabels()
+	if labels[generators.InstanceLabel] != pd.Name || labels[generators.InstanceNamespaceLabel] != pd.Namespace {
+		return fmt.Errorf("%s already exists and does not belong to pachyderm %s/%s",
+			name, pd.Namespace, pd.Name)
+	}
+
 	return nil
 }
 
@@ -565,7 +681,12 @@ func (r *PachydermReconciler) reconcileServices(ctx context.Context, components
 func (r *PachydermReconciler) reconcileSecrets(ctx context.Context, components *generators.PachydermComponents) error {
 	pd := components.Parent()
 
-	for _, secret := range components.Secrets() {
+	secrets, err := components.Secrets()
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range secrets {
 		// set owner reference
 		if err := controllerutil.SetControllerReference(pd, secret, r.Scheme); err != nil {
 			return err
@@ -592,7 +713,7 @@ func (r *PachydermReconciler) reconcileSecrets(ctx context.Context, components *
 					}
 				}
 				// secret exists
-				return nil
+				continue
 			}
 
 			return err
@@ -605,7 +726,12 @@ func (r *PachydermReconciler) reconcileSecrets(ctx context.Context, components *
 func (r *PachydermReconciler) reconcileConfigMaps(ctx context.Context, components *generators.PachydermComponents) error {
 	pd := components.Parent()
 
-	for _, cm := range components.ConfgigMaps() {
+	configMaps, err := components.ConfgigMaps()
+	if err != nil {
+		return err
+	}
+
+	for _, cm := range configMaps {
 		// set owner reference
 		if err := controllerutil.SetControllerReference(pd, cm, r.Scheme); err != nil {
 			return err
@@ -632,7 +758,7 @@ func (r *PachydermReconciler) reconcileConfigMaps(ctx context.Context, component
 					}
 				}
 				// configmap exists
-				return nil
+				continue
 			}
 
 			return err
@@ -650,8 +776,7 @@ func (r *PachydermReconciler) deployEtcd(ctx context.Context, components *genera
 
 	if err := r.Create(ctx, etcd); err != nil {
 		if errors.IsAlreadyExists(err) {
-			// TODO: add update logic
-			return nil
+			return r.updateEtcd(ctx, components.Parent(), etcd)
 		}
 		return err
 	}
@@ -667,8 +792,7 @@ func (r *PachydermReconciler) deployPostgres(ctx context.Context, components *ge
 
 	if err := r.Create(ctx, postgres); err != nil {
 		if errors.IsAlreadyExists(err) {
-			// TODO: add update logic
-			return nil
+			return r.updatePostgres(ctx, postgres)
 		}
 		return err
 	}
@@ -676,18 +800,42 @@ func (r *PachydermReconciler) deployPostgres(ctx context.Context, components *ge
 	return nil
 }
 
+// updatePostgres patches the pod template of an existing
+// postgresql statefulset if it differs from the desired template
+func (r *PachydermReconciler) updatePostgres(ctx context.Context, desired *appsv1.StatefulSet) error {
+	current := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(desired), current); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	if templateHashBackfilled(&current.ObjectMeta, &current.Spec.Template, &desired.Spec.Template) ||
+		templateChanged(&current.ObjectMeta, &current.Spec.Template, &desired.Spec.Template) {
+		return r.Patch(ctx, current, patch)
+	}
+
+	return nil
+}
+
 func (r *PachydermReconciler) deployPachd(ctx context.Context, components *generators.PachydermComponents) error {
 	pd := components.Parent()
 
 	// Check Etcd is ready before deploying pachd
-	etcdSvc := types.NamespacedName{
-		Name:      "etcd",
-		Namespace: pd.Namespace,
-	}
-	if !r.isServiceReady(ctx, etcdSvc) {
+	if ready, _ := r.isStatefulSetReady(ctx, components.EtcdStatefulSet()); !ready {
 		return ErrEtcdNotReady
 	}
 
+	// Check the pachd certificate was issued before deploying pachd
+	if cert := components.PachdCertificate(); cert != nil {
+		ready, err := r.isCertificateReady(ctx, cert)
+		if err != nil {
+			return err
+		}
+		if !ready {
+			return ErrCertificateNotReady
+		}
+	}
+
 	pachd := components.PachdDeployment()
 	if err := controllerutil.SetControllerReference(pd, pachd, r.Scheme); err != nil {
 		return err
@@ -695,8 +843,7 @@ func (r *PachydermReconciler) deployPachd(ctx context.Context, components *gener
 
 	if err := r.Create(ctx, pachd); err != nil {
 		if errors.IsAlreadyExists(err) {
-			// TODO: add update logic
-			return nil
+			return r.updateDeployment(ctx, pachd)
 		}
 		return err
 	}
@@ -704,6 +851,27 @@ func (r *PachydermReconciler) deployPachd(ctx context.Context, components *gener
 	return nil
 }
 
+// updateDeployment patches an existing deployment
+// if it differs from the desired deployment
+func (r *PachydermReconciler) updateDeployment(ctx context.Context, desired *appsv1.Deployment) error {
+	current := &appsv1.Deployment{}
+	deployKey := types.NamespacedName{
+		Name:      desired.Name,
+		Namespace: desired.Namespace,
+	}
+
+	if err := r.Get(ctx, deployKey, current); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	if deploymentChanged(current, desired) {
+		return r.Patch(ctx, current, patch)
+	}
+
+	return nil
+}
+
 func (r *PachydermReconciler) deployDash(ctx context.Context, components *generators.PachydermComponents) error {
 	pd := components.Parent()
 
@@ -715,8 +883,7 @@ func (r *PachydermReconciler) deployDash(ctx context.Context, components *genera
 
 		if err := r.Create(ctx, dash); err != nil {
 			if errors.IsAlreadyExists(err) {
-				// TODO: add update logic
-				return nil
+				return r.updateDeployment(ctx, dash)
 			}
 			return err
 		}
@@ -747,18 +914,3 @@ func (r *PachydermReconciler) reconcileStorageClass(ctx context.Context, compone
 
 	return nil
 }
-
-func (r *PachydermReconciler) isServiceReady(ctx context.Context, service types.NamespacedName) bool {
-	ep := &corev1.Endpoints{}
-	if err := r.Get(ctx, service, ep); err != nil {
-		return false
-	}
-
-	addresses := []corev1.EndpointAddress{}
-
-	for _, subset := range ep.Subsets {
-		addresses = append(addresses, subset.Addresses...)
-	}
-
-	return len(addresses) > 0
-}
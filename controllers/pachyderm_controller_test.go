@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("cluster scoped RBAC", func() {
+	var (
+		ctx    context.Context
+		scheme *runtime.Scheme
+		pd     *aimlv1beta1.Pachyderm
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = newTestScheme()
+		pd = newTestPachyderm()
+		pd.Name = "c"
+		pd.Namespace = "a-b"
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+	})
+
+	reconciler := func(objs ...runtime.Object) *PachydermReconciler {
+		return &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, objs...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	}
+
+	It("creates the cluster roles and bindings of the resource", func() {
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		r := reconciler()
+		for i := 0; i < 2; i++ {
+			Expect(r.reconcileClusterRoles(ctx, components)).To(Succeed())
+			Expect(r.reconcileClusterRoleBindings(ctx, components)).To(Succeed())
+		}
+
+		bindings := &rbacv1.ClusterRoleBindingList{}
+		Expect(r.List(ctx, bindings, client.MatchingLabels(generators.ClusterOwnerLabels(pd)))).To(Succeed())
+		Expect(bindings.Items).To(HaveLen(len(components.ClusterRoleBindings)))
+	})
+
+	It("does not share the objects of a resource with the same names", func() {
+		// a-b/c and a/b-c join into the same cluster scoped names
+		other := newTestPachyderm()
+		other.Name = "b-c"
+		other.Namespace = "a"
+		other.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+		otherComponents, err := generators.Prepare(other)
+		Expect(err).NotTo(HaveOccurred())
+
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components.ClusterRoleBindings[0].Name).To(Equal(otherComponents.ClusterRoleBindings[0].Name))
+
+		r := reconciler()
+		Expect(r.reconcileClusterRoles(ctx, otherComponents)).To(Succeed())
+		Expect(r.reconcileClusterRoleBindings(ctx, otherComponents)).To(Succeed())
+
+		Expect(r.reconcileClusterRoles(ctx, components)).To(MatchError(ContainSubstring("does not belong to pachyderm a-b/c")))
+		Expect(r.reconcileClusterRoleBindings(ctx, components)).To(MatchError(ContainSubstring("does not belong to pachyderm a-b/c")))
+	})
+})
+
+var _ = Describe("reconcileSecrets", func() {
+	It("updates the secrets that changed and creates the others", func() {
+		ctx := context.Background()
+		scheme := newTestScheme()
+		pd := newTestPachyderm()
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+		pd.Spec.Pachd.Storage = aimlv1beta1.ObjectStorageOptions{
+			Backend: "minio",
+			Minio: &aimlv1beta1.MinioStorageOptions{
+				Bucket:   "pachyderm",
+				Endpoint: "minio.default.svc:9000",
+				ID:       "minio",
+				Secret:   "minio123",
+			},
+		}
+		pd.Spec.Pachd.TLS = &aimlv1beta1.PachdTLSOptions{Enabled: true}
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		secrets, err := components.Secrets()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(secrets)).To(BeNumerically(">", 1))
+
+		// every secret but the last one exists with stale data
+		stale := []runtime.Object{}
+		for _, secret := range secrets[:len(secrets)-1] {
+			secret = secret.DeepCopy()
+			secret.Data = map[string][]byte{"stale": []byte("true")}
+			stale = append(stale, secret)
+		}
+
+		r := &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, stale...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+		Expect(r.reconcileSecrets(ctx, components)).To(Succeed())
+
+		for _, secret := range secrets {
+			current := &corev1.Secret{}
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(secret), current)).To(Succeed())
+			Expect(current.Data).To(Equal(secret.Data), "secret %s", secret.Name)
+		}
+	})
+})
+
+var _ = Describe("updatePostgres", func() {
+	It("rolls out postgresql when its pod template changes", func() {
+		ctx := context.Background()
+		scheme := newTestScheme()
+		pd := newTestPachyderm()
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		desired := components.PostgreStatefulset()
+		r := &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, desired.DeepCopy()),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+		Expect(r.updatePostgres(ctx, desired)).To(Succeed())
+
+		desired = desired.DeepCopy()
+		desired.Spec.Template.Annotations["checksum/postgres-init-cm"] = "changed"
+		Expect(r.updatePostgres(ctx, desired)).To(Succeed())
+
+		current := &appsv1.StatefulSet{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(desired), current)).To(Succeed())
+		Expect(current.Spec.Template.Annotations).To(HaveKeyWithValue("checksum/postgres-init-cm", "changed"))
+	})
+})
@@ -0,0 +1,286 @@
+/*
+Copyright 2021 Pachyderm.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+// Reasons reported in the PachydermBackup status conditions
+const (
+	reasonPachydermNotFound  string = "PachydermNotFound"
+	reasonPachydermNotReady  string = "PachydermNotReady"
+	reasonUnsupportedStorage string = "UnsupportedStorage"
+	reasonJobRunning         string = "JobRunning"
+	reasonJobFailed          string = "JobFailed"
+	reasonSucceeded          string = "Succeeded"
+)
+
+// PachydermBackupReconciler reconciles a PachydermBackup object
+type PachydermBackupReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=aiml.pachyderm.com,resources=pachydermbackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aiml.pachyderm.com,resources=pachydermbackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aiml.pachyderm.com,resources=pachydermbackups/finalizers,verbs=update
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile runs a job taking a backup of the referenced Pachyderm
+// resource and records the uploaded artifacts once it completes.
+// Completed and failed backups are not reconciled again.
+func (r *PachydermBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = r.Log.WithValues("pachydermbackup", req.NamespacedName)
+
+	backup := &aimlv1beta1.PachydermBackup{}
+	if err := r.Get(ctx, req.NamespacedName, backup); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if backup.Status.Phase == aimlv1beta1.BackupPhaseCompleted ||
+		backup.Status.Phase == aimlv1beta1.BackupPhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	pd := &aimlv1beta1.Pachyderm{}
+	pdKey := types.NamespacedName{
+		Name:      backup.Spec.Pachyderm,
+		Namespace: backup.Namespace,
+	}
+	if err := r.Get(ctx, pdKey, pd); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, r.setBackupStatus(ctx, backup, aimlv1beta1.BackupPhasePending,
+				reasonPachydermNotFound, fmt.Sprintf("pachyderm %s not found", pdKey.Name))
+		}
+		return ctrl.Result{}, err
+	}
+
+	components, err := generators.Prepare(pd)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	job, err := components.BackupJob(backup)
+	if err != nil {
+		if err == generators.ErrUnsupportedBackupStorage {
+			r.Recorder.Event(backup, corev1.EventTypeWarning, "BackupFailed", err.Error())
+			return ctrl.Result{}, r.setBackupStatus(ctx, backup, aimlv1beta1.BackupPhaseFailed,
+				reasonUnsupportedStorage, err.Error())
+		}
+		return ctrl.Result{}, err
+	}
+
+	current := &batchv1.Job{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), current); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		// only running pachyderm deployments are backed up,
+		// so the backup matches the version being recorded
+		if pd.Status.Phase != aimlv1beta1.PhaseRunning {
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, r.setBackupStatus(ctx, backup, aimlv1beta1.BackupPhasePending,
+				reasonPachydermNotReady, fmt.Sprintf("waiting for pachyderm %s to be running", pd.Name))
+		}
+
+		return ctrl.Result{}, r.startBackup(ctx, backup, pd, job)
+	}
+
+	switch {
+	case jobConditionTrue(current, batchv1.JobComplete):
+		artifacts, err := r.backupArtifacts(ctx, current)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// the artifacts are listed from the job alone, so a reconcile
+		// retried after a failed status patch does not repeat them
+		backup.Status.Artifacts = make([]aimlv1beta1.BackupArtifact, 0, len(artifacts))
+		for _, artifact := range artifacts {
+			backup.Status.Artifacts = append(backup.Status.Artifacts, aimlv1beta1.BackupArtifact{
+				Name:     artifact.name,
+				Location: components.BackupArtifactLocation(backup, artifact.name),
+				Size:     artifact.size,
+			})
+		}
+		message := fmt.Sprintf("uploaded %d artifacts to %s",
+			len(artifacts), components.BackupArtifactLocation(backup, ""))
+		r.Recorder.Event(backup, corev1.EventTypeNormal, "BackupCompleted", message)
+		return ctrl.Result{}, r.setBackupStatus(ctx, backup, aimlv1beta1.BackupPhaseCompleted, reasonSucceeded, message)
+	case jobConditionTrue(current, batchv1.JobFailed):
+		message := fmt.Sprintf("job %s failed", current.Name)
+		if condition := jobCondition(current, batchv1.JobFailed); condition != nil && condition.Message != "" {
+			message = fmt.Sprintf("%s: %s", message, condition.Message)
+		}
+		r.Recorder.Event(backup, corev1.EventTypeWarning, "BackupFailed", message)
+		return ctrl.Result{}, r.setBackupStatus(ctx, backup, aimlv1beta1.BackupPhaseFailed, reasonJobFailed, message)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// startBackup creates the backup job and records the
+// version of Pachyderm the backup is taken from
+func (r *PachydermBackupReconciler) startBackup(ctx context.Context, backup *aimlv1beta1.PachydermBackup, pd *aimlv1beta1.Pachyderm, job *batchv1.Job) error {
+	if err := controllerutil.SetControllerReference(backup, job, r.Scheme); err != nil {
+		return err
+	}
+
+	if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	now := metav1.Now()
+	backup.Status.Version = pd.Status.CurrentVersion
+	backup.Status.JobName = job.Name
+	backup.Status.StartTime = &now
+	r.Recorder.Eventf(backup, corev1.EventTypeNormal, "BackupStarted",
+		"backing up pachyderm %s %s with job %s", pd.Name, pd.Status.CurrentVersion, job.Name)
+
+	return r.setBackupStatus(ctx, backup, aimlv1beta1.BackupPhaseRunning,
+		reasonJobRunning, fmt.Sprintf("waiting for job %s to complete", job.Name))
+}
+
+// setBackupStatus patches the phase and completion
+// condition of the backup along with its status fields
+func (r *PachydermBackupReconciler) setBackupStatus(ctx context.Context, backup *aimlv1beta1.PachydermBackup, phase aimlv1beta1.BackupPhase, reason, message string) error {
+	current := &aimlv1beta1.PachydermBackup{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(backup), current); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	status := backup.Status.DeepCopy()
+	status.Phase = phase
+	if (phase == aimlv1beta1.BackupPhaseCompleted || phase == aimlv1beta1.BackupPhaseFailed) &&
+		status.CompletionTime == nil {
+		now := metav1.Now()
+		status.CompletionTime = &now
+	}
+	condition := newCondition(aimlv1beta1.ConditionBackupComplete,
+		phase == aimlv1beta1.BackupPhaseCompleted, reason, message)
+	condition.ObservedGeneration = current.Generation
+	meta.SetStatusCondition(&status.Conditions, condition)
+	current.Status = *status
+
+	return r.Status().Patch(ctx, current, patch)
+}
+
+// backupArtifact is an artifact listed in the
+// termination message of the upload container
+type backupArtifact struct {
+	name string
+	size int64
+}
+
+// backupArtifacts returns the artifacts uploaded by the completed
+// backup job, read from the termination message of its pod
+func (r *PachydermBackupReconciler) backupArtifacts(ctx context.Context, job *batchv1.Job) ([]backupArtifact, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != generators.BackupUploadContainer || status.State.Terminated == nil {
+				continue
+			}
+			return parseBackupArtifacts(status.State.Terminated.Message), nil
+		}
+	}
+
+	return nil, fmt.Errorf("no succeeded pod found for job %s", job.Name)
+}
+
+// parseBackupArtifacts parses the name and size
+// of the artifacts listed one per line
+func parseBackupArtifacts(message string) []backupArtifact {
+	artifacts := []backupArtifact{}
+	scanner := bufio.NewScanner(strings.NewReader(message))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		artifacts = append(artifacts, backupArtifact{name: fields[0], size: size})
+	}
+
+	return artifacts
+}
+
+// jobCondition returns the condition of the given type of a job
+func jobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		if job.Status.Conditions[i].Type == conditionType {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// jobConditionTrue returns true if the job has
+// a condition of the given type set to true
+func jobConditionTrue(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	condition := jobCondition(job, conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PachydermBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&aimlv1beta1.PachydermBackup{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("parseBackupArtifacts", func() {
+	table.DescribeTable("termination messages",
+		func(message string, artifacts []backupArtifact) {
+			Expect(parseBackupArtifacts(message)).To(Equal(artifacts))
+		},
+		table.Entry("artifacts", "etcd.snapshot 20480\npachyderm.dump 1024\n",
+			[]backupArtifact{{name: "etcd.snapshot", size: 20480}, {name: "pachyderm.dump", size: 1024}}),
+		table.Entry("padded sizes", "etcd.snapshot    20480\n",
+			[]backupArtifact{{name: "etcd.snapshot", size: 20480}}),
+		table.Entry("empty message", "", []backupArtifact{}),
+		table.Entry("log lines", "Added `backup` successfully.\netcd.snapshot 20480\n",
+			[]backupArtifact{{name: "etcd.snapshot", size: 20480}}),
+		table.Entry("invalid sizes", "etcd.snapshot unknown\npachyderm.dump 1024\n",
+			[]backupArtifact{{name: "pachyderm.dump", size: 1024}}),
+	)
+})
+
+var _ = Describe("backupArtifacts", func() {
+	var (
+		ctx    context.Context
+		scheme *runtime.Scheme
+		job    *batchv1.Job
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = newTestScheme()
+		job = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly-backup", Namespace: "default"},
+		}
+	})
+
+	// jobPod returns a pod of the backup job
+	// with the given upload termination message
+	jobPod := func(name string, phase corev1.PodPhase, message string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: job.Namespace,
+				Labels:    map[string]string{"job-name": job.Name},
+			},
+			Status: corev1.PodStatus{
+				Phase: phase,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: generators.BackupUploadContainer,
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{Message: message},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	reconciler := func(objs ...runtime.Object) *PachydermBackupReconciler {
+		return &PachydermBackupReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, objs...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	}
+
+	It("reads the artifacts of the succeeded pod", func() {
+		r := reconciler(
+			jobPod("nightly-backup-failed", corev1.PodFailed, "etcd.snapshot 10\n"),
+			jobPod("nightly-backup-succeeded", corev1.PodSucceeded, "etcd.snapshot 20480\n"),
+		)
+
+		artifacts, err := r.backupArtifacts(ctx, job)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(artifacts).To(Equal([]backupArtifact{{name: "etcd.snapshot", size: 20480}}))
+	})
+
+	It("fails when no pod of the job succeeded", func() {
+		r := reconciler(jobPod("nightly-backup-failed", corev1.PodFailed, "etcd.snapshot 10\n"))
+
+		_, err := r.backupArtifacts(ctx, job)
+		Expect(err).To(MatchError("no succeeded pod found for job nightly-backup"))
+	})
+
+	It("records only the artifacts of the completed job", func() {
+		pd := newTestPachyderm()
+		backup := &aimlv1beta1.PachydermBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: pd.Namespace},
+			Spec: aimlv1beta1.PachydermBackupSpec{
+				Pachyderm: pd.Name,
+				Storage: &aimlv1beta1.ObjectStorageOptions{
+					Backend: "minio",
+					Minio:   &aimlv1beta1.MinioStorageOptions{Bucket: "backups", Endpoint: "minio:9000"},
+				},
+			},
+			Status: aimlv1beta1.PachydermBackupStatus{
+				Phase:     aimlv1beta1.BackupPhaseRunning,
+				Artifacts: []aimlv1beta1.BackupArtifact{{Name: "etcd.snapshot", Size: 20480}},
+			},
+		}
+		job.Status.Conditions = []batchv1.JobCondition{
+			{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+		}
+
+		r := reconciler(pd, backup, job,
+			jobPod("nightly-backup-succeeded", corev1.PodSucceeded, "etcd.snapshot 20480\npachyderm.dump 1024\n"))
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(backup)})
+		Expect(err).NotTo(HaveOccurred())
+
+		current := &aimlv1beta1.PachydermBackup{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(backup), current)).To(Succeed())
+		Expect(current.Status.Phase).To(Equal(aimlv1beta1.BackupPhaseCompleted))
+		Expect(current.Status.Artifacts).To(Equal([]aimlv1beta1.BackupArtifact{
+			{Name: "etcd.snapshot", Location: "s3://backups/pachyderm-operator/backups/default/nightly/etcd.snapshot", Size: 20480},
+			{Name: "pachyderm.dump", Location: "s3://backups/pachyderm-operator/backups/default/nightly/pachyderm.dump", Size: 1024},
+		}))
+	})
+})
@@ -0,0 +1,562 @@
+/*
+Copyright 2021 Pachyderm.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/mod/semver"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
+)
+
+// Reasons reported in the PachydermRestore status conditions
+const (
+	reasonBackupNotFound       string = "BackupNotFound"
+	reasonBackupNotCompleted   string = "BackupNotCompleted"
+	reasonBackupFailed         string = "BackupFailed"
+	reasonRestoreInProgress    string = "RestoreInProgress"
+	reasonConfirmationRequired string = "ConfirmationRequired"
+	reasonVersionMismatch      string = "VersionMismatch"
+	reasonUnsupportedRestore   string = "UnsupportedRestore"
+	reasonScalingDown          string = "ScalingDown"
+	reasonWaitingForVolume     string = "WaitingForVolumeClaim"
+	reasonScaledUp             string = "ScaledUp"
+	reasonWaitingForHealth     string = "WaitingForHealth"
+	reasonHealthCheckTimeout   string = "HealthCheckTimeout"
+)
+
+// restoreHealthTimeout is the maximum time to wait for the
+// Pachyderm resource to be healthy once its data is restored
+const restoreHealthTimeout = 10 * time.Minute
+
+// PachydermRestoreReconciler reconciles a PachydermRestore object
+type PachydermRestoreReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=aiml.pachyderm.com,resources=pachydermrestores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aiml.pachyderm.com,resources=pachydermrestores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aiml.pachyderm.com,resources=pachydermrestores/finalizers,verbs=update
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile restores a backup into the referenced Pachyderm resource.
+// The pachd and dash workloads are scaled down, then etcd, while a
+// job restores etcd and the postgresql databases, then scaled back up.
+// Completed and failed restores are not reconciled again. A failed
+// restore keeps the workloads scaled down until it is deleted.
+func (r *PachydermRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = r.Log.WithValues("pachydermrestore", req.NamespacedName)
+
+	restore := &aimlv1beta1.PachydermRestore{}
+	if err := r.Get(ctx, req.NamespacedName, restore); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if restore.DeletionTimestamp != nil {
+		return ctrl.Result{}, r.finalizeRestore(ctx, restore)
+	}
+
+	// the finalizer scales the workloads back up
+	// if the restore is deleted before it is done
+	if !controllerutil.ContainsFinalizer(restore, pachydermFinalizer) {
+		controllerutil.AddFinalizer(restore, pachydermFinalizer)
+		return ctrl.Result{}, r.Update(ctx, restore)
+	}
+
+	switch restore.Status.Phase {
+	case aimlv1beta1.RestorePhaseCompleted, aimlv1beta1.RestorePhaseFailed:
+		return ctrl.Result{}, nil
+	case aimlv1beta1.RestorePhaseScalingDown:
+		return r.scaleDown(ctx, restore)
+	case aimlv1beta1.RestorePhaseRestoring:
+		return r.restoreData(ctx, restore)
+	case aimlv1beta1.RestorePhaseScalingUp:
+		return r.verifyRestore(ctx, restore)
+	}
+
+	return r.startRestore(ctx, restore)
+}
+
+// startRestore checks the backup can be restored into the Pachyderm
+// resource and pauses its workloads. Restoring into a Pachyderm
+// resource that has already been running must be allowed explicitly.
+func (r *PachydermRestoreReconciler) startRestore(ctx context.Context, restore *aimlv1beta1.PachydermRestore) (ctrl.Result, error) {
+	backup := &aimlv1beta1.PachydermBackup{}
+	backupKey := types.NamespacedName{
+		Name:      restore.Spec.Backup,
+		Namespace: restore.Namespace,
+	}
+	if err := r.Get(ctx, backupKey, backup); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhasePending,
+				reasonBackupNotFound, fmt.Sprintf("backup %s not found", backupKey.Name))
+		}
+		return ctrl.Result{}, err
+	}
+
+	switch backup.Status.Phase {
+	case aimlv1beta1.BackupPhaseCompleted:
+	case aimlv1beta1.BackupPhaseFailed:
+		message := fmt.Sprintf("backup %s failed", backup.Name)
+		r.Recorder.Event(restore, corev1.EventTypeWarning, "RestoreFailed", message)
+		return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseFailed, reasonBackupFailed, message)
+	default:
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhasePending,
+			reasonBackupNotCompleted, fmt.Sprintf("waiting for backup %s to complete", backup.Name))
+	}
+
+	pd := &aimlv1beta1.Pachyderm{}
+	if err := r.Get(ctx, r.pachydermKey(restore), pd); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhasePending,
+				reasonPachydermNotFound, fmt.Sprintf("pachyderm %s not found", restore.Spec.Pachyderm))
+		}
+		return ctrl.Result{}, err
+	}
+
+	if holder := pd.Annotations[aimlv1beta1.RestoreAnnotation]; holder != "" && holder != restore.Name {
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhasePending,
+			reasonRestoreInProgress, fmt.Sprintf("waiting for restore %s of pachyderm %s to complete", holder, pd.Name))
+	}
+
+	if meta.IsStatusConditionTrue(pd.Status.Conditions, aimlv1beta1.ConditionUpgrading) {
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhasePending,
+			reasonUpgradeInProgress, fmt.Sprintf("waiting for the upgrade of pachyderm %s to complete", pd.Name))
+	}
+
+	// pachd migrates older metadata on start, but can not read
+	// the metadata written by a newer version of pachyderm
+	if targetVersion := catalog.Canonical(pd.Spec.Version); backup.Status.Version != "" && targetVersion != "" &&
+		semver.Compare(backup.Status.Version, targetVersion) > 0 {
+		message := fmt.Sprintf("backup %s was taken from pachyderm %s, which is newer than pachyderm %s %s",
+			backup.Name, backup.Status.Version, pd.Name, targetVersion)
+		r.Recorder.Event(restore, corev1.EventTypeWarning, "RestoreFailed", message)
+		return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseFailed, reasonVersionMismatch, message)
+	}
+
+	if pd.Status.CurrentVersion != "" && !restore.Spec.AllowOverwrite {
+		return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhasePending, reasonConfirmationRequired,
+			fmt.Sprintf("pachyderm %s is already running, set spec.allowOverwrite to replace its data", pd.Name))
+	}
+
+	// check the job can be generated before the workloads are paused
+	if _, err := r.restoreJob(ctx, restore, backup, pd); err != nil {
+		if err == generators.ErrUnsupportedBackupStorage || err == generators.ErrUnsupportedRestoreEtcd {
+			r.Recorder.Event(restore, corev1.EventTypeWarning, "RestoreFailed", err.Error())
+			return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseFailed,
+				reasonUnsupportedRestore, err.Error())
+		}
+		return ctrl.Result{}, err
+	}
+
+	if err := r.setPaused(ctx, pd, restore.Name); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	restore.Status.Version = backup.Status.Version
+	restore.Status.StartTime = &now
+	r.Recorder.Eventf(restore, corev1.EventTypeNormal, "RestoreStarted",
+		"scaling down pachyderm %s to restore backup %s", pd.Name, backup.Name)
+
+	return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseScalingDown,
+		reasonScalingDown, fmt.Sprintf("waiting for pachyderm %s to scale down", pd.Name))
+}
+
+// scaleDown waits for the pachd and dash workloads to be scaled
+// down before pausing etcd, so they do not lose their metadata
+// store while they shut down, and starts the restore job once
+// etcd is scaled down as well
+func (r *PachydermRestoreReconciler) scaleDown(ctx context.Context, restore *aimlv1beta1.PachydermRestore) (ctrl.Result, error) {
+	pd := &aimlv1beta1.Pachyderm{}
+	if err := r.Get(ctx, r.pachydermKey(restore), pd); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseFailed,
+				reasonPachydermNotFound, fmt.Sprintf("pachyderm %s was deleted", restore.Spec.Pachyderm))
+		}
+		return ctrl.Result{}, err
+	}
+
+	components, err := generators.Prepare(pd)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	workloads := []client.Object{components.PachdDeployment()}
+	if !pd.Spec.Dashd.Disable {
+		workloads = append(workloads, components.DashDeployment())
+	}
+	running, err := r.runningWorkload(ctx, workloads...)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if running != "" {
+		return r.waitForScaleDown(ctx, restore, running)
+	}
+
+	if !generators.EtcdPaused(pd) {
+		// the restore job mounts the volume claim of the first etcd
+		// member, which is only created once etcd is scheduled
+		claim := &corev1.PersistentVolumeClaim{}
+		claimKey := types.NamespacedName{
+			Name:      components.EtcdDataClaimName(),
+			Namespace: pd.Namespace,
+		}
+		if err := r.Get(ctx, claimKey, claim); err != nil {
+			if errors.IsNotFound(err) {
+				return ctrl.Result{RequeueAfter: 5 * time.Second}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseScalingDown,
+					reasonWaitingForVolume, fmt.Sprintf("waiting for etcd to create volume claim %s", claimKey.Name))
+			}
+			return ctrl.Result{}, err
+		}
+
+		if err := r.pauseEtcd(ctx, pd, restore.Name); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if running, err = r.runningWorkload(ctx, components.EtcdStatefulSet()); err != nil {
+		return ctrl.Result{}, err
+	}
+	if running != "" {
+		return r.waitForScaleDown(ctx, restore, running)
+	}
+
+	backup := &aimlv1beta1.PachydermBackup{}
+	backupKey := types.NamespacedName{
+		Name:      restore.Spec.Backup,
+		Namespace: restore.Namespace,
+	}
+	if err := r.Get(ctx, backupKey, backup); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseFailed,
+				reasonBackupNotFound, fmt.Sprintf("backup %s was deleted", backupKey.Name))
+		}
+		return ctrl.Result{}, err
+	}
+
+	job, err := r.restoreJob(ctx, restore, backup, pd)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := controllerutil.SetControllerReference(restore, job, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+
+	restore.Status.JobName = job.Name
+	r.Recorder.Eventf(restore, corev1.EventTypeNormal, "RestoreJobCreated",
+		"restoring backup %s into pachyderm %s with job %s", backup.Name, pd.Name, job.Name)
+
+	return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseRestoring,
+		reasonJobRunning, fmt.Sprintf("waiting for job %s to complete", job.Name),
+		newCondition(aimlv1beta1.ConditionRestoreScaledDown, true, reasonPaused,
+			fmt.Sprintf("pachyderm %s is scaled down", pd.Name)))
+}
+
+// restoreData waits for the restore job to complete
+// and scales the workloads back up once it succeeded
+func (r *PachydermRestoreReconciler) restoreData(ctx context.Context, restore *aimlv1beta1.PachydermRestore) (ctrl.Result, error) {
+	job := &batchv1.Job{}
+	jobKey := types.NamespacedName{
+		Name:      restore.Status.JobName,
+		Namespace: restore.Namespace,
+	}
+	if err := r.Get(ctx, jobKey, job); err != nil {
+		if errors.IsNotFound(err) {
+			// recreate the job if it was deleted before completing
+			return r.scaleDown(ctx, restore)
+		}
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case jobConditionTrue(job, batchv1.JobComplete):
+		pd := &aimlv1beta1.Pachyderm{}
+		if err := r.Get(ctx, r.pachydermKey(restore), pd); err != nil {
+			if errors.IsNotFound(err) {
+				return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseFailed,
+					reasonPachydermNotFound, fmt.Sprintf("pachyderm %s was deleted", restore.Spec.Pachyderm))
+			}
+			return ctrl.Result{}, err
+		}
+		if err := r.setPaused(ctx, pd, ""); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("restored backup %s with job %s", restore.Spec.Backup, job.Name)
+		r.Recorder.Event(restore, corev1.EventTypeNormal, "DataRestored", message)
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseScalingUp,
+			reasonWaitingForHealth, fmt.Sprintf("waiting for pachyderm %s to be healthy", pd.Name),
+			newCondition(aimlv1beta1.ConditionRestoreDataRestored, true, reasonSucceeded, message),
+			newCondition(aimlv1beta1.ConditionRestoreScaledDown, false, reasonScaledUp,
+				fmt.Sprintf("pachyderm %s is scaled back up", pd.Name)))
+	case jobConditionTrue(job, batchv1.JobFailed):
+		message := fmt.Sprintf("job %s failed", job.Name)
+		if condition := jobCondition(job, batchv1.JobFailed); condition != nil && condition.Message != "" {
+			message = fmt.Sprintf("%s: %s", message, condition.Message)
+		}
+		r.Recorder.Event(restore, corev1.EventTypeWarning, "RestoreFailed", message)
+		return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseFailed, reasonJobFailed,
+			fmt.Sprintf("%s; pachyderm %s stays scaled down until the restore is deleted", message, restore.Spec.Pachyderm),
+			newCondition(aimlv1beta1.ConditionRestoreDataRestored, false, reasonJobFailed, message))
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// verifyRestore waits for the components of
+// the Pachyderm resource to report they are ready
+func (r *PachydermRestoreReconciler) verifyRestore(ctx context.Context, restore *aimlv1beta1.PachydermRestore) (ctrl.Result, error) {
+	pd := &aimlv1beta1.Pachyderm{}
+	if err := r.Get(ctx, r.pachydermKey(restore), pd); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseFailed,
+				reasonPachydermNotFound, fmt.Sprintf("pachyderm %s was deleted", restore.Spec.Pachyderm))
+		}
+		return ctrl.Result{}, err
+	}
+
+	notReady := []string{}
+	for _, conditionType := range []string{
+		aimlv1beta1.ConditionEtcdReady,
+		aimlv1beta1.ConditionPostgresReady,
+		aimlv1beta1.ConditionPachdReady,
+		aimlv1beta1.ConditionDashReady,
+	} {
+		if !meta.IsStatusConditionTrue(pd.Status.Conditions, conditionType) {
+			notReady = append(notReady, conditionType)
+		}
+	}
+
+	if len(notReady) == 0 {
+		message := fmt.Sprintf("pachyderm %s is healthy after restoring backup %s", pd.Name, restore.Spec.Backup)
+		r.Recorder.Event(restore, corev1.EventTypeNormal, "RestoreCompleted", message)
+		return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseCompleted, reasonSucceeded, message)
+	}
+
+	message := fmt.Sprintf("waiting for pachyderm %s to be healthy: %s not ready", pd.Name, strings.Join(notReady, ", "))
+	restored := meta.FindStatusCondition(restore.Status.Conditions, aimlv1beta1.ConditionRestoreDataRestored)
+	if restored != nil && time.Since(restored.LastTransitionTime.Time) > restoreHealthTimeout {
+		message = fmt.Sprintf("pachyderm %s is not healthy %s after the restore: %s not ready",
+			pd.Name, restoreHealthTimeout, strings.Join(notReady, ", "))
+		r.Recorder.Event(restore, corev1.EventTypeWarning, "RestoreFailed", message)
+		return ctrl.Result{}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseFailed, reasonHealthCheckTimeout, message)
+	}
+
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseScalingUp,
+		reasonWaitingForHealth, message)
+}
+
+// finalizeRestore scales the workloads held by a deleted
+// restore back up and removes the restore finalizer
+func (r *PachydermRestoreReconciler) finalizeRestore(ctx context.Context, restore *aimlv1beta1.PachydermRestore) error {
+	if !controllerutil.ContainsFinalizer(restore, pachydermFinalizer) {
+		return nil
+	}
+
+	pd := &aimlv1beta1.Pachyderm{}
+	if err := r.Get(ctx, r.pachydermKey(restore), pd); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+	} else if pd.Annotations[aimlv1beta1.RestoreAnnotation] == restore.Name {
+		if err := r.setPaused(ctx, pd, ""); err != nil {
+			return err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(restore, pachydermFinalizer)
+	return r.Update(ctx, restore)
+}
+
+// restoreJob returns the job restoring the backup into the Pachyderm
+// resource. The artifacts are downloaded using the storage of the
+// Pachyderm resource the backup was taken from if it still exists.
+func (r *PachydermRestoreReconciler) restoreJob(ctx context.Context, restore *aimlv1beta1.PachydermRestore, backup *aimlv1beta1.PachydermBackup, pd *aimlv1beta1.Pachyderm) (*batchv1.Job, error) {
+	target, err := generators.Prepare(pd)
+	if err != nil {
+		return nil, err
+	}
+	source := target
+
+	if backup.Spec.Pachyderm != pd.Name {
+		sourcePd := &aimlv1beta1.Pachyderm{}
+		sourceKey := types.NamespacedName{
+			Name:      backup.Spec.Pachyderm,
+			Namespace: backup.Namespace,
+		}
+		if err := r.Get(ctx, sourceKey, sourcePd); err != nil {
+			if !errors.IsNotFound(err) {
+				return nil, err
+			}
+		} else if source, err = generators.Prepare(sourcePd); err != nil {
+			return nil, err
+		}
+	}
+
+	return target.RestoreJob(restore, backup, source)
+}
+
+// setPaused sets the restore annotation of the Pachyderm resource,
+// or removes it along with the etcd annotation if restore is empty
+func (r *PachydermRestoreReconciler) setPaused(ctx context.Context, pd *aimlv1beta1.Pachyderm, restore string) error {
+	if pd.Annotations[aimlv1beta1.RestoreAnnotation] == restore &&
+		(restore != "" || pd.Annotations[aimlv1beta1.RestoreEtcdAnnotation] == "") {
+		return nil
+	}
+
+	patch := client.MergeFrom(pd.DeepCopy())
+	if restore == "" {
+		delete(pd.Annotations, aimlv1beta1.RestoreAnnotation)
+		delete(pd.Annotations, aimlv1beta1.RestoreEtcdAnnotation)
+	} else {
+		pd.Annotations = mergeStringMaps(pd.Annotations, map[string]string{
+			aimlv1beta1.RestoreAnnotation: restore,
+		})
+	}
+
+	return r.Patch(ctx, pd, patch)
+}
+
+// pauseEtcd sets the etcd annotation of the Pachyderm
+// resource, scaling etcd down along with pachd and dash
+func (r *PachydermRestoreReconciler) pauseEtcd(ctx context.Context, pd *aimlv1beta1.Pachyderm, restore string) error {
+	if pd.Annotations[aimlv1beta1.RestoreEtcdAnnotation] == restore {
+		return nil
+	}
+
+	patch := client.MergeFrom(pd.DeepCopy())
+	pd.Annotations = mergeStringMaps(pd.Annotations, map[string]string{
+		aimlv1beta1.RestoreEtcdAnnotation: restore,
+	})
+
+	return r.Patch(ctx, pd, patch)
+}
+
+// runningWorkload returns the name of the
+// first workload that is not scaled down yet
+func (r *PachydermRestoreReconciler) runningWorkload(ctx context.Context, workloads ...client.Object) (string, error) {
+	for _, workload := range workloads {
+		scaledDown, err := r.isScaledDown(ctx, workload)
+		if err != nil {
+			return "", err
+		}
+		if !scaledDown {
+			return workload.GetName(), nil
+		}
+	}
+	return "", nil
+}
+
+// waitForScaleDown reports the restore is waiting
+// for the running workload to be scaled down
+func (r *PachydermRestoreReconciler) waitForScaleDown(ctx context.Context, restore *aimlv1beta1.PachydermRestore, running string) (ctrl.Result, error) {
+	return ctrl.Result{RequeueAfter: 5 * time.Second}, r.setRestoreStatus(ctx, restore, aimlv1beta1.RestorePhaseScalingDown,
+		reasonScalingDown, fmt.Sprintf("waiting for %s to scale down", running))
+}
+
+// isScaledDown returns true once a workload has no pods left
+func (r *PachydermRestoreReconciler) isScaledDown(ctx context.Context, desired client.Object) (bool, error) {
+	live := desired.DeepCopyObject().(client.Object)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	switch obj := live.(type) {
+	case *appsv1.Deployment:
+		return obj.Spec.Replicas != nil && *obj.Spec.Replicas == 0 && obj.Status.Replicas == 0, nil
+	case *appsv1.StatefulSet:
+		return statefulSetReplicas(obj) == 0 && obj.Status.Replicas == 0, nil
+	}
+
+	return true, nil
+}
+
+// pachydermKey returns the key of the Pachyderm
+// resource the backup is restored into
+func (r *PachydermRestoreReconciler) pachydermKey(restore *aimlv1beta1.PachydermRestore) types.NamespacedName {
+	return types.NamespacedName{
+		Name:      restore.Spec.Pachyderm,
+		Namespace: restore.Namespace,
+	}
+}
+
+// setRestoreStatus patches the phase and completion condition of
+// the restore along with its status fields and the given conditions
+func (r *PachydermRestoreReconciler) setRestoreStatus(ctx context.Context, restore *aimlv1beta1.PachydermRestore, phase aimlv1beta1.RestorePhase, reason, message string, conditions ...metav1.Condition) error {
+	current := &aimlv1beta1.PachydermRestore{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(restore), current); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	status := restore.Status.DeepCopy()
+	status.Phase = phase
+	if (phase == aimlv1beta1.RestorePhaseCompleted || phase == aimlv1beta1.RestorePhaseFailed) &&
+		status.CompletionTime == nil {
+		now := metav1.Now()
+		status.CompletionTime = &now
+	}
+	conditions = append(conditions, newCondition(aimlv1beta1.ConditionRestoreComplete,
+		phase == aimlv1beta1.RestorePhaseCompleted, reason, message))
+	for _, condition := range conditions {
+		condition.ObservedGeneration = current.Generation
+		meta.SetStatusCondition(&status.Conditions, condition)
+	}
+	current.Status = *status
+
+	return r.Status().Patch(ctx, current, patch)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PachydermRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&aimlv1beta1.PachydermRestore{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("PachydermRestore", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		pd         *aimlv1beta1.Pachyderm
+		backup     *aimlv1beta1.PachydermBackup
+		restore    *aimlv1beta1.PachydermRestore
+		components *generators.PachydermComponents
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = newTestScheme()
+
+		pd = newTestPachyderm()
+		pd.Annotations = map[string]string{
+			aimlv1beta1.NamingAnnotation:  aimlv1beta1.NamingInstance,
+			aimlv1beta1.RestoreAnnotation: "restore",
+		}
+		backup = &aimlv1beta1.PachydermBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: pd.Namespace},
+			Spec: aimlv1beta1.PachydermBackupSpec{
+				Pachyderm: pd.Name,
+				Storage: &aimlv1beta1.ObjectStorageOptions{
+					Backend: "minio",
+					Minio: &aimlv1beta1.MinioStorageOptions{
+						Bucket:   "backups",
+						Endpoint: "minio.default.svc:9000",
+						ID:       "minio",
+						Secret:   "minio123",
+					},
+				},
+			},
+			Status: aimlv1beta1.PachydermBackupStatus{Phase: aimlv1beta1.BackupPhaseCompleted},
+		}
+		restore = &aimlv1beta1.PachydermRestore{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "restore",
+				Namespace:  pd.Namespace,
+				Finalizers: []string{pachydermFinalizer},
+			},
+			Spec: aimlv1beta1.PachydermRestoreSpec{
+				Backup:    backup.Name,
+				Pachyderm: pd.Name,
+			},
+			Status: aimlv1beta1.PachydermRestoreStatus{Phase: aimlv1beta1.RestorePhaseScalingDown},
+		}
+
+		var err error
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	reconciler := func(objs ...runtime.Object) *PachydermRestoreReconciler {
+		return &PachydermRestoreReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, append(objs, pd, backup, restore)...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	}
+
+	// reconcile runs the restore reconciler and
+	// returns the restore completion condition
+	reconcile := func(r *PachydermRestoreReconciler) *metav1.Condition {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(restore)})
+		Expect(err).NotTo(HaveOccurred())
+
+		// read into new objects, as the client does not
+		// clear the annotations removed by the reconciler
+		restoreKey, pdKey := client.ObjectKeyFromObject(restore), client.ObjectKeyFromObject(pd)
+		restore, pd = &aimlv1beta1.PachydermRestore{}, &aimlv1beta1.Pachyderm{}
+		Expect(r.Get(ctx, restoreKey, restore)).To(Succeed())
+		Expect(r.Get(ctx, pdKey, pd)).To(Succeed())
+		return meta.FindStatusCondition(restore.Status.Conditions, aimlv1beta1.ConditionRestoreComplete)
+	}
+
+	// liveEtcd returns the etcd statefulset running a single member
+	liveEtcd := func() *appsv1.StatefulSet {
+		sts := components.EtcdStatefulSet().DeepCopy()
+		replicas := int32(1)
+		sts.Spec.Replicas = &replicas
+		sts.Status.Replicas = 1
+		return sts
+	}
+
+	etcdClaim := func() *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: components.EtcdDataClaimName(), Namespace: pd.Namespace},
+		}
+	}
+
+	// completeJob sets the given condition on the restore job
+	completeJob := func(r *PachydermRestoreReconciler, conditionType batchv1.JobConditionType, message string) {
+		job := &batchv1.Job{}
+		Expect(r.Get(ctx, client.ObjectKey{Name: restore.Status.JobName, Namespace: restore.Namespace}, job)).To(Succeed())
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+			Type:    conditionType,
+			Status:  corev1.ConditionTrue,
+			Message: message,
+		})
+		Expect(r.Status().Update(ctx, job)).To(Succeed())
+	}
+
+	// setReady sets the readiness conditions of the pachyderm components
+	setReady := func(r *PachydermRestoreReconciler, conditionTypes ...string) {
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pd), pd)).To(Succeed())
+		for _, conditionType := range conditionTypes {
+			meta.SetStatusCondition(&pd.Status.Conditions, metav1.Condition{
+				Type:   conditionType,
+				Status: metav1.ConditionTrue,
+				Reason: "Ready",
+			})
+		}
+		Expect(r.Status().Update(ctx, pd)).To(Succeed())
+	}
+
+	// pausedEtcd returns the etcd statefulset scaled down for the restore
+	pausedEtcd := func() *appsv1.StatefulSet {
+		pd.Annotations[aimlv1beta1.RestoreEtcdAnnotation] = restore.Name
+		etcd := liveEtcd()
+		replicas := int32(0)
+		etcd.Spec.Replicas = &replicas
+		etcd.Status.Replicas = 0
+		return etcd
+	}
+
+	It("keeps etcd running until pachd is scaled down", func() {
+		pachd := components.PachdDeployment().DeepCopy()
+		replicas := int32(1)
+		pachd.Spec.Replicas = &replicas
+		pachd.Status.Replicas = 1
+
+		r := reconciler(pachd, liveEtcd(), etcdClaim())
+		condition := reconcile(r)
+		Expect(condition.Reason).To(Equal(reasonScalingDown))
+		Expect(condition.Message).To(Equal("waiting for pachyderm-pachd to scale down"))
+		Expect(pd.Annotations).NotTo(HaveKey(aimlv1beta1.RestoreEtcdAnnotation))
+	})
+
+	It("waits for etcd to create its volume claim before pausing etcd", func() {
+		r := reconciler(liveEtcd())
+		condition := reconcile(r)
+		Expect(condition.Reason).To(Equal(reasonWaitingForVolume))
+		Expect(condition.Message).To(ContainSubstring(components.EtcdDataClaimName()))
+		Expect(pd.Annotations).NotTo(HaveKey(aimlv1beta1.RestoreEtcdAnnotation))
+
+		Expect(r.Create(ctx, etcdClaim())).To(Succeed())
+		condition = reconcile(r)
+		Expect(condition.Reason).To(Equal(reasonScalingDown))
+		Expect(condition.Message).To(Equal("waiting for pachyderm-etcd to scale down"))
+		Expect(pd.Annotations).To(HaveKeyWithValue(aimlv1beta1.RestoreEtcdAnnotation, restore.Name))
+	})
+
+	It("starts the restore job once etcd is scaled down", func() {
+		r := reconciler(pausedEtcd(), etcdClaim())
+		reconcile(r)
+		Expect(restore.Status.Phase).To(Equal(aimlv1beta1.RestorePhaseRestoring))
+		Expect(meta.IsStatusConditionTrue(restore.Status.Conditions, aimlv1beta1.ConditionRestoreScaledDown)).To(BeTrue())
+
+		job := &batchv1.Job{}
+		Expect(r.Get(ctx, client.ObjectKey{Name: restore.Status.JobName, Namespace: restore.Namespace}, job)).To(Succeed())
+	})
+
+	It("scales back up once the job completed and completes once pachyderm is healthy", func() {
+		r := reconciler(pausedEtcd(), etcdClaim())
+		reconcile(r)
+		Expect(restore.Status.Phase).To(Equal(aimlv1beta1.RestorePhaseRestoring))
+
+		// the job is still running
+		reconcile(r)
+		Expect(restore.Status.Phase).To(Equal(aimlv1beta1.RestorePhaseRestoring))
+		Expect(pd.Annotations).To(HaveKeyWithValue(aimlv1beta1.RestoreAnnotation, restore.Name))
+
+		completeJob(r, batchv1.JobComplete, "")
+		condition := reconcile(r)
+		Expect(restore.Status.Phase).To(Equal(aimlv1beta1.RestorePhaseScalingUp))
+		Expect(condition.Reason).To(Equal(reasonWaitingForHealth))
+		Expect(meta.IsStatusConditionTrue(restore.Status.Conditions, aimlv1beta1.ConditionRestoreDataRestored)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(restore.Status.Conditions, aimlv1beta1.ConditionRestoreScaledDown)).To(BeTrue())
+		Expect(pd.Annotations).NotTo(HaveKey(aimlv1beta1.RestoreAnnotation))
+		Expect(pd.Annotations).NotTo(HaveKey(aimlv1beta1.RestoreEtcdAnnotation))
+
+		setReady(r, aimlv1beta1.ConditionEtcdReady, aimlv1beta1.ConditionPostgresReady, aimlv1beta1.ConditionPachdReady)
+		condition = reconcile(r)
+		Expect(restore.Status.Phase).To(Equal(aimlv1beta1.RestorePhaseScalingUp))
+		Expect(condition.Message).To(HaveSuffix(aimlv1beta1.ConditionDashReady + " not ready"))
+
+		setReady(r, aimlv1beta1.ConditionDashReady)
+		condition = reconcile(r)
+		Expect(restore.Status.Phase).To(Equal(aimlv1beta1.RestorePhaseCompleted))
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(reasonSucceeded))
+	})
+
+	It("keeps pachyderm scaled down when the job failed", func() {
+		r := reconciler(pausedEtcd(), etcdClaim())
+		reconcile(r)
+
+		completeJob(r, batchv1.JobFailed, "BackoffLimitExceeded")
+		condition := reconcile(r)
+		Expect(restore.Status.Phase).To(Equal(aimlv1beta1.RestorePhaseFailed))
+		Expect(condition.Reason).To(Equal(reasonJobFailed))
+		Expect(condition.Message).To(HavePrefix("job " + restore.Status.JobName + " failed: BackoffLimitExceeded"))
+		Expect(meta.IsStatusConditionFalse(restore.Status.Conditions, aimlv1beta1.ConditionRestoreDataRestored)).To(BeTrue())
+		Expect(pd.Annotations).To(HaveKeyWithValue(aimlv1beta1.RestoreAnnotation, restore.Name))
+		Expect(pd.Annotations).To(HaveKeyWithValue(aimlv1beta1.RestoreEtcdAnnotation, restore.Name))
+	})
+
+	It("recreates the job when it is deleted before completing", func() {
+		r := reconciler(pausedEtcd(), etcdClaim())
+		reconcile(r)
+
+		job := &batchv1.Job{}
+		Expect(r.Get(ctx, client.ObjectKey{Name: restore.Status.JobName, Namespace: restore.Namespace}, job)).To(Succeed())
+		Expect(r.Delete(ctx, job)).To(Succeed())
+
+		reconcile(r)
+		Expect(restore.Status.Phase).To(Equal(aimlv1beta1.RestorePhaseRestoring))
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(job), &batchv1.Job{})).To(Succeed())
+	})
+
+	It("fails when pachyderm is not healthy in time after the restore", func() {
+		restore.Status.Phase = aimlv1beta1.RestorePhaseScalingUp
+		restore.Status.Conditions = []metav1.Condition{{
+			Type:               aimlv1beta1.ConditionRestoreDataRestored,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonSucceeded,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-restoreHealthTimeout - time.Minute)),
+		}}
+
+		r := reconciler()
+		condition := reconcile(r)
+		Expect(restore.Status.Phase).To(Equal(aimlv1beta1.RestorePhaseFailed))
+		Expect(condition.Reason).To(Equal(reasonHealthCheckTimeout))
+	})
+
+	It("resumes etcd along with pachd and dash", func() {
+		pd.Annotations[aimlv1beta1.RestoreEtcdAnnotation] = restore.Name
+		r := reconciler()
+		Expect(r.setPaused(ctx, pd, "")).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pd), pd)).To(Succeed())
+		Expect(pd.Annotations).NotTo(HaveKey(aimlv1beta1.RestoreAnnotation))
+		Expect(pd.Annotations).NotTo(HaveKey(aimlv1beta1.RestoreEtcdAnnotation))
+	})
+})
@@ -0,0 +1,87 @@
+// Package probe checks whether Pachyderm
+// components are ready to serve requests
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// DefaultTimeout is the time allowed for a probe to complete
+const DefaultTimeout = 5 * time.Second
+
+// Target describes the component to be probed
+type Target struct {
+	// Address of the component in host:port format
+	Address string
+	// Name of the gRPC service to check.
+	// When empty, the overall health of the server is checked
+	Service string
+	// TLS configuration used to connect to the component.
+	// The connection is not encrypted when nil
+	TLS *tls.Config
+}
+
+// Prober checks whether a component is ready to serve requests
+type Prober interface {
+	// Probe returns nil if the target is serving
+	Probe(ctx context.Context, target Target) error
+}
+
+// GRPCProber uses the gRPC health checking protocol
+// to check whether a component is serving
+type GRPCProber struct {
+	// Timeout is the time allowed for
+	// connecting to and checking the target
+	Timeout time.Duration
+}
+
+var _ Prober = &GRPCProber{}
+
+// NewGRPCProber returns a gRPC prober with the given timeout
+func NewGRPCProber(timeout time.Duration) *GRPCProber {
+	return &GRPCProber{
+		Timeout: timeout,
+	}
+}
+
+// Probe implements Prober
+func (p *GRPCProber) Probe(ctx context.Context, target Target) error {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	transport := grpc.WithInsecure()
+	if target.TLS != nil {
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(target.TLS))
+	}
+
+	conn, err := grpc.DialContext(ctx, target.Address, transport, grpc.WithBlock())
+	if err != nil {
+		return fmt.Errorf("unable to connect to %s: %w", target.Address, err)
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+		Service: target.Service,
+	})
+	if err != nil {
+		return fmt.Errorf("health check failed for %s: %w", target.Address, err)
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("%s is %s", target.Address, resp.Status.String())
+	}
+
+	return nil
+}
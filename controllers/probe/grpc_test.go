@@ -0,0 +1,65 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var _ = Describe("GRPCProber", func() {
+	var (
+		server       *grpc.Server
+		healthServer *health.Server
+		address      string
+		prober       Prober
+	)
+
+	BeforeEach(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		address = listener.Addr().String()
+
+		server = grpc.NewServer()
+		healthServer = health.NewServer()
+		healthpb.RegisterHealthServer(server, healthServer)
+		go server.Serve(listener)
+
+		prober = NewGRPCProber(time.Second)
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	It("succeeds when the server is serving", func() {
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		Expect(prober.Probe(context.Background(), Target{Address: address})).To(Succeed())
+	})
+
+	It("fails when the server is not serving", func() {
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		Expect(prober.Probe(context.Background(), Target{Address: address})).NotTo(Succeed())
+	})
+
+	It("fails when the service is unknown", func() {
+		target := Target{
+			Address: address,
+			Service: "pachd",
+		}
+		Expect(prober.Probe(context.Background(), target)).NotTo(Succeed())
+	})
+
+	It("times out when the server is unreachable", func() {
+		server.Stop()
+
+		start := time.Now()
+		Expect(prober.Probe(context.Background(), Target{Address: address})).NotTo(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+})
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// isDeploymentReady returns true if the deployment has finished rolling out.
+// Otherwise, a message describing the rollout progress is returned.
+func (r *PachydermReconciler) isDeploymentReady(ctx context.Context, desired *appsv1.Deployment) (bool, string) {
+	deploy := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(desired), deploy); err != nil {
+		return false, fmt.Sprintf("unable to get deployment %s: %s", desired.Name, err.Error())
+	}
+
+	var replicas int32 = 1
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+
+	if deploy.Status.ObservedGeneration < deploy.Generation {
+		return false, fmt.Sprintf("waiting for deployment %s spec update to be observed", deploy.Name)
+	}
+
+	if deploy.Status.UpdatedReplicas < replicas {
+		return false, fmt.Sprintf("waiting for deployment %s rollout: %d of %d updated replicas",
+			deploy.Name, deploy.Status.UpdatedReplicas, replicas)
+	}
+
+	if deploy.Status.Replicas > deploy.Status.UpdatedReplicas {
+		return false, fmt.Sprintf("waiting for deployment %s rollout: %d old replicas pending termination",
+			deploy.Name, deploy.Status.Replicas-deploy.Status.UpdatedReplicas)
+	}
+
+	if deploy.Status.AvailableReplicas < replicas {
+		return false, fmt.Sprintf("waiting for deployment %s rollout: %d of %d replicas available",
+			deploy.Name, deploy.Status.AvailableReplicas, replicas)
+	}
+
+	return true, ""
+}
+
+// isStatefulSetReady returns true if the statefulset has finished rolling out.
+// Otherwise, a message describing the rollout progress is returned.
+func (r *PachydermReconciler) isStatefulSetReady(ctx context.Context, desired *appsv1.StatefulSet) (bool, string) {
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(desired), sts); err != nil {
+		return false, fmt.Sprintf("unable to get statefulset %s: %s", desired.Name, err.Error())
+	}
+
+	replicas := statefulSetReplicas(sts)
+
+	if sts.Status.ObservedGeneration < sts.Generation {
+		return false, fmt.Sprintf("waiting for statefulset %s spec update to be observed", sts.Name)
+	}
+
+	if sts.Status.UpdatedReplicas < replicas {
+		return false, fmt.Sprintf("waiting for statefulset %s rollout: %d of %d updated replicas",
+			sts.Name, sts.Status.UpdatedReplicas, replicas)
+	}
+
+	if sts.Status.ReadyReplicas < replicas {
+		return false, fmt.Sprintf("waiting for statefulset %s rollout: %d of %d replicas ready",
+			sts.Name, sts.Status.ReadyReplicas, replicas)
+	}
+
+	return true, ""
+}
+
+// isServiceReady returns true if the
+// service has at least one ready endpoint
+func (r *PachydermReconciler) isServiceReady(ctx context.Context, service types.NamespacedName) bool {
+	ep := &corev1.Endpoints{}
+	if err := r.Get(ctx, service, ep); err != nil {
+		return false
+	}
+
+	addresses := []corev1.EndpointAddress{}
+
+	for _, subset := range ep.Subsets {
+		addresses = append(addresses, subset.Addresses...)
+	}
+
+	return len(addresses) > 0
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("readiness", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	reconciler := func(objs ...runtime.Object) *PachydermReconciler {
+		scheme := newTestScheme()
+		return &PachydermReconciler{
+			Client: fake.NewFakeClientWithScheme(scheme, objs...),
+			Log:    ctrl.Log,
+			Scheme: scheme,
+		}
+	}
+
+	table.DescribeTable("isDeploymentReady",
+		func(status appsv1.DeploymentStatus, ready bool, message string) {
+			replicas := int32(2)
+			deploy := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "pachd", Namespace: "default", Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+				Status:     status,
+			}
+
+			isReady, reported := reconciler(deploy).isDeploymentReady(ctx, deploy)
+			Expect(isReady).To(Equal(ready))
+			Expect(reported).To(Equal(message))
+		},
+		table.Entry("rolled out",
+			appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+			true, ""),
+		table.Entry("spec update not observed",
+			appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+			false, "waiting for deployment pachd spec update to be observed"),
+		table.Entry("replicas not updated",
+			appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 2},
+			false, "waiting for deployment pachd rollout: 1 of 2 updated replicas"),
+		table.Entry("old replicas terminating",
+			appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2},
+			false, "waiting for deployment pachd rollout: 1 old replicas pending termination"),
+		table.Entry("replicas not available",
+			appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1},
+			false, "waiting for deployment pachd rollout: 1 of 2 replicas available"),
+	)
+
+	table.DescribeTable("isStatefulSetReady",
+		func(status appsv1.StatefulSetStatus, ready bool, message string) {
+			replicas := int32(3)
+			sts := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default", Generation: 2},
+				Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+				Status:     status,
+			}
+
+			isReady, reported := reconciler(sts).isStatefulSetReady(ctx, sts)
+			Expect(isReady).To(Equal(ready))
+			Expect(reported).To(Equal(message))
+		},
+		table.Entry("rolled out",
+			appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdatedReplicas: 3, ReadyReplicas: 3},
+			true, ""),
+		table.Entry("spec update not observed",
+			appsv1.StatefulSetStatus{ObservedGeneration: 1, UpdatedReplicas: 3, ReadyReplicas: 3},
+			false, "waiting for statefulset etcd spec update to be observed"),
+		table.Entry("replicas not updated",
+			appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdatedReplicas: 2, ReadyReplicas: 3},
+			false, "waiting for statefulset etcd rollout: 2 of 3 updated replicas"),
+		table.Entry("replicas not ready",
+			appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdatedReplicas: 3, ReadyReplicas: 1},
+			false, "waiting for statefulset etcd rollout: 1 of 3 replicas ready"),
+	)
+
+	It("reports workloads that do not exist as not ready", func() {
+		deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "pachd", Namespace: "default"}}
+		ready, message := reconciler().isDeploymentReady(ctx, deploy)
+		Expect(ready).To(BeFalse())
+		Expect(message).To(HavePrefix("unable to get deployment pachd: "))
+	})
+
+	It("requires a ready endpoint address", func() {
+		key := types.NamespacedName{Name: "pachd", Namespace: "default"}
+		notReady := &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Subsets: []corev1.EndpointSubset{
+				{NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}},
+			},
+		}
+		Expect(reconciler().isServiceReady(ctx, key)).To(BeFalse())
+		Expect(reconciler(notReady).isServiceReady(ctx, key)).To(BeFalse())
+
+		ready := notReady.DeepCopy()
+		ready.Subsets[0].Addresses = ready.Subsets[0].NotReadyAddresses
+		Expect(reconciler(ready).isServiceReady(ctx, key)).To(BeTrue())
+	})
+
+	It("checks the services generated for the pachyderm resource", func() {
+		pd := newTestPachyderm()
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, svc := range []*corev1.Service{
+			components.EtcdService(),
+			components.PostgresService(),
+			components.PachdService(),
+			components.PachdPeerService(),
+			components.DashService(),
+		} {
+			Expect(svc).NotTo(BeNil())
+			Expect(svc.Name).To(HavePrefix(pd.Name + "-"))
+			Expect(svc.Namespace).To(Equal(pd.Namespace))
+		}
+
+		port, ok := generators.ServicePort(components.PachdService(), "api-grpc-port")
+		Expect(ok).To(BeTrue())
+		Expect(port).To(Equal(int32(30650)))
+		_, ok = generators.ServicePort(components.PachdService(), "unknown")
+		Expect(ok).To(BeFalse())
+	})
+})
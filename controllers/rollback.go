@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+// lastKnownGoodVersionAnnotation records the version of
+// Pachyderm the last known good workloads were running
+const lastKnownGoodVersionAnnotation = "aiml.pachyderm.com/version"
+
+// lastKnownGoodKey returns the key of the configmap keeping the pod
+// templates of the workloads running before an upgrade was started
+func lastKnownGoodKey(pd *aimlv1beta1.Pachyderm) types.NamespacedName {
+	return types.NamespacedName{
+		Name:      fmt.Sprintf("%s-last-known-good", pd.Name),
+		Namespace: pd.Namespace,
+	}
+}
+
+// lastKnownGoodWorkloads returns the workloads
+// restored when an upgrade is rolled back, keyed
+// by the name their pod template is stored under
+func lastKnownGoodWorkloads(components *generators.PachydermComponents) map[string]client.Object {
+	workloads := map[string]client.Object{
+		"etcd":     components.EtcdStatefulSet(),
+		"postgres": components.PostgreStatefulset(),
+		"pachd":    components.PachdDeployment(),
+	}
+	if !components.Parent().Spec.Dashd.Disable {
+		workloads["dash"] = components.DashDeployment()
+	}
+
+	return workloads
+}
+
+// saveLastKnownGood stores the pod templates of the running workloads
+// before they are upgraded from the current version. The templates
+// are kept until the upgrade is completed or cancelled.
+func (r *PachydermReconciler) saveLastKnownGood(ctx context.Context, components *generators.PachydermComponents, version string) error {
+	pd := components.Parent()
+
+	current := &corev1.ConfigMap{}
+	if err := r.Get(ctx, lastKnownGoodKey(pd), current); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		current = nil
+	}
+	if current != nil && current.Annotations[lastKnownGoodVersionAnnotation] == version {
+		return nil
+	}
+
+	data := map[string]string{}
+	for name, workload := range lastKnownGoodWorkloads(components) {
+		live := workload.DeepCopyObject().(client.Object)
+		if err := r.Get(ctx, client.ObjectKeyFromObject(workload), live); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		var template corev1.PodTemplateSpec
+		switch obj := live.(type) {
+		case *appsv1.Deployment:
+			template = obj.Spec.Template
+		case *appsv1.StatefulSet:
+			template = obj.Spec.Template
+		}
+
+		encoded, err := json.Marshal(template)
+		if err != nil {
+			return err
+		}
+		data[name] = string(encoded)
+	}
+
+	if current != nil {
+		patch := client.MergeFrom(current.DeepCopy())
+		current.Annotations = mergeStringMaps(current.Annotations, map[string]string{
+			lastKnownGoodVersionAnnotation: version,
+		})
+		current.Data = data
+		return r.Patch(ctx, current, patch)
+	}
+
+	key := lastKnownGoodKey(pd)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels: map[string]string{
+				generators.InstanceLabel: pd.Name,
+			},
+			Annotations: map[string]string{
+				lastKnownGoodVersionAnnotation: version,
+			},
+		},
+		Data: data,
+	}
+	if err := controllerutil.SetControllerReference(pd, cm, r.Scheme); err != nil {
+		return err
+	}
+
+	return r.Create(ctx, cm)
+}
+
+// deleteLastKnownGood deletes the pod templates
+// kept while the Pachyderm resource was upgraded
+func (r *PachydermReconciler) deleteLastKnownGood(ctx context.Context, pd *aimlv1beta1.Pachyderm) error {
+	key := lastKnownGoodKey(pd)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+		},
+	}
+
+	if err := r.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// rollback restores the pod templates the workloads were running
+// before a failed upgrade. The workloads are restored in the reverse
+// order they are upgraded in.
+func (r *PachydermReconciler) rollback(ctx context.Context, components *generators.PachydermComponents) error {
+	pd := components.Parent()
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, lastKnownGoodKey(pd), cm); err != nil {
+		if errors.IsNotFound(err) {
+			r.Recorder.Eventf(pd, corev1.EventTypeWarning, "RollbackFailed",
+				"configmap %s holding the last known good workloads was not found", lastKnownGoodKey(pd).Name)
+			return nil
+		}
+		return stepFailed("RollbackFailed", err)
+	}
+
+	templates := map[string]corev1.PodTemplateSpec{}
+	for name, encoded := range cm.Data {
+		var template corev1.PodTemplateSpec
+		if err := json.Unmarshal([]byte(encoded), &template); err != nil {
+			return stepFailed("RollbackFailed", fmt.Errorf("unable to decode the %s pod template: %w", name, err))
+		}
+		templates[name] = template
+	}
+
+	if template, ok := templates["dash"]; ok && !pd.Spec.Dashd.Disable {
+		if err := r.restoreWorkload(ctx, components.DashDeployment(), template); err != nil {
+			return stepFailed("RollbackFailed", err)
+		}
+	}
+
+	if template, ok := templates["pachd"]; ok {
+		if err := r.restoreWorkload(ctx, components.PachdDeployment(), template); err != nil {
+			return stepFailed("RollbackFailed", err)
+		}
+	}
+
+	if template, ok := templates["postgres"]; ok {
+		if err := r.restoreWorkload(ctx, components.PostgreStatefulset(), template); err != nil {
+			return stepFailed("RollbackFailed", err)
+		}
+	}
+
+	if template, ok := templates["etcd"]; ok {
+		etcd := components.EtcdStatefulSet()
+		etcd.Spec.Template = template
+		if err := r.rolloutEtcd(ctx, pd, etcd, templateRestored); err != nil {
+			return stepFailed("RollbackFailed", err)
+		}
+	}
+
+	return nil
+}
+
+// restoreWorkload replaces the pod template of a live deployment or
+// statefulset with the template saved before the upgrade
+func (r *PachydermReconciler) restoreWorkload(ctx context.Context, workload client.Object, template corev1.PodTemplateSpec) error {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(workload), workload); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+	changed := false
+	switch obj := workload.(type) {
+	case *appsv1.Deployment:
+		changed = templateRestored(&obj.ObjectMeta, &obj.Spec.Template, &template)
+	case *appsv1.StatefulSet:
+		changed = templateRestored(&obj.ObjectMeta, &obj.Spec.Template, &template)
+	}
+
+	if !changed {
+		return nil
+	}
+	return r.Patch(ctx, workload, patch)
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("rollback", func() {
+	var (
+		ctx        context.Context
+		pd         *aimlv1beta1.Pachyderm
+		components *generators.PachydermComponents
+		r          *PachydermReconciler
+	)
+
+	// addedEnv is set by the version the upgrade failed to roll out
+	addedEnv := corev1.EnvVar{Name: "NEW_FEATURE", Value: "true"}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		pd = newTestPachyderm()
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+
+		var err error
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		pachd := components.PachdDeployment()
+		postgres := components.PostgreStatefulset()
+		etcd := components.EtcdStatefulSet()
+
+		saved := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        lastKnownGoodKey(pd).Name,
+				Namespace:   pd.Namespace,
+				Annotations: map[string]string{lastKnownGoodVersionAnnotation: "v2.0.0"},
+			},
+			Data: map[string]string{},
+		}
+		for name, template := range map[string]corev1.PodTemplateSpec{
+			"pachd":    pachd.Spec.Template,
+			"postgres": postgres.Spec.Template,
+			"etcd":     etcd.Spec.Template,
+		} {
+			encoded, err := json.Marshal(template)
+			Expect(err).NotTo(HaveOccurred())
+			saved.Data[name] = string(encoded)
+		}
+
+		// the live workloads gained an environment variable
+		for _, template := range []*corev1.PodTemplateSpec{&pachd.Spec.Template, &postgres.Spec.Template, &etcd.Spec.Template} {
+			container := &template.Spec.Containers[0]
+			container.Env = append(container.Env, addedEnv)
+		}
+
+		scheme := newTestScheme()
+		r = &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, pd, saved, pachd, postgres, etcd),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	It("removes the fields added by the failed version", func() {
+		Expect(r.rollback(ctx, components)).To(Succeed())
+
+		pachd := components.PachdDeployment()
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pachd), pachd)).To(Succeed())
+		Expect(pachd.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(addedEnv))
+
+		for _, sts := range []*appsv1.StatefulSet{components.PostgreStatefulset(), components.EtcdStatefulSet()} {
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(sts), sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(addedEnv), sts.Name)
+		}
+	})
+
+	It("leaves restored workloads unchanged", func() {
+		Expect(r.rollback(ctx, components)).To(Succeed())
+		pachd := components.PachdDeployment()
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pachd), pachd)).To(Succeed())
+		version := pachd.ResourceVersion
+
+		Expect(r.rollback(ctx, components)).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pachd), pachd)).To(Succeed())
+		Expect(pachd.ResourceVersion).To(Equal(version))
+	})
+})
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+// reconcileRoutes creates or updates the OpenShift routes exposing
+// pachyderm components, and deletes routes that are no
+// longer required by the pachyderm resource
+func (r *PachydermReconciler) reconcileRoutes(ctx context.Context, components *generators.PachydermComponents) error {
+	pd := components.Parent()
+	desired := map[string]bool{}
+
+	for _, route := range components.Routes() {
+		desired[route.GetName()] = true
+
+		if err := controllerutil.SetControllerReference(pd, route, r.Scheme); err != nil {
+			return err
+		}
+
+		if err := r.Create(ctx, route); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return err
+			}
+
+			current := &unstructured.Unstructured{}
+			current.SetGroupVersionKind(generators.RouteGVK)
+			if err := r.Get(ctx, client.ObjectKeyFromObject(route), current); err != nil {
+				return err
+			}
+
+			patch := client.MergeFrom(current.DeepCopy())
+			if unstructuredChanged(current, route) {
+				if err := r.Patch(ctx, current, patch); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	routes := &unstructured.UnstructuredList{}
+	routes.SetGroupVersionKind(generators.RouteGVK.GroupVersion().WithKind("RouteList"))
+	if err := r.List(ctx, routes,
+		client.InNamespace(pd.Namespace),
+		client.MatchingLabels{generators.InstanceLabel: pd.Name}); err != nil {
+		return err
+	}
+
+	for i := range routes.Items {
+		route := &routes.Items[i]
+		if desired[route.GetName()] || !metav1.IsControlledBy(route, pd) {
+			continue
+		}
+
+		if err := r.Delete(ctx, route); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,458 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+	"github.com/opdev/pachyderm-operator/controllers/probe"
+)
+
+// Reasons reported in the Pachyderm status conditions
+const (
+	reasonReady                    string = "Ready"
+	reasonDisabled                 string = "Disabled"
+	reasonEndpointsNotReady        string = "EndpointsNotReady"
+	reasonRolloutInProgress        string = "RolloutInProgress"
+	reasonHealthCheckFailed        string = "HealthCheckFailed"
+	reasonStorageSecretMissing     string = "StorageSecretMissing"
+	reasonCredentialSecretMissing  string = "CredentialSecretMissing"
+	reasonBackendNotConfigured     string = "BackendNotConfigured"
+	reasonComponentsNotReady       string = "ComponentsNotReady"
+	reasonAsExpected               string = "AsExpected"
+	reasonReconcileFailed          string = "ReconcileFailed"
+	reasonUpgradeInProgress        string = "UpgradeInProgress"
+	reasonUpgradeCompleted         string = "UpgradeCompleted"
+	reasonUpgradeHalted            string = "UpgradeHalted"
+	reasonUpgradeCancelled         string = "UpgradeCancelled"
+	reasonProgressDeadlineExceeded string = "ProgressDeadlineExceeded"
+	reasonPaused                   string = "Paused"
+	reasonDeprecatedFieldsSet      string = "DeprecatedFieldsSet"
+)
+
+// setComponentConditions updates the status conditions
+// reporting the readiness of each Pachyderm component.
+// Returns true if all components are ready.
+func (r *PachydermReconciler) setComponentConditions(ctx context.Context, components *generators.PachydermComponents) bool {
+	pd := components.Parent()
+	conditions := []metav1.Condition{
+		r.etcdCondition(ctx, components),
+		r.postgresCondition(ctx, components),
+		r.pachdCondition(ctx, components),
+		r.dashCondition(ctx, components),
+		r.storageCondition(ctx, components),
+	}
+
+	notReady := []string{}
+	for _, condition := range conditions {
+		condition.ObservedGeneration = pd.Generation
+		meta.SetStatusCondition(&pd.Status.Conditions, condition)
+
+		if condition.Status != metav1.ConditionTrue {
+			notReady = append(notReady, condition.Type)
+		}
+	}
+
+	// the degraded condition of a failed Pachyderm
+	// resource is managed by reportFailure
+	if pd.Status.Phase == aimlv1beta1.PhaseFailed {
+		return len(notReady) == 0
+	}
+
+	// a Pachyderm resource is only degraded
+	// if it was previously up and running
+	degraded := metav1.Condition{
+		Type:               aimlv1beta1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonAsExpected,
+		ObservedGeneration: pd.Generation,
+	}
+	if len(notReady) > 0 && pd.Status.Phase == aimlv1beta1.PhaseRunning {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = reasonComponentsNotReady
+		degraded.Message = fmt.Sprintf("components not ready: %s", strings.Join(notReady, ", "))
+	}
+	meta.SetStatusCondition(&pd.Status.Conditions, degraded)
+
+	return len(notReady) == 0
+}
+
+func newCondition(conditionType string, ready bool, reason, message string) metav1.Condition {
+	status := metav1.ConditionFalse
+	if ready {
+		status = metav1.ConditionTrue
+	}
+
+	return metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+// serviceCondition checks that a service
+// generated for the component has ready endpoints
+func (r *PachydermReconciler) serviceCondition(ctx context.Context, conditionType string, svc *corev1.Service) (metav1.Condition, bool) {
+	if svc == nil {
+		return newCondition(conditionType, false, reasonEndpointsNotReady,
+			"service not found in the Pachyderm manifests"), false
+	}
+
+	if !r.isServiceReady(ctx, client.ObjectKeyFromObject(svc)) {
+		return newCondition(conditionType, false, reasonEndpointsNotReady,
+			fmt.Sprintf("waiting for service %s endpoints to become ready", svc.Name)), false
+	}
+
+	return metav1.Condition{}, true
+}
+
+// pausedCondition reports a workload held scaled down by a restore
+func pausedCondition(conditionType string, pd *aimlv1beta1.Pachyderm) metav1.Condition {
+	return newCondition(conditionType, false, reasonPaused,
+		fmt.Sprintf("scaled down by restore %s", pd.Annotations[aimlv1beta1.RestoreAnnotation]))
+}
+
+func (r *PachydermReconciler) etcdCondition(ctx context.Context, components *generators.PachydermComponents) metav1.Condition {
+	if generators.EtcdPaused(components.Parent()) {
+		return pausedCondition(aimlv1beta1.ConditionEtcdReady, components.Parent())
+	}
+
+	if ready, message := r.isStatefulSetReady(ctx, components.EtcdStatefulSet()); !ready {
+		return newCondition(aimlv1beta1.ConditionEtcdReady, false, reasonRolloutInProgress, message)
+	}
+
+	if condition, ok := r.serviceCondition(ctx, aimlv1beta1.ConditionEtcdReady, components.EtcdService()); !ok {
+		return condition
+	}
+
+	return newCondition(aimlv1beta1.ConditionEtcdReady, true, reasonReady, "etcd is ready")
+}
+
+func (r *PachydermReconciler) postgresCondition(ctx context.Context, components *generators.PachydermComponents) metav1.Condition {
+	if ready, message := r.isStatefulSetReady(ctx, components.PostgreStatefulset()); !ready {
+		return newCondition(aimlv1beta1.ConditionPostgresReady, false, reasonRolloutInProgress, message)
+	}
+
+	if condition, ok := r.serviceCondition(ctx, aimlv1beta1.ConditionPostgresReady, components.PostgresService()); !ok {
+		return condition
+	}
+
+	return newCondition(aimlv1beta1.ConditionPostgresReady, true, reasonReady, "postgres is ready")
+}
+
+func (r *PachydermReconciler) pachdCondition(ctx context.Context, components *generators.PachydermComponents) metav1.Condition {
+	if generators.Paused(components.Parent()) {
+		return pausedCondition(aimlv1beta1.ConditionPachdReady, components.Parent())
+	}
+
+	if ready, message := r.isDeploymentReady(ctx, components.PachdDeployment()); !ready {
+		return newCondition(aimlv1beta1.ConditionPachdReady, false, reasonRolloutInProgress, message)
+	}
+
+	if condition, ok := r.serviceCondition(ctx, aimlv1beta1.ConditionPachdReady, components.PachdService()); !ok {
+		return condition
+	}
+
+	// check pachd using the gRPC health checking protocol
+	target, err := r.pachdProbeTarget(ctx, components)
+	if err != nil {
+		return newCondition(aimlv1beta1.ConditionPachdReady, false, reasonHealthCheckFailed, err.Error())
+	}
+	if err := r.Prober.Probe(ctx, target); err != nil {
+		return newCondition(aimlv1beta1.ConditionPachdReady, false, reasonHealthCheckFailed, err.Error())
+	}
+
+	return newCondition(aimlv1beta1.ConditionPachdReady, true, reasonReady, "pachd is ready")
+}
+
+// pachdProbeTarget returns the address of the pachd gRPC API and,
+// if pachd is serving TLS, the configuration used to connect to it
+func (r *PachydermReconciler) pachdProbeTarget(ctx context.Context, components *generators.PachydermComponents) (probe.Target, error) {
+	pachdSvc := components.PachdService()
+	port, ok := generators.ServicePort(pachdSvc, "api-grpc-port")
+	if !ok {
+		return probe.Target{}, fmt.Errorf("service %s does not expose the pachd gRPC API", pachdSvc.Name)
+	}
+
+	hostname := fmt.Sprintf("%s.%s.svc", pachdSvc.Name, pachdSvc.Namespace)
+	target := probe.Target{
+		Address: net.JoinHostPort(hostname, fmt.Sprintf("%d", port)),
+	}
+
+	if !components.PachdTLSEnabled() {
+		return target, nil
+	}
+
+	roots, err := r.pachdRootCAs(ctx, components)
+	if err != nil {
+		return target, err
+	}
+	target.TLS = &tls.Config{
+		RootCAs:    roots,
+		ServerName: hostname,
+	}
+
+	return target, nil
+}
+
+// pachdRootCAs returns the CA certificates used to verify the pachd
+// certificate. Certificates issued by the instance CA are verified using
+// the CA bundle. Certificates provided by the user or cert-manager are
+// verified using the CA in the certificate secret, if any, and the
+// system roots otherwise.
+func (r *PachydermReconciler) pachdRootCAs(ctx context.Context, components *generators.PachydermComponents) (*x509.CertPool, error) {
+	namespace := components.Parent().Namespace
+	caPEM := []byte{}
+
+	if components.PachdTLSIssuedByCA() {
+		bundle := &corev1.ConfigMap{}
+		bundleKey := types.NamespacedName{
+			Name:      components.CABundleName(),
+			Namespace: namespace,
+		}
+		if err := r.Get(ctx, bundleKey, bundle); err != nil {
+			return nil, err
+		}
+		caPEM = []byte(bundle.Data[generators.CABundleKey])
+	} else {
+		secret := &corev1.Secret{}
+		secretKey := types.NamespacedName{
+			Name:      components.PachdTLSSecretName(),
+			Namespace: namespace,
+		}
+		if err := r.Get(ctx, secretKey, secret); err != nil {
+			return nil, err
+		}
+		if len(secret.Data[generators.CABundleKey]) == 0 {
+			return nil, nil
+		}
+		caPEM = secret.Data[generators.CABundleKey]
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("unable to parse the CA certificate of %s", components.PachdTLSSecretName())
+	}
+
+	return roots, nil
+}
+
+func (r *PachydermReconciler) dashCondition(ctx context.Context, components *generators.PachydermComponents) metav1.Condition {
+	if components.Parent().Spec.Dashd.Disable {
+		return newCondition(aimlv1beta1.ConditionDashReady, true, reasonDisabled, "dash is disabled")
+	}
+
+	if generators.Paused(components.Parent()) {
+		return pausedCondition(aimlv1beta1.ConditionDashReady, components.Parent())
+	}
+
+	if ready, message := r.isDeploymentReady(ctx, components.DashDeployment()); !ready {
+		return newCondition(aimlv1beta1.ConditionDashReady, false, reasonRolloutInProgress, message)
+	}
+
+	if condition, ok := r.serviceCondition(ctx, aimlv1beta1.ConditionDashReady, components.DashService()); !ok {
+		return condition
+	}
+
+	return newCondition(aimlv1beta1.ConditionDashReady, true, reasonReady, "dash is ready")
+}
+
+func (r *PachydermReconciler) storageCondition(ctx context.Context, components *generators.PachydermComponents) metav1.Condition {
+	pd := components.Parent()
+	storage := pd.Spec.Pachd.Storage
+	backendConfigured := map[string]bool{
+		"amazon":    storage.Amazon != nil,
+		"google":    storage.Google != nil,
+		"microsoft": storage.Microsoft != nil,
+		"minio":     storage.Minio != nil,
+		"local":     storage.Local != nil,
+	}
+	if !backendConfigured[storage.Backend] {
+		return newCondition(aimlv1beta1.ConditionStorageConfigured, false, reasonBackendNotConfigured,
+			fmt.Sprintf("spec.pachd.storage.%s is required for the %q storage backend", storage.Backend, storage.Backend))
+	}
+
+	if storage.Google != nil {
+		credentialSecret := types.NamespacedName{
+			Name:      storage.Google.CredentialSecret,
+			Namespace: pd.Namespace,
+		}
+		if err := r.Get(ctx, credentialSecret, &corev1.Secret{}); err != nil {
+			return newCondition(aimlv1beta1.ConditionStorageConfigured, false, reasonCredentialSecretMissing,
+				fmt.Sprintf("unable to read google credential secret %s: %s", credentialSecret.Name, err.Error()))
+		}
+	}
+
+	storageSecret := types.NamespacedName{
+		Name:      components.StorageSecretName(),
+		Namespace: pd.Namespace,
+	}
+	if err := r.Get(ctx, storageSecret, &corev1.Secret{}); err != nil {
+		return newCondition(aimlv1beta1.ConditionStorageConfigured, false, reasonStorageSecretMissing,
+			fmt.Sprintf("storage secret %s has not been created", storageSecret.Name))
+	}
+
+	return newCondition(aimlv1beta1.ConditionStorageConfigured, true, reasonReady,
+		fmt.Sprintf("using the %s storage backend", storage.Backend))
+}
+
+// reconcileError records the step
+// of the reconciliation that failed
+type reconcileError struct {
+	reason string
+	err    error
+}
+
+func (e *reconcileError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reconcileError) Unwrap() error {
+	return e.err
+}
+
+// stepFailed annotates an error with the reason
+// used to report the failed reconciliation step
+func stepFailed(reason string, err error) error {
+	if isWaiting(err) {
+		return err
+	}
+	return &reconcileError{
+		reason: reason,
+		err:    err,
+	}
+}
+
+// isWaiting returns true if the error reports that the
+// reconciliation is waiting on a component to become ready
+func isWaiting(err error) bool {
+	return err == ErrEtcdNotReady ||
+		err == ErrCertificateNotReady ||
+		err == ErrUpgradeInProgress
+}
+
+// reportFailure records a warning event on the Pachyderm resource
+// and sets its status to failed with the error encountered
+func (r *PachydermReconciler) reportFailure(ctx context.Context, pd *aimlv1beta1.Pachyderm, err error) error {
+	// conflicts are resolved by retrying the reconciliation
+	if pd.DeletionTimestamp != nil || apierrors.IsConflict(err) {
+		return nil
+	}
+
+	reason := reasonReconcileFailed
+	var stepErr *reconcileError
+	if errors.As(err, &stepErr) {
+		reason = stepErr.reason
+	}
+	r.Recorder.Event(pd, corev1.EventTypeWarning, reason, err.Error())
+
+	current := &aimlv1beta1.Pachyderm{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(pd), current); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	now := metav1.Now()
+	current.Status.Phase = aimlv1beta1.PhaseFailed
+	current.Status.LastError = err.Error()
+	current.Status.LastErrorTime = &now
+	meta.SetStatusCondition(&current.Status.Conditions, metav1.Condition{
+		Type:               aimlv1beta1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            err.Error(),
+		ObservedGeneration: current.Generation,
+	})
+
+	return r.Status().Patch(ctx, current, patch)
+}
+
+// clearFailure moves a failed Pachyderm resource back to the
+// initializing phase once it has been reconciled successfully.
+// The last error is kept in the status for reference.
+func (r *PachydermReconciler) clearFailure(ctx context.Context, pd *aimlv1beta1.Pachyderm) error {
+	current := &aimlv1beta1.Pachyderm{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(pd), current); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if current.Status.Phase != aimlv1beta1.PhaseFailed {
+		return nil
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	current.Status.Phase = aimlv1beta1.PhaseInitializing
+	meta.SetStatusCondition(&current.Status.Conditions, metav1.Condition{
+		Type:               aimlv1beta1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonAsExpected,
+		ObservedGeneration: current.Generation,
+	})
+
+	return r.Status().Patch(ctx, current, patch)
+}
+
+// reportDeprecatedFields records a warning event for the deprecated
+// fields set on the pachyderm resource. The event is only recorded
+// once per generation, tracked in the DeprecatedFields condition.
+func (r *PachydermReconciler) reportDeprecatedFields(ctx context.Context, pd *aimlv1beta1.Pachyderm) error {
+	// the status was patched since pd was read, so the
+	// condition is set on the latest version of the resource
+	current := &aimlv1beta1.Pachyderm{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(pd), current); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	fields := current.DeprecatedFields()
+	reported := meta.FindStatusCondition(current.Status.Conditions, aimlv1beta1.ConditionDeprecatedFields)
+
+	condition := metav1.Condition{
+		Type:               aimlv1beta1.ConditionDeprecatedFields,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonAsExpected,
+		ObservedGeneration: current.Generation,
+	}
+	if len(fields) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonDeprecatedFieldsSet
+		condition.Message = fmt.Sprintf("deprecated fields are set: %s", strings.Join(fields, ", "))
+	}
+
+	if reported == nil && len(fields) == 0 {
+		return nil
+	}
+	if reported != nil && reported.ObservedGeneration == condition.ObservedGeneration &&
+		reported.Status == condition.Status && reported.Message == condition.Message {
+		return nil
+	}
+
+	for _, field := range fields {
+		r.Recorder.Eventf(current, corev1.EventTypeWarning, "DeprecatedField",
+			"%s is deprecated and will be removed, store the credential in a secret and use the matching secret reference", field)
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	meta.SetStatusCondition(&current.Status.Conditions, condition)
+
+	return r.Status().Patch(ctx, current, patch)
+}
@@ -0,0 +1,354 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+	"github.com/opdev/pachyderm-operator/controllers/probe"
+)
+
+// fakeProber returns the same result for every target
+type fakeProber struct {
+	err error
+}
+
+func (p *fakeProber) Probe(ctx context.Context, target probe.Target) error {
+	return p.err
+}
+
+// readyObjects returns the workloads, endpoints and storage
+// secret of the pachyderm components once they are ready
+func readyObjects(components *generators.PachydermComponents) []runtime.Object {
+	objs := []runtime.Object{}
+	for _, sts := range []*appsv1.StatefulSet{components.EtcdStatefulSet(), components.PostgreStatefulset()} {
+		sts = sts.DeepCopy()
+		sts.Status.UpdatedReplicas = statefulSetReplicas(sts)
+		sts.Status.ReadyReplicas = statefulSetReplicas(sts)
+		objs = append(objs, sts)
+	}
+	for _, deploy := range []*appsv1.Deployment{components.PachdDeployment(), components.DashDeployment()} {
+		deploy = deploy.DeepCopy()
+		deploy.Status.Replicas = 1
+		deploy.Status.UpdatedReplicas = 1
+		deploy.Status.AvailableReplicas = 1
+		objs = append(objs, deploy)
+	}
+	for _, svc := range []*corev1.Service{components.EtcdService(), components.PostgresService(),
+		components.PachdService(), components.DashService()} {
+		objs = append(objs, &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: svc.Name, Namespace: svc.Namespace},
+			Subsets: []corev1.EndpointSubset{
+				{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}},
+			},
+		})
+	}
+	objs = append(objs, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: components.StorageSecretName(), Namespace: components.Parent().Namespace},
+	})
+	return objs
+}
+
+var _ = Describe("setComponentConditions", func() {
+	var (
+		ctx        context.Context
+		pd         *aimlv1beta1.Pachyderm
+		components *generators.PachydermComponents
+		prober     *fakeProber
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		pd = newTestPachyderm()
+		pd.Generation = 3
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+
+		var err error
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		prober = &fakeProber{}
+	})
+
+	reconciler := func(objs ...runtime.Object) *PachydermReconciler {
+		scheme := newTestScheme()
+		return &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, objs...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+			Prober:   prober,
+		}
+	}
+
+	// condition returns the status condition of the given type
+	condition := func(conditionType string) *metav1.Condition {
+		condition := meta.FindStatusCondition(pd.Status.Conditions, conditionType)
+		Expect(condition).NotTo(BeNil(), "condition %s", conditionType)
+		Expect(condition.ObservedGeneration).To(Equal(pd.Generation))
+		return condition
+	}
+
+	It("reports every component ready", func() {
+		r := reconciler(readyObjects(components)...)
+		Expect(r.setComponentConditions(ctx, components)).To(BeTrue())
+
+		for _, conditionType := range []string{
+			aimlv1beta1.ConditionEtcdReady,
+			aimlv1beta1.ConditionPostgresReady,
+			aimlv1beta1.ConditionPachdReady,
+			aimlv1beta1.ConditionDashReady,
+			aimlv1beta1.ConditionStorageConfigured,
+		} {
+			Expect(condition(conditionType).Status).To(Equal(metav1.ConditionTrue), "condition %s", conditionType)
+		}
+		Expect(condition(aimlv1beta1.ConditionDegraded).Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("reports the components that are not deployed yet", func() {
+		r := reconciler()
+		Expect(r.setComponentConditions(ctx, components)).To(BeFalse())
+
+		Expect(condition(aimlv1beta1.ConditionEtcdReady).Reason).To(Equal(reasonRolloutInProgress))
+		Expect(condition(aimlv1beta1.ConditionPachdReady).Reason).To(Equal(reasonRolloutInProgress))
+		Expect(condition(aimlv1beta1.ConditionStorageConfigured).Reason).To(Equal(reasonStorageSecretMissing))
+
+		// a resource that never ran is not degraded
+		Expect(condition(aimlv1beta1.ConditionDegraded).Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("reports services without ready endpoints", func() {
+		objs := []runtime.Object{}
+		for _, obj := range readyObjects(components) {
+			if ep, ok := obj.(*corev1.Endpoints); ok && ep.Name == components.PostgresService().Name {
+				continue
+			}
+			objs = append(objs, obj)
+		}
+
+		r := reconciler(objs...)
+		Expect(r.setComponentConditions(ctx, components)).To(BeFalse())
+		postgres := condition(aimlv1beta1.ConditionPostgresReady)
+		Expect(postgres.Status).To(Equal(metav1.ConditionFalse))
+		Expect(postgres.Reason).To(Equal(reasonEndpointsNotReady))
+	})
+
+	It("reports pachd failing its health check", func() {
+		prober.err = fmt.Errorf("pachd is not serving")
+		r := reconciler(readyObjects(components)...)
+		Expect(r.setComponentConditions(ctx, components)).To(BeFalse())
+
+		pachd := condition(aimlv1beta1.ConditionPachdReady)
+		Expect(pachd.Reason).To(Equal(reasonHealthCheckFailed))
+		Expect(pachd.Message).To(Equal("pachd is not serving"))
+	})
+
+	It("reports a storage backend without its options", func() {
+		objs := readyObjects(components)
+		pd.Spec.Pachd.Storage.Backend = "google"
+		r := reconciler(objs...)
+		Expect(r.setComponentConditions(ctx, components)).To(BeFalse())
+
+		storage := condition(aimlv1beta1.ConditionStorageConfigured)
+		Expect(storage.Reason).To(Equal(reasonBackendNotConfigured))
+		Expect(storage.Message).To(Equal(`spec.pachd.storage.google is required for the "google" storage backend`))
+	})
+
+	It("reports a running resource with components not ready as degraded", func() {
+		pd.Status.Phase = aimlv1beta1.PhaseRunning
+		pd.Spec.Dashd.Disable = true
+		prober.err = fmt.Errorf("pachd is not serving")
+		r := reconciler(readyObjects(components)...)
+		Expect(r.setComponentConditions(ctx, components)).To(BeFalse())
+
+		Expect(condition(aimlv1beta1.ConditionDashReady).Reason).To(Equal(reasonDisabled))
+		degraded := condition(aimlv1beta1.ConditionDegraded)
+		Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+		Expect(degraded.Reason).To(Equal(reasonComponentsNotReady))
+		Expect(degraded.Message).To(Equal("components not ready: " + aimlv1beta1.ConditionPachdReady))
+	})
+})
+
+var _ = Describe("reportFailure", func() {
+	var (
+		ctx      context.Context
+		pd       *aimlv1beta1.Pachyderm
+		recorder *record.FakeRecorder
+		r        *PachydermReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := newTestScheme()
+		pd = newTestPachyderm()
+		pd.Generation = 2
+		pd.Status.Phase = aimlv1beta1.PhaseRunning
+		recorder = record.NewFakeRecorder(10)
+		r = &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, pd),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: recorder,
+		}
+	})
+
+	// live returns the pachyderm resource read from the client
+	live := func() *aimlv1beta1.Pachyderm {
+		live := &aimlv1beta1.Pachyderm{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pd), live)).To(Succeed())
+		return live
+	}
+
+	It("records the failed step in the status and events", func() {
+		err := stepFailed("EtcdFailed", errors.New("statefulset etcd is invalid"))
+		Expect(r.reportFailure(ctx, pd, err)).To(Succeed())
+
+		Expect(recorder.Events).To(Receive(Equal("Warning EtcdFailed statefulset etcd is invalid")))
+		status := live().Status
+		Expect(status.Phase).To(Equal(aimlv1beta1.PhaseFailed))
+		Expect(status.LastError).To(Equal("statefulset etcd is invalid"))
+		Expect(status.LastErrorTime).NotTo(BeNil())
+
+		degraded := meta.FindStatusCondition(status.Conditions, aimlv1beta1.ConditionDegraded)
+		Expect(degraded).NotTo(BeNil())
+		Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+		Expect(degraded.Reason).To(Equal("EtcdFailed"))
+		Expect(degraded.ObservedGeneration).To(Equal(int64(2)))
+	})
+
+	It("reports errors of unknown steps as reconcile failures", func() {
+		Expect(r.reportFailure(ctx, pd, errors.New("boom"))).To(Succeed())
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning " + reasonReconcileFailed)))
+	})
+
+	It("does not report conflicts", func() {
+		conflict := apierrors.NewConflict(schema.GroupResource{Resource: "pachyderms"}, pd.Name, errors.New("modified"))
+		Expect(r.reportFailure(ctx, pd, stepFailed("PachdFailed", conflict))).To(Succeed())
+		Expect(recorder.Events).To(BeEmpty())
+		Expect(live().Status.Phase).To(Equal(aimlv1beta1.PhaseRunning))
+	})
+
+	It("does not wrap the errors of steps waiting on a component", func() {
+		Expect(stepFailed("EtcdFailed", ErrEtcdNotReady)).To(Equal(ErrEtcdNotReady))
+	})
+
+	It("clears the failure once reconciled and keeps the last error", func() {
+		Expect(r.reportFailure(ctx, pd, errors.New("boom"))).To(Succeed())
+		Expect(r.clearFailure(ctx, pd)).To(Succeed())
+
+		status := live().Status
+		Expect(status.Phase).To(Equal(aimlv1beta1.PhaseInitializing))
+		Expect(status.LastError).To(Equal("boom"))
+		Expect(meta.IsStatusConditionFalse(status.Conditions, aimlv1beta1.ConditionDegraded)).To(BeTrue())
+	})
+
+	It("keeps the phase of resources that did not fail", func() {
+		Expect(r.clearFailure(ctx, pd)).To(Succeed())
+		Expect(live().Status.Phase).To(Equal(aimlv1beta1.PhaseRunning))
+	})
+})
+
+var _ = Describe("reportDeprecatedFields", func() {
+	var (
+		ctx      context.Context
+		pd       *aimlv1beta1.Pachyderm
+		recorder *record.FakeRecorder
+		r        *PachydermReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := newTestScheme()
+		pd = newTestPachyderm()
+		pd.Generation = 1
+		pd.Spec.Pachd.Postgres.Password = "secret"
+		recorder = record.NewFakeRecorder(10)
+		r = &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, pd),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: recorder,
+		}
+	})
+
+	// update changes the live pachyderm resource
+	update := func(mutate func(*aimlv1beta1.Pachyderm)) {
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pd), pd)).To(Succeed())
+		mutate(pd)
+		Expect(r.Update(ctx, pd)).To(Succeed())
+	}
+
+	// reported returns the deprecation condition of the live resource
+	reported := func() *metav1.Condition {
+		live := &aimlv1beta1.Pachyderm{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pd), live)).To(Succeed())
+		return meta.FindStatusCondition(live.Status.Conditions, aimlv1beta1.ConditionDeprecatedFields)
+	}
+
+	It("records the deprecated fields once per generation", func() {
+		Expect(r.reportDeprecatedFields(ctx, pd)).To(Succeed())
+		Expect(recorder.Events).To(HaveLen(1))
+		condition := reported()
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.ObservedGeneration).To(Equal(int64(1)))
+
+		Expect(r.reportDeprecatedFields(ctx, pd)).To(Succeed())
+		Expect(recorder.Events).To(HaveLen(1))
+
+		update(func(pd *aimlv1beta1.Pachyderm) { pd.Generation = 2 })
+		Expect(r.reportDeprecatedFields(ctx, pd)).To(Succeed())
+		Expect(recorder.Events).To(HaveLen(2))
+	})
+
+	It("clears the condition once the deprecated fields are removed", func() {
+		Expect(r.reportDeprecatedFields(ctx, pd)).To(Succeed())
+		<-recorder.Events
+
+		update(func(pd *aimlv1beta1.Pachyderm) {
+			pd.Spec.Pachd.Postgres.Password = ""
+			pd.Generation = 2
+		})
+		Expect(r.reportDeprecatedFields(ctx, pd)).To(Succeed())
+		Expect(recorder.Events).To(BeEmpty())
+		Expect(reported().Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("keeps the conditions set since the resource was read", func() {
+		stale := pd.DeepCopy()
+
+		// conditions set by reconcileStatus
+		live := &aimlv1beta1.Pachyderm{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pd), live)).To(Succeed())
+		patch := client.MergeFrom(live.DeepCopy())
+		meta.SetStatusCondition(&live.Status.Conditions, newCondition(aimlv1beta1.ConditionPachdReady, true, reasonReady, "pachd is ready"))
+		Expect(r.Status().Patch(ctx, live, patch)).To(Succeed())
+
+		Expect(r.reportDeprecatedFields(ctx, stale)).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pd), live)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(live.Status.Conditions, aimlv1beta1.ConditionPachdReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(live.Status.Conditions, aimlv1beta1.ConditionDeprecatedFields)).To(BeTrue())
+	})
+
+	It("does not report resources without deprecated fields", func() {
+		update(func(pd *aimlv1beta1.Pachyderm) { pd.Spec.Pachd.Postgres.Password = "" })
+		Expect(r.reportDeprecatedFields(ctx, pd)).To(Succeed())
+		Expect(recorder.Events).To(BeEmpty())
+		Expect(reported()).To(BeNil())
+	})
+})
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+// loadCertificateSecrets passes the current instance CA and
+// certificate secrets to the generators, so that valid
+// certificates are not replaced
+func (r *PachydermReconciler) loadCertificateSecrets(ctx context.Context, components *generators.PachydermComponents) ([]*corev1.Secret, error) {
+	pd := components.Parent()
+	secrets := []*corev1.Secret{}
+
+	for _, name := range components.CertificateSecretNames() {
+		secret := &corev1.Secret{}
+		secretKey := types.NamespacedName{
+			Name:      name,
+			Namespace: pd.Namespace,
+		}
+
+		if err := r.Get(ctx, secretKey, secret); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		components.SetCurrentSecret(secret)
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, nil
+}
+
+// reconcileCertificates loads the current certificate secrets and
+// deletes the secrets and CA bundle if TLS is disabled for pachd
+func (r *PachydermReconciler) reconcileCertificates(ctx context.Context, components *generators.PachydermComponents) error {
+	secrets, err := r.loadCertificateSecrets(ctx, components)
+	if err != nil || components.PachdTLSEnabled() {
+		return err
+	}
+
+	// the pachd certificate is only listed while TLS is enabled
+	pd := components.Parent()
+	pachdSecret := &corev1.Secret{}
+	pachdSecretKey := types.NamespacedName{
+		Name:      components.PachdTLSSecretName(),
+		Namespace: pd.Namespace,
+	}
+	if err := r.Get(ctx, pachdSecretKey, pachdSecret); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+	} else {
+		secrets = append(secrets, pachdSecret)
+	}
+
+	for _, secret := range secrets {
+		if !metav1.IsControlledBy(secret, pd) {
+			continue
+		}
+		if err := r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	bundle := &corev1.ConfigMap{}
+	bundleKey := types.NamespacedName{
+		Name:      components.CABundleName(),
+		Namespace: pd.Namespace,
+	}
+	if err := r.Get(ctx, bundleKey, bundle); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if metav1.IsControlledBy(bundle, pd) {
+		if err := r.Delete(ctx, bundle); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
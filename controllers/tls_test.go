@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+)
+
+var _ = Describe("reconcileCertificates", func() {
+	var (
+		ctx     context.Context
+		scheme  *runtime.Scheme
+		pd      *aimlv1beta1.Pachyderm
+		secrets []*corev1.Secret
+		r       *PachydermReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = newTestScheme()
+		pd = newTestPachyderm()
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+		pd.Spec.Pachd.TLS = &aimlv1beta1.PachdTLSOptions{Enabled: true}
+
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		generated, err := components.Secrets()
+		Expect(err).NotTo(HaveOccurred())
+
+		objs := []runtime.Object{}
+		secrets = []*corev1.Secret{}
+		for _, secret := range generated {
+			if secret.Type != corev1.SecretTypeTLS {
+				continue
+			}
+			Expect(controllerutil.SetControllerReference(pd, secret, scheme)).To(Succeed())
+			secrets = append(secrets, secret)
+			objs = append(objs, secret)
+		}
+		Expect(secrets).NotTo(BeEmpty())
+
+		r = &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, objs...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	It("reuses the current certificates", func() {
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.reconcileCertificates(ctx, components)).To(Succeed())
+
+		generated, err := components.Secrets()
+		Expect(err).NotTo(HaveOccurred())
+		current := map[string]*corev1.Secret{}
+		for _, secret := range secrets {
+			current[secret.Name] = secret
+		}
+		for _, secret := range generated {
+			if existing, ok := current[secret.Name]; ok {
+				Expect(secret.Data).To(Equal(existing.Data), "certificate of %s", secret.Name)
+			}
+		}
+	})
+
+	It("deletes the certificates once TLS is disabled", func() {
+		pd.Spec.Pachd.TLS = nil
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.reconcileCertificates(ctx, components)).To(Succeed())
+
+		for _, secret := range secrets {
+			err := r.Get(ctx, client.ObjectKeyFromObject(secret), &corev1.Secret{})
+			Expect(errors.IsNotFound(err)).To(BeTrue(), "secret %s should be deleted", secret.Name)
+		}
+	})
+})
@@ -0,0 +1,414 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"golang.org/x/mod/semver"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
+)
+
+// componentDeployment deploys a single Pachyderm component.
+// The reason is reported if the deployment fails.
+type componentDeployment struct {
+	reason string
+	deploy func(context.Context, *generators.PachydermComponents) error
+}
+
+// upgradeStep groups the components rolled out together
+// during an upgrade. The next step is only started once
+// all the components of the step report they are ready.
+type upgradeStep struct {
+	name       string
+	components []componentDeployment
+	conditions []func(context.Context, *generators.PachydermComponents) metav1.Condition
+}
+
+// upgradeSteps returns the steps of an upgrade in the order they
+// are rolled out. The databases are upgraded before pachd, which
+// migrates the metadata on start, and the dashboard comes last.
+// The secrets, config maps and services of the target version
+// are only deployed with pachd, so the configuration of the
+// running version is kept until the databases are upgraded.
+func (r *PachydermReconciler) upgradeSteps() []upgradeStep {
+	return []upgradeStep{
+		{
+			name: "databases",
+			components: []componentDeployment{
+				{reason: "EtcdFailed", deploy: r.deployEtcd},
+				{reason: "PostgresFailed", deploy: r.deployPostgres},
+			},
+			conditions: []func(context.Context, *generators.PachydermComponents) metav1.Condition{
+				r.etcdCondition,
+				r.postgresCondition,
+			},
+		},
+		{
+			name: "pachd",
+			components: []componentDeployment{
+				{reason: "SecretsFailed", deploy: r.reconcileSecrets},
+				{reason: "ConfigMapsFailed", deploy: r.reconcileConfigMaps},
+				{reason: "ServicesFailed", deploy: r.reconcileServices},
+				{reason: "PachdFailed", deploy: r.deployPachd},
+			},
+			conditions: []func(context.Context, *generators.PachydermComponents) metav1.Condition{
+				r.pachdCondition,
+			},
+		},
+		{
+			name: "dash",
+			components: []componentDeployment{
+				{reason: "DashFailed", deploy: r.deployDash},
+			},
+			conditions: []func(context.Context, *generators.PachydermComponents) metav1.Condition{
+				r.dashCondition,
+			},
+		},
+	}
+}
+
+// deployComponents deploys the Pachyderm workloads. When the
+// requested version differs from the version currently rolled
+// out, the workloads are upgraded one step at a time.
+func (r *PachydermReconciler) deployComponents(ctx context.Context, components *generators.PachydermComponents) error {
+	pd := components.Parent()
+	currentVersion := pd.Status.CurrentVersion
+	targetVersion := catalog.Canonical(pd.Spec.Version)
+
+	steps := r.upgradeSteps()
+	if currentVersion == "" || targetVersion == "" || currentVersion == targetVersion ||
+		generators.Paused(pd) {
+		for _, step := range steps {
+			for _, component := range step.components {
+				if err := component.deploy(ctx, components); err != nil {
+					return stepFailed(component.reason, err)
+				}
+			}
+		}
+
+		// the workloads are held scaled down by a restore,
+		// which replaces the data the upgrade would migrate
+		if generators.Paused(pd) {
+			return nil
+		}
+		return r.cancelUpgrade(ctx, components)
+	}
+
+	// a failed upgrade is retried once the spec is changed
+	if upgradeFailed(pd) {
+		if !pd.RollbackEnabled() {
+			return nil
+		}
+		return r.rollback(ctx, components)
+	}
+
+	return r.upgrade(ctx, components, steps, currentVersion, targetVersion)
+}
+
+// upgrade rolls out the steps of an upgrade in order, waiting for the
+// components of each step to become ready before starting the next.
+// The upgrade is halted if the upgrade path is not supported or if
+// a step could not be deployed, and rolled back if it does not make
+// progress before the deadline.
+func (r *PachydermReconciler) upgrade(ctx context.Context, components *generators.PachydermComponents, steps []upgradeStep, currentVersion, targetVersion string) error {
+	pd := components.Parent()
+
+	if err := validateUpgradePath(pd, currentVersion, targetVersion); err != nil {
+		changed, statusErr := r.setUpgradeStatus(ctx, pd, "",
+			newCondition(aimlv1beta1.ConditionUpgrading, false, reasonUpgradeHalted, err.Error()))
+		if changed {
+			r.Recorder.Event(pd, corev1.EventTypeWarning, reasonUpgradeHalted, err.Error())
+		}
+		return statusErr
+	}
+
+	if upgrading := meta.FindStatusCondition(pd.Status.Conditions, aimlv1beta1.ConditionUpgrading); upgrading != nil &&
+		upgrading.Status == metav1.ConditionTrue &&
+		upgrading.ObservedGeneration == pd.Generation &&
+		time.Since(upgrading.LastTransitionTime.Time) > pd.UpgradeProgressDeadline() {
+		return r.failUpgrade(ctx, components, currentVersion, targetVersion, upgrading.Message)
+	}
+
+	if pd.Spec.Upgrade != nil && pd.Spec.Upgrade.Backup {
+		if done, err := r.preUpgradeBackup(ctx, pd, currentVersion, targetVersion); !done {
+			return err
+		}
+	}
+
+	// keep the workloads running the current version
+	// to roll them back if the upgrade fails
+	if err := r.saveLastKnownGood(ctx, components, currentVersion); err != nil {
+		return stepFailed("UpgradeFailed", err)
+	}
+
+	for _, step := range steps {
+		for _, component := range step.components {
+			if err := component.deploy(ctx, components); err != nil {
+				if isWaiting(err) {
+					return err
+				}
+
+				message := fmt.Sprintf("upgrade from %s to %s halted at the %s step: %s",
+					currentVersion, targetVersion, step.name, err.Error())
+				if _, statusErr := r.setUpgradeStatus(ctx, pd, "",
+					newCondition(aimlv1beta1.ConditionUpgrading, false, reasonUpgradeHalted, message)); statusErr != nil {
+					return statusErr
+				}
+				return stepFailed(component.reason, err)
+			}
+		}
+
+		for _, condition := range step.conditions {
+			c := condition(ctx, components)
+			if c.Status == metav1.ConditionTrue {
+				continue
+			}
+
+			message := fmt.Sprintf("upgrading from %s to %s, waiting for the %s step: %s",
+				currentVersion, targetVersion, step.name, c.Message)
+			if _, err := r.setUpgradeStatus(ctx, pd, "",
+				newCondition(aimlv1beta1.ConditionUpgrading, true, reasonUpgradeInProgress, message)); err != nil {
+				return err
+			}
+			return ErrUpgradeInProgress
+		}
+	}
+
+	message := fmt.Sprintf("upgraded from %s to %s", currentVersion, targetVersion)
+	conditions := []metav1.Condition{
+		newCondition(aimlv1beta1.ConditionUpgrading, false, reasonUpgradeCompleted, message),
+	}
+	if meta.FindStatusCondition(pd.Status.Conditions, aimlv1beta1.ConditionUpgradeFailed) != nil {
+		conditions = append(conditions,
+			newCondition(aimlv1beta1.ConditionUpgradeFailed, false, reasonUpgradeCompleted, message))
+	}
+	if _, err := r.setUpgradeStatus(ctx, pd, targetVersion, conditions...); err != nil {
+		return err
+	}
+	r.Recorder.Event(pd, corev1.EventTypeNormal, reasonUpgradeCompleted, message)
+
+	return r.deleteLastKnownGood(ctx, pd)
+}
+
+// failUpgrade marks the upgrade of a Pachyderm resource as failed
+// and, unless rollback is disabled, rolls the workloads back
+// to the version they were running before the upgrade
+func (r *PachydermReconciler) failUpgrade(ctx context.Context, components *generators.PachydermComponents, currentVersion, targetVersion, progress string) error {
+	pd := components.Parent()
+
+	message := fmt.Sprintf("upgrade from %s to %s did not complete within %s (%s)",
+		currentVersion, targetVersion, pd.UpgradeProgressDeadline(), progress)
+	if pd.RollbackEnabled() {
+		message = fmt.Sprintf("%s, rolled back to %s", message, currentVersion)
+	}
+
+	if _, err := r.setUpgradeStatus(ctx, pd, "",
+		newCondition(aimlv1beta1.ConditionUpgrading, false, reasonProgressDeadlineExceeded, message),
+		newCondition(aimlv1beta1.ConditionUpgradeFailed, true, reasonProgressDeadlineExceeded, message)); err != nil {
+		return err
+	}
+	r.Recorder.Event(pd, corev1.EventTypeWarning, reasonProgressDeadlineExceeded, message)
+
+	if !pd.RollbackEnabled() {
+		return nil
+	}
+	return r.rollback(ctx, components)
+}
+
+// cancelUpgrade resets the upgrade status of a Pachyderm resource
+// whose version was set back to the current version before the
+// upgrade completed
+func (r *PachydermReconciler) cancelUpgrade(ctx context.Context, components *generators.PachydermComponents) error {
+	pd := components.Parent()
+	upgrading := meta.FindStatusCondition(pd.Status.Conditions, aimlv1beta1.ConditionUpgrading)
+	if upgrading == nil || upgrading.Reason == reasonUpgradeCompleted || upgrading.Reason == reasonUpgradeCancelled {
+		return nil
+	}
+
+	message := fmt.Sprintf("version set back to %s", pd.Status.CurrentVersion)
+	conditions := []metav1.Condition{
+		newCondition(aimlv1beta1.ConditionUpgrading, false, reasonUpgradeCancelled, message),
+	}
+	if meta.IsStatusConditionTrue(pd.Status.Conditions, aimlv1beta1.ConditionUpgradeFailed) {
+		conditions = append(conditions,
+			newCondition(aimlv1beta1.ConditionUpgradeFailed, false, reasonUpgradeCancelled, message))
+	}
+	if _, err := r.setUpgradeStatus(ctx, pd, "", conditions...); err != nil {
+		return err
+	}
+
+	return r.deleteLastKnownGood(ctx, pd)
+}
+
+// preUpgradeBackup takes a backup of the Pachyderm resource before
+// its workloads are upgraded. Returns true once the backup is
+// completed. The upgrade is halted if the backup failed.
+func (r *PachydermReconciler) preUpgradeBackup(ctx context.Context, pd *aimlv1beta1.Pachyderm, currentVersion, targetVersion string) (bool, error) {
+	backup := &aimlv1beta1.PachydermBackup{}
+	backupKey := types.NamespacedName{
+		Name:      preUpgradeBackupName(pd, targetVersion),
+		Namespace: pd.Namespace,
+	}
+
+	if err := r.Get(ctx, backupKey, backup); err != nil {
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+
+		backup = &aimlv1beta1.PachydermBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      backupKey.Name,
+				Namespace: backupKey.Namespace,
+				Labels: map[string]string{
+					generators.InstanceLabel: pd.Name,
+				},
+			},
+			Spec: aimlv1beta1.PachydermBackupSpec{
+				Pachyderm: pd.Name,
+			},
+		}
+		if err := controllerutil.SetControllerReference(pd, backup, r.Scheme); err != nil {
+			return false, err
+		}
+		if err := r.Create(ctx, backup); err != nil {
+			return false, err
+		}
+		r.Recorder.Eventf(pd, corev1.EventTypeNormal, "PreUpgradeBackup",
+			"taking backup %s before upgrading from %s to %s", backup.Name, currentVersion, targetVersion)
+	}
+
+	switch backup.Status.Phase {
+	case aimlv1beta1.BackupPhaseCompleted:
+		return true, nil
+	case aimlv1beta1.BackupPhaseFailed:
+		message := fmt.Sprintf("upgrade from %s to %s halted, backup %s failed; delete the backup to take it again",
+			currentVersion, targetVersion, backup.Name)
+		changed, err := r.setUpgradeStatus(ctx, pd, "",
+			newCondition(aimlv1beta1.ConditionUpgrading, false, reasonUpgradeHalted, message))
+		if changed {
+			r.Recorder.Event(pd, corev1.EventTypeWarning, reasonUpgradeHalted, message)
+		}
+		return false, err
+	}
+
+	message := fmt.Sprintf("upgrading from %s to %s, waiting for backup %s to complete",
+		currentVersion, targetVersion, backup.Name)
+	if _, err := r.setUpgradeStatus(ctx, pd, "",
+		newCondition(aimlv1beta1.ConditionUpgrading, true, reasonUpgradeInProgress, message)); err != nil {
+		return false, err
+	}
+	return false, ErrUpgradeInProgress
+}
+
+// preUpgradeBackupName returns the name of the backup
+// taken before upgrading to the target version
+func preUpgradeBackupName(pd *aimlv1beta1.Pachyderm, targetVersion string) string {
+	version := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(strings.TrimPrefix(targetVersion, "v")))
+
+	return fmt.Sprintf("%s-pre-upgrade-%s", pd.Name, version)
+}
+
+// upgradeFailed returns true if the upgrade to the
+// current spec of the Pachyderm resource failed
+func upgradeFailed(pd *aimlv1beta1.Pachyderm) bool {
+	failed := meta.FindStatusCondition(pd.Status.Conditions, aimlv1beta1.ConditionUpgradeFailed)
+	return failed != nil &&
+		failed.Status == metav1.ConditionTrue &&
+		failed.ObservedGeneration == pd.Generation
+}
+
+// validateUpgradePath returns an error if pachyderm can not be
+// upgraded directly from the current to the target version.
+// Upgrades are supported within a major version, one minor
+// version at a time. Downgrades require the unsafe update
+// annotation to be set on the resource.
+func validateUpgradePath(pd *aimlv1beta1.Pachyderm, currentVersion, targetVersion string) error {
+	if semver.Compare(targetVersion, currentVersion) < 0 {
+		if pd.Annotations[aimlv1beta1.AllowUnsafeUpdateAnnotation] == "true" {
+			return nil
+		}
+		return fmt.Errorf("downgrading from %s to %s is not supported; set the %s annotation to force it",
+			currentVersion, targetVersion, aimlv1beta1.AllowUnsafeUpdateAnnotation)
+	}
+
+	if semver.Major(targetVersion) != semver.Major(currentVersion) {
+		return fmt.Errorf("upgrading from %s to %s is not supported, major version upgrades require a migration",
+			currentVersion, targetVersion)
+	}
+
+	currentMinor, targetMinor := minorVersion(currentVersion), minorVersion(targetVersion)
+	if targetMinor > currentMinor+1 {
+		return fmt.Errorf("upgrading from %s to %s is not supported, upgrade to %s.%d first",
+			currentVersion, targetVersion, semver.Major(currentVersion), currentMinor+1)
+	}
+
+	return nil
+}
+
+// setUpgradeStatus sets the upgrade conditions of the Pachyderm
+// resource, and the current version once an upgrade is completed.
+// A condition observed for a previous generation is replaced, so
+// the progress deadline restarts when the spec is changed.
+// Returns true if the status was changed.
+func (r *PachydermReconciler) setUpgradeStatus(ctx context.Context, pd *aimlv1beta1.Pachyderm, currentVersion string, conditions ...metav1.Condition) (bool, error) {
+	current := &aimlv1beta1.Pachyderm{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(pd), current); err != nil {
+		return false, err
+	}
+
+	patch := client.MergeFrom(current.DeepCopy())
+	changed := false
+	for _, condition := range conditions {
+		existing := meta.FindStatusCondition(current.Status.Conditions, condition.Type)
+		if existing != nil &&
+			existing.ObservedGeneration == current.Generation &&
+			existing.Status == condition.Status &&
+			existing.Reason == condition.Reason &&
+			existing.Message == condition.Message {
+			continue
+		}
+
+		if existing != nil && existing.ObservedGeneration != current.Generation {
+			meta.RemoveStatusCondition(&current.Status.Conditions, condition.Type)
+		}
+		condition.ObservedGeneration = current.Generation
+		meta.SetStatusCondition(&current.Status.Conditions, condition)
+		changed = true
+	}
+
+	if currentVersion != "" && current.Status.CurrentVersion != currentVersion {
+		current.Status.CurrentVersion = currentVersion
+		changed = true
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	return true, r.Status().Patch(ctx, current, patch)
+}
+
+// minorVersion returns the minor number of a canonical version
+func minorVersion(version string) int {
+	minor, _ := strconv.Atoi(strings.TrimPrefix(semver.MajorMinor(version), semver.Major(version)+"."))
+	return minor
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"context"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
+)
+
+var _ = Describe("minorVersion", func() {
+	table.DescribeTable("canonical versions",
+		func(version string, minor int) {
+			Expect(minorVersion(version)).To(Equal(minor))
+		},
+		table.Entry("release", "v2.0.0", 0),
+		table.Entry("patch release", "v2.1.4", 1),
+		table.Entry("two digit minor", "v1.13.3", 13),
+		table.Entry("pre-release", "v2.2.0-rc.1", 2),
+		table.Entry("invalid version", "", 0),
+	)
+})
+
+var _ = Describe("validateUpgradePath", func() {
+	table.DescribeTable("upgrade paths",
+		func(current, target string, unsafe bool, valid bool) {
+			pd := newTestPachyderm()
+			if unsafe {
+				pd.Annotations = map[string]string{aimlv1beta1.AllowUnsafeUpdateAnnotation: "true"}
+			}
+
+			err := validateUpgradePath(pd, current, target)
+			if valid {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		table.Entry("patch upgrade", "v2.0.0", "v2.0.2", false, true),
+		table.Entry("next minor version", "v2.0.2", "v2.1.0", false, true),
+		table.Entry("skips a minor version", "v2.0.0", "v2.2.0", false, false),
+		table.Entry("major upgrade", "v1.13.3", "v2.0.0", false, false),
+		table.Entry("major upgrade with the annotation", "v1.13.3", "v2.0.0", true, false),
+		table.Entry("downgrade", "v2.1.0", "v2.0.0", false, false),
+		table.Entry("downgrade with the annotation", "v2.1.0", "v2.0.0", true, true),
+	)
+})
+
+var _ = Describe("upgrade steps", func() {
+	var (
+		ctx context.Context
+		pd  *aimlv1beta1.Pachyderm
+		r   *PachydermReconciler
+	)
+
+	BeforeEach(func() {
+		manifests, err := catalog.Embedded().Manifests("2.0.0")
+		Expect(err).NotTo(HaveOccurred())
+		generators.SetCatalog(catalog.NewFSCatalog(fstest.MapFS{
+			"2.0.0/manifests.yaml": {Data: manifests},
+			"2.1.0/manifests.yaml": {Data: manifests},
+			"2.3.0/manifests.yaml": {Data: manifests},
+		}))
+
+		ctx = context.Background()
+		pd = newTestPachyderm()
+		pd.Generation = 1
+		pd.Annotations = map[string]string{aimlv1beta1.NamingAnnotation: aimlv1beta1.NamingInstance}
+		pd.Spec.Version = "2.1.0"
+		pd.Status.CurrentVersion = "v2.0.0"
+	})
+
+	AfterEach(func() {
+		generators.SetCatalog(catalog.Embedded())
+	})
+
+	reconciler := func(objs ...runtime.Object) *PachydermReconciler {
+		scheme := newTestScheme()
+		return &PachydermReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme, append(objs, pd)...),
+			Log:      ctrl.Log,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	}
+
+	// readyStatefulSet returns the statefulset with all replicas ready
+	// and the endpoints of the service in front of it
+	readyStatefulSet := func(sts *appsv1.StatefulSet, svc *corev1.Service) []runtime.Object {
+		sts.Status.Replicas = 1
+		sts.Status.UpdatedReplicas = 1
+		sts.Status.ReadyReplicas = 1
+		ep := &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: svc.Name, Namespace: svc.Namespace},
+			Subsets: []corev1.EndpointSubset{
+				{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}},
+			},
+		}
+		return []runtime.Object{sts, ep}
+	}
+
+	upgradingCondition := func() *metav1.Condition {
+		current := &aimlv1beta1.Pachyderm{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pd), current)).To(Succeed())
+		return meta.FindStatusCondition(current.Status.Conditions, aimlv1beta1.ConditionUpgrading)
+	}
+
+	exists := func(obj client.Object) bool {
+		err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		if errors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	It("upgrades the databases before the pachd configuration", func() {
+		r = reconciler()
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.deployComponents(ctx, components)).To(Equal(ErrUpgradeInProgress))
+		Expect(exists(components.EtcdStatefulSet())).To(BeTrue())
+		Expect(exists(components.PostgreStatefulset())).To(BeTrue())
+		Expect(exists(components.PachdDeployment())).To(BeFalse())
+		Expect(exists(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name: components.StorageSecretName(), Namespace: pd.Namespace}})).To(BeFalse())
+		Expect(exists(components.EtcdService())).To(BeFalse())
+
+		upgrading := upgradingCondition()
+		Expect(upgrading.Status).To(Equal(metav1.ConditionTrue))
+		Expect(upgrading.Message).To(ContainSubstring("waiting for the databases step"))
+	})
+
+	It("deploys the pachd configuration once the databases are ready", func() {
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		objs := readyStatefulSet(components.EtcdStatefulSet(), components.EtcdService())
+		objs = append(objs, readyStatefulSet(components.PostgreStatefulset(), components.PostgresService())...)
+		r = reconciler(objs...)
+
+		components, err = generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.deployComponents(ctx, components)).To(Equal(ErrUpgradeInProgress))
+		Expect(exists(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name: components.StorageSecretName(), Namespace: pd.Namespace}})).To(BeTrue())
+		Expect(exists(components.PachdService())).To(BeTrue())
+		Expect(exists(components.PachdDeployment())).To(BeTrue())
+
+		upgrading := upgradingCondition()
+		Expect(upgrading.Status).To(Equal(metav1.ConditionTrue))
+		Expect(upgrading.Message).To(ContainSubstring("waiting for the pachd step"))
+	})
+
+	It("halts upgrades skipping a minor version", func() {
+		pd.Spec.Version = "2.3.0"
+		r = reconciler()
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.deployComponents(ctx, components)).To(Succeed())
+		Expect(exists(components.EtcdStatefulSet())).To(BeFalse())
+
+		upgrading := upgradingCondition()
+		Expect(upgrading.Status).To(Equal(metav1.ConditionFalse))
+		Expect(upgrading.Reason).To(Equal(reasonUpgradeHalted))
+	})
+
+	It("deploys everything when the version is unchanged", func() {
+		pd.Spec.Version = "2.0.0"
+		r = reconciler()
+		components, err := generators.Prepare(pd)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.deployComponents(ctx, components)).To(Equal(ErrEtcdNotReady))
+		Expect(exists(components.EtcdStatefulSet())).To(BeTrue())
+		Expect(exists(components.EtcdService())).To(BeTrue())
+		Expect(upgradingCondition()).To(BeNil())
+	})
+})
@@ -1,6 +1,6 @@
 module github.com/opdev/pachyderm-operator
 
-go 1.15
+go 1.16
 
 require (
 	github.com/creasty/defaults v1.5.1
@@ -10,8 +10,10 @@ require (
 	github.com/onsi/ginkgo v1.14.1
 	github.com/onsi/gomega v1.10.2
 	golang.org/x/mod v0.4.2
+	google.golang.org/grpc v1.27.0
 	k8s.io/api v0.19.2
 	k8s.io/apimachinery v0.19.2
 	k8s.io/client-go v0.19.2
 	sigs.k8s.io/controller-runtime v0.7.2
+	sigs.k8s.io/yaml v1.2.0
 )
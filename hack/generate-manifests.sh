@@ -0,0 +1,44 @@
+#!/bin/sh
+# Renders the manifests of Pachyderm releases from the upstream
+# helm chart into hack/manifests/<version>/manifests.yaml, where
+# they are compiled into the operator.
+#
+# usage: hack/generate-manifests.sh <version>...
+set -eu
+
+HELM=${HELM:-helm}
+CHART_REPO=${CHART_REPO:-https://helm.pachyderm.com}
+MANIFESTS_DIR=${MANIFESTS_DIR:-$(dirname "$0")/manifests}
+
+if [ $# -eq 0 ]; then
+  echo "usage: $0 <version>..." >&2
+  exit 1
+fi
+
+tmp=
+trap 'rm -f "$tmp"' EXIT
+
+for version in "$@"; do
+  version=${version#v}
+  out="$MANIFESTS_DIR/$version"
+  tmp=$(mktemp)
+
+  # the operator replaces the storage backend and names
+  # of the objects, local storage renders the fewest objects
+  "$HELM" template pachyderm pachyderm \
+    --repo "$CHART_REPO" \
+    --version "$version" \
+    --namespace default \
+    --set deployTarget=LOCAL \
+    > "$tmp"
+
+  # refuse manifests deploying another release than the version
+  if ! grep -Eq "image: \"?pachyderm/pachd:$version\"?\$" "$tmp"; then
+    echo "chart $version does not deploy pachyderm/pachd:$version" >&2
+    exit 1
+  fi
+
+  mkdir -p "$out"
+  mv "$tmp" "$out/manifests.yaml"
+  echo "rendered $out/manifests.yaml"
+done
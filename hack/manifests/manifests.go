@@ -0,0 +1,13 @@
+// Package manifests holds the manifests of the
+// Pachyderm versions compiled into the operator
+package manifests
+
+import "embed"
+
+// FS holds the manifests of each Pachyderm
+// version in <version>/manifests.yaml.
+// They are rendered from the upstream helm
+// chart with make pachyderm-manifests.
+//
+//go:embed */manifests.yaml
+var FS embed.FS
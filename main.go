@@ -18,21 +18,30 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	aimlv1beta1 "github.com/opdev/pachyderm-operator/api/v1beta1"
 	"github.com/opdev/pachyderm-operator/controllers"
+	"github.com/opdev/pachyderm-operator/controllers/generators"
+	"github.com/opdev/pachyderm-operator/pkg/catalog"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -58,11 +67,19 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var manifestsDir string
+	var manifestsConfigMap string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&manifestsDir, "manifests-dir", "",
+		"Directory holding the manifests of each Pachyderm version in <version>/manifests.yaml. "+
+			"The manifests compiled into the operator are used if not set.")
+	flag.StringVar(&manifestsConfigMap, "manifests-configmap", "",
+		"Config map, as <namespace>/<name>, holding the manifests of each Pachyderm version "+
+			"in the key named after the version. Takes precedence over --manifests-dir.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -71,7 +88,8 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	cfg := ctrl.GetConfigOrDie()
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
@@ -84,10 +102,39 @@ func main() {
 		os.Exit(1)
 	}
 
+	manifests, err := manifestCatalog(mgr, manifestsDir, manifestsConfigMap)
+	if err != nil {
+		setupLog.Error(err, "unable to set up the manifest catalog")
+		os.Exit(1)
+	}
+	generators.SetCatalog(manifests)
+	aimlv1beta1.SetVersionCatalog(manifests)
+
+	enableRoutes, err := hasAPI(cfg, generators.RouteGVK)
+	if err != nil {
+		setupLog.Error(err, "unable to discover the OpenShift route API")
+		os.Exit(1)
+	}
+	if enableRoutes {
+		setupLog.Info("OpenShift route API found, exposing components using routes")
+	}
+
+	enableCertManager, err := hasAPI(cfg, generators.CertificateGVK)
+	if err != nil {
+		setupLog.Error(err, "unable to discover the cert-manager API")
+		os.Exit(1)
+	}
+	if enableCertManager {
+		setupLog.Info("cert-manager API found, certificates can be requested from cert-manager")
+	}
+
 	if err = (&controllers.PachydermReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Pachyderm"),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Log:               ctrl.Log.WithName("controllers").WithName("Pachyderm"),
+		Scheme:            mgr.GetScheme(),
+		Recorder:          mgr.GetEventRecorderFor("pachyderm-operator"),
+		EnableRoutes:      enableRoutes,
+		EnableCertManager: enableCertManager,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Pachyderm")
 		os.Exit(1)
@@ -98,6 +145,24 @@ func main() {
 			os.Exit(1)
 		}
 	}
+	if err = (&controllers.PachydermBackupReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("PachydermBackup"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("pachyderm-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PachydermBackup")
+		os.Exit(1)
+	}
+	if err = (&controllers.PachydermRestoreReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("PachydermRestore"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("pachyderm-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PachydermRestore")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -129,3 +194,51 @@ func hasOLMCert() bool {
 	_, err := os.Stat(webhookCertDir)
 	return err == nil
 }
+
+// manifestCatalog returns the catalog providing the manifests
+// of the Pachyderm versions deployed by the operator
+func manifestCatalog(mgr ctrl.Manager, dir, configMap string) (catalog.Catalog, error) {
+	if configMap != "" {
+		parts := strings.Split(configMap, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid manifests config map %q, expected <namespace>/<name>", configMap)
+		}
+		setupLog.Info("reading manifests from config map", "configmap", configMap)
+		return catalog.NewConfigMapCatalog(mgr.GetAPIReader(), types.NamespacedName{
+			Namespace: parts[0],
+			Name:      parts[1],
+		}), nil
+	}
+
+	if dir != "" {
+		setupLog.Info("reading manifests from directory", "dir", dir)
+		return catalog.NewDirCatalog(dir), nil
+	}
+
+	return catalog.Embedded(), nil
+}
+
+// hasAPI checks if the API of an optional
+// dependency is served by the cluster
+func hasAPI(cfg *rest.Config, gvk schema.GroupVersionKind) (bool, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	resources, err := dc.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, resource := range resources.APIResources {
+		if resource.Kind == gvk.Kind {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
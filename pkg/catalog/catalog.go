@@ -0,0 +1,85 @@
+// Package catalog provides the manifests of the
+// Pachyderm versions deployed by the operator
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// ErrVersionNotFound is returned when the
+// catalog has no manifests for a version
+var ErrVersionNotFound = errors.New("pachyderm version not found")
+
+// Catalog lists the Pachyderm versions supported
+// by the operator and loads their manifests
+type Catalog interface {
+	// Versions returns the available versions, with a v prefix,
+	// sorted from the oldest to the newest version
+	Versions() ([]string, error)
+	// Manifests returns the manifests of a version.
+	// The version is accepted with or without the v prefix
+	Manifests(version string) ([]byte, error)
+	// DefaultVersion returns the newest available version
+	DefaultVersion() (string, error)
+}
+
+// Revisioned is implemented by catalogs whose manifests can change
+// while the operator runs. The revision changes whenever the manifests
+// of any version change, so parsed manifests are only reused while the
+// revision they were read at is current.
+type Revisioned interface {
+	Revision() (string, error)
+}
+
+// Canonical returns the version with the v prefix used by the
+// catalog and semver, or an empty string if the version is invalid
+func Canonical(version string) string {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	if !semver.IsValid(version) {
+		return ""
+	}
+	return version
+}
+
+// sortVersions returns the valid versions in canonical
+// form, sorted from the oldest to the newest version
+func sortVersions(names []string) []string {
+	versions := []string{}
+	for _, name := range names {
+		if version := Canonical(name); version != "" {
+			versions = append(versions, version)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.Compare(versions[i], versions[j]) < 0
+	})
+
+	return versions
+}
+
+// defaultVersion returns the newest version of the catalog
+func defaultVersion(c Catalog) (string, error) {
+	versions, err := c.Versions()
+	if err != nil {
+		return "", err
+	}
+
+	if len(versions) == 0 {
+		return "", fmt.Errorf("no pachyderm versions available")
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+// versionNotFound returns the error for a missing version
+func versionNotFound(version string) error {
+	return fmt.Errorf("%w: %s", ErrVersionNotFound, version)
+}
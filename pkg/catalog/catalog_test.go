@@ -0,0 +1,141 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Canonical", func() {
+	It("adds the v prefix", func() {
+		Expect(Canonical("2.0.0")).To(Equal("v2.0.0"))
+		Expect(Canonical("v2.0.0")).To(Equal("v2.0.0"))
+	})
+
+	It("rejects invalid versions", func() {
+		Expect(Canonical("latest")).To(BeEmpty())
+		Expect(Canonical("")).To(BeEmpty())
+	})
+})
+
+var _ = Describe("sortVersions", func() {
+	It("sorts versions by semver and drops invalid names", func() {
+		Expect(sortVersions([]string{"2.10.0", "v2.9.1", "README", "2.0.0", "v1.13.3"})).
+			To(Equal([]string{"v1.13.3", "v2.0.0", "v2.9.1", "v2.10.0"}))
+	})
+})
+
+var _ = Describe("fsCatalog", func() {
+	var c Catalog
+
+	BeforeEach(func() {
+		c = NewFSCatalog(fstest.MapFS{
+			"2.0.0/manifests.yaml":   {Data: []byte("kind: List # 2.0.0")},
+			"v2.10.0/manifests.yaml": {Data: []byte("kind: List # 2.10.0")},
+			"2.9.0/manifests.yaml":   {Data: []byte("kind: List # 2.9.0")},
+			"2.1.0/README.md":        {Data: []byte("no manifests")},
+			"manifests.go":           {Data: []byte("package manifests")},
+		})
+	})
+
+	It("lists the directories holding manifests", func() {
+		Expect(c.Versions()).To(Equal([]string{"v2.0.0", "v2.9.0", "v2.10.0"}))
+	})
+
+	It("returns the newest version as the default", func() {
+		Expect(c.DefaultVersion()).To(Equal("v2.10.0"))
+	})
+
+	It("reads directories named with or without the v prefix", func() {
+		Expect(c.Manifests("v2.0.0")).To(Equal([]byte("kind: List # 2.0.0")))
+		Expect(c.Manifests("2.10.0")).To(Equal([]byte("kind: List # 2.10.0")))
+	})
+
+	It("reports missing versions", func() {
+		for _, version := range []string{"2.1.0", "3.0.0", "latest"} {
+			_, err := c.Manifests(version)
+			Expect(errors.Is(err, ErrVersionNotFound)).To(BeTrue(), version)
+		}
+	})
+
+	It("reports an empty catalog", func() {
+		_, err := NewFSCatalog(fstest.MapFS{}).DefaultVersion()
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("configMapCatalog", func() {
+	var (
+		c      Catalog
+		key    types.NamespacedName
+		reader client.Client
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+		key = types.NamespacedName{Name: "pachyderm-versions", Namespace: "pachyderm-system"}
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Data: map[string]string{
+				"2.0.0":  "kind: List # 2.0.0",
+				"v2.1.0": "kind: List # 2.1.0",
+				"notes":  "not a version",
+			},
+			BinaryData: map[string][]byte{
+				"2.0.10": []byte("kind: List # 2.0.10"),
+			},
+		}
+		reader = fake.NewFakeClientWithScheme(scheme, cm)
+		c = NewConfigMapCatalog(reader, key)
+	})
+
+	It("lists the keys of the data and binary data", func() {
+		Expect(c.Versions()).To(Equal([]string{"v2.0.0", "v2.0.10", "v2.1.0"}))
+		Expect(c.DefaultVersion()).To(Equal("v2.1.0"))
+	})
+
+	It("reads keys named with or without the v prefix", func() {
+		Expect(c.Manifests("v2.0.0")).To(Equal([]byte("kind: List # 2.0.0")))
+		Expect(c.Manifests("2.1.0")).To(Equal([]byte("kind: List # 2.1.0")))
+		Expect(c.Manifests("2.0.10")).To(Equal([]byte("kind: List # 2.0.10")))
+	})
+
+	It("reports missing versions", func() {
+		_, err := c.Manifests("2.2.0")
+		Expect(errors.Is(err, ErrVersionNotFound)).To(BeTrue())
+	})
+
+	It("changes the revision when the config map changes", func() {
+		revision, err := c.(Revisioned).Revision()
+		Expect(err).NotTo(HaveOccurred())
+
+		cm := &corev1.ConfigMap{}
+		Expect(reader.Get(context.Background(), key, cm)).To(Succeed())
+		cm.Data["2.2.0"] = "kind: List # 2.2.0"
+		Expect(reader.Update(context.Background(), cm)).To(Succeed())
+
+		Expect(c.(Revisioned).Revision()).NotTo(Equal(revision))
+		Expect(c.Manifests("2.2.0")).To(Equal([]byte("kind: List # 2.2.0")))
+	})
+
+	It("returns the error reading the config map", func() {
+		key.Name = "missing"
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		_, err := NewConfigMapCatalog(fake.NewFakeClientWithScheme(scheme), key).Versions()
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrVersionNotFound)).To(BeFalse())
+	})
+})
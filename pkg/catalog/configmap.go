@@ -0,0 +1,90 @@
+package catalog
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// configMapCatalog reads the manifests of each version
+// from the key of the same name in a config map
+type configMapCatalog struct {
+	reader client.Reader
+	key    types.NamespacedName
+}
+
+// NewConfigMapCatalog returns a catalog reading the manifests of
+// each version from the config map key named after the version,
+// for example 2.0.0. The config map is read on every call, so
+// versions can be added or changed without restarting the operator.
+// The catalog revision is the resource version of the config map.
+func NewConfigMapCatalog(reader client.Reader, key types.NamespacedName) Catalog {
+	return &configMapCatalog{
+		reader: reader,
+		key:    key,
+	}
+}
+
+func (c *configMapCatalog) configMap() (*corev1.ConfigMap, error) {
+	cm := &corev1.ConfigMap{}
+	if err := c.reader.Get(context.Background(), c.key, cm); err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+func (c *configMapCatalog) Versions() ([]string, error) {
+	cm, err := c.configMap()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range cm.Data {
+		names = append(names, name)
+	}
+	for name := range cm.BinaryData {
+		names = append(names, name)
+	}
+
+	return sortVersions(names), nil
+}
+
+func (c *configMapCatalog) Manifests(version string) ([]byte, error) {
+	canonical := Canonical(version)
+	if canonical == "" {
+		return nil, versionNotFound(version)
+	}
+
+	cm, err := c.configMap()
+	if err != nil {
+		return nil, err
+	}
+
+	// keys may be named with or without the v prefix
+	for _, key := range []string{strings.TrimPrefix(canonical, "v"), canonical} {
+		if data, ok := cm.Data[key]; ok {
+			return []byte(data), nil
+		}
+		if data, ok := cm.BinaryData[key]; ok {
+			return data, nil
+		}
+	}
+
+	return nil, versionNotFound(version)
+}
+
+func (c *configMapCatalog) DefaultVersion() (string, error) {
+	return defaultVersion(c)
+}
+
+func (c *configMapCatalog) Revision() (string, error) {
+	cm, err := c.configMap()
+	if err != nil {
+		return "", err
+	}
+	return cm.ResourceVersion, nil
+}
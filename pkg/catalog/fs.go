@@ -0,0 +1,83 @@
+package catalog
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/opdev/pachyderm-operator/hack/manifests"
+)
+
+// manifestsFile is the name of the file
+// holding the manifests of a version
+const manifestsFile = "manifests.yaml"
+
+// fsCatalog reads the manifests of each version
+// from <version>/manifests.yaml in a file system
+type fsCatalog struct {
+	fsys fs.FS
+}
+
+// NewFSCatalog returns a catalog reading the manifests of each
+// version from <version>/manifests.yaml in the file system.
+// Version directories are named with or without the v prefix.
+func NewFSCatalog(fsys fs.FS) Catalog {
+	return &fsCatalog{fsys: fsys}
+}
+
+// NewDirCatalog returns a catalog reading the manifests
+// of each version from <dir>/<version>/manifests.yaml
+func NewDirCatalog(dir string) Catalog {
+	return NewFSCatalog(os.DirFS(dir))
+}
+
+// Embedded returns the catalog of the manifests
+// compiled into the operator binary
+func Embedded() Catalog {
+	return NewFSCatalog(manifests.FS)
+}
+
+func (c *fsCatalog) Versions() ([]string, error) {
+	entries, err := fs.ReadDir(c.fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := fs.Stat(c.fsys, path.Join(entry.Name(), manifestsFile)); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return sortVersions(names), nil
+}
+
+func (c *fsCatalog) Manifests(version string) ([]byte, error) {
+	canonical := Canonical(version)
+	if canonical == "" {
+		return nil, versionNotFound(version)
+	}
+
+	// directories may be named with or without the v prefix
+	for _, dir := range []string{strings.TrimPrefix(canonical, "v"), canonical} {
+		data, err := fs.ReadFile(c.fsys, path.Join(dir, manifestsFile))
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return nil, versionNotFound(version)
+}
+
+func (c *fsCatalog) DefaultVersion() (string, error) {
+	return defaultVersion(c)
+}